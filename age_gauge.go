@@ -0,0 +1,42 @@
+package spectator
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// AgeGauge reports the number of seconds since the last time it was set,
+// computed at measurement time using the registry clock. If it has never been
+// set it reports the age since the registry was created.
+type AgeGauge struct {
+	id        *Id
+	clock     Clock
+	lastNanos int64
+}
+
+func NewAgeGauge(id *Id, clock Clock, initNanos int64) *AgeGauge {
+	return &AgeGauge{id, clock, initNanos}
+}
+
+func (g *AgeGauge) MeterId() *Id {
+	return g.id
+}
+
+func (g *AgeGauge) Measure() []Measurement {
+	return []Measurement{{g.id.WithDefaultStat("gauge"), g.Age()}}
+}
+
+// Set records the timestamp of the last event
+func (g *AgeGauge) Set(timestamp time.Time) {
+	atomic.StoreInt64(&g.lastNanos, timestamp.UnixNano())
+}
+
+// Now records the current time as the timestamp of the last event
+func (g *AgeGauge) Now() {
+	atomic.StoreInt64(&g.lastNanos, g.clock.Nanos())
+}
+
+// Age returns the number of seconds since the last event
+func (g *AgeGauge) Age() float64 {
+	return float64(g.clock.Nanos()-atomic.LoadInt64(&g.lastNanos)) / 1e9
+}
@@ -0,0 +1,54 @@
+package spectator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAgeGauge_Set(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	clock.SetFromDuration(10 * time.Second)
+	r.clock = clock
+
+	g := r.AgeGauge("age", nil)
+	g.Set(clock.Now())
+	if v := g.Age(); v != 0 {
+		t.Errorf("Expected 0, got %f", v)
+	}
+
+	clock.SetFromDuration(15 * time.Second)
+	if v := g.Age(); v != 5 {
+		t.Errorf("Expected 5, got %f", v)
+	}
+
+	clock.SetFromDuration(75 * time.Second)
+	ms := g.Measure()
+	expectedId := NewId("age", map[string]string{"statistic": "gauge"})
+	expected := []Measurement{{expectedId, 65}}
+	if !reflect.DeepEqual(expected, ms) {
+		t.Error("Unexpected measurements: ", ms)
+	}
+
+	// age gauges keep their value after being measured
+	if v := g.Age(); v != 65 {
+		t.Errorf("Expected 65, got %f", v)
+	}
+
+	g.Now()
+	if v := g.Age(); v != 0 {
+		t.Errorf("Expected 0 after Now(), got %f", v)
+	}
+}
+
+func TestAgeGauge_NeverSet(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	clock.SetNanos(r.startNanos + int64(30*time.Second))
+	r.clock = clock
+
+	if v := r.AgeGauge("age", nil).Age(); v != 30 {
+		t.Errorf("Expected the age since the registry was created, got %f", v)
+	}
+}
@@ -19,6 +19,21 @@ func addFloat64(addr *uint64, delta float64) {
 	}
 }
 
+// adds a non-negative delta, saturating at math.MaxInt64 instead of wrapping
+// around to negative values
+func addSaturating(addr *int64, delta int64) {
+	for {
+		old := atomic.LoadInt64(addr)
+		newVal := old + delta
+		if newVal < old {
+			newVal = math.MaxInt64
+		}
+		if atomic.CompareAndSwapInt64(addr, old, newVal) {
+			return
+		}
+	}
+}
+
 func updateMax(addr *int64, v int64) {
 	m := atomic.LoadInt64(addr)
 	for v > m {
@@ -29,6 +44,16 @@ func updateMax(addr *int64, v int64) {
 	}
 }
 
+func updateMin(addr *int64, v int64) {
+	m := atomic.LoadInt64(addr)
+	for v < m {
+		if atomic.CompareAndSwapInt64(addr, m, v) {
+			break
+		}
+		m = atomic.LoadInt64(addr)
+	}
+}
+
 func swapFloat64(addr *uint64, newVal float64) float64 {
 	return math.Float64frombits(atomic.SwapUint64(addr, math.Float64bits(newVal)))
 }
@@ -40,3 +65,17 @@ func loadFloat64(addr *uint64) float64 {
 func storeFloat64(addr *uint64, newVal float64) {
 	atomic.StoreUint64(addr, math.Float64bits(newVal))
 }
+
+// like updateMax, treating NaN as an unset value
+func updateMaxFloat64(addr *uint64, v float64) {
+	for {
+		oldBits := atomic.LoadUint64(addr)
+		old := math.Float64frombits(oldBits)
+		if !math.IsNaN(old) && v <= old {
+			return
+		}
+		if atomic.CompareAndSwapUint64(addr, oldBits, math.Float64bits(v)) {
+			return
+		}
+	}
+}
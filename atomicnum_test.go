@@ -1,6 +1,7 @@
 package spectator
 
 import (
+	"math"
 	"sync"
 	"testing"
 )
@@ -25,3 +26,13 @@ func TestUpdateMaxRace(t *testing.T) {
 		}
 	}
 }
+
+func TestAddSaturating(t *testing.T) {
+	v := int64(math.MaxInt64 - 10)
+	addSaturating(&v, 5)
+	assertEqual(t, v, int64(math.MaxInt64-5), "expected a plain add below the limit")
+	addSaturating(&v, 10)
+	assertEqual(t, v, int64(math.MaxInt64), "expected the value to saturate")
+	addSaturating(&v, math.MaxInt64)
+	assertEqual(t, v, int64(math.MaxInt64), "expected the value to stay saturated")
+}
@@ -0,0 +1,77 @@
+package spectator
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// BucketFunction maps an amount to the value of the bucket tag
+type BucketFunction func(amount int64) string
+
+// BucketCounter increments a counter tagged with the bucket computed for
+// each recorded amount. Each distinct bucket is a separate counter.
+type BucketCounter struct {
+	registry   *Registry
+	id         *Id
+	bucketFunc BucketFunction
+}
+
+func NewBucketCounter(registry *Registry, name string, tags map[string]string, bucketFunc BucketFunction) *BucketCounter {
+	return NewBucketCounterWithId(registry, NewId(name, tags), bucketFunc)
+}
+
+func NewBucketCounterWithId(registry *Registry, id *Id, bucketFunc BucketFunction) *BucketCounter {
+	return &BucketCounter{registry, id, bucketFunc}
+}
+
+func (b *BucketCounter) Record(amount int64) {
+	b.registry.CounterWithId(b.id.WithTag("bucket", b.bucketFunc(amount))).Increment()
+}
+
+// PowerOfTwoBuckets buckets amounts by the smallest power of two that is
+// greater or equal to the amount. Amounts less than one map to bucket 0.
+func PowerOfTwoBuckets(amount int64) string {
+	if amount <= 0 {
+		return "0"
+	}
+	if amount == 1 {
+		return "1"
+	}
+	shift := 64 - bits.LeadingZeros64(uint64(amount-1))
+	if shift >= 63 {
+		return "large"
+	}
+	return fmt.Sprintf("%d", int64(1)<<uint(shift))
+}
+
+// LatencyBuckets returns a bucket function for durations in nanoseconds,
+// splitting the range up to max in four buckets (max/8, max/4, max/2, max).
+// Durations above max are tagged slow.
+func LatencyBuckets(max time.Duration) BucketFunction {
+	boundaries := []time.Duration{max / 8, max / 4, max / 2, max}
+	labels := make([]string, len(boundaries))
+	unit, suffix := time.Millisecond, "ms"
+	if max < 10*time.Millisecond {
+		unit, suffix = time.Microsecond, "us"
+	} else if max >= 10*time.Second {
+		unit, suffix = time.Second, "s"
+	}
+	width := len(fmt.Sprintf("%d", max/unit))
+	for i, b := range boundaries {
+		labels[i] = fmt.Sprintf("%0*d%s", width, b/unit, suffix)
+	}
+
+	return func(amount int64) string {
+		d := time.Duration(amount)
+		if d < 0 {
+			return "negative"
+		}
+		for i, b := range boundaries {
+			if d <= b {
+				return labels[i]
+			}
+		}
+		return "slow"
+	}
+}
@@ -0,0 +1,60 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketCounter_Record(t *testing.T) {
+	r := NewRegistry(config)
+	b := r.BucketCounter("payload.size", map[string]string{"app": "test"}, PowerOfTwoBuckets)
+	for _, amount := range []int64{0, 1, 3, 4, 100, 128, 1000} {
+		b.Record(amount)
+	}
+
+	expected := map[string]float64{"0": 1, "1": 1, "4": 2, "128": 2, "1024": 1}
+	counters := 0
+	for _, m := range r.Meters() {
+		id := m.MeterId()
+		if id.name != "payload.size" {
+			continue
+		}
+		counters++
+		if id.tags["app"] != "test" {
+			t.Errorf("Expected the base tags to be kept, got %v", id.tags)
+		}
+		bucket := id.tags["bucket"]
+		if v := m.(*Counter).Count(); v != expected[bucket] {
+			t.Errorf("Bucket %s: expected %f, got %f", bucket, expected[bucket], v)
+		}
+	}
+	if counters != len(expected) {
+		t.Errorf("Expected %d bucket counters, got %d", len(expected), counters)
+	}
+}
+
+func TestPowerOfTwoBuckets(t *testing.T) {
+	cases := map[int64]string{-1: "0", 0: "0", 1: "1", 2: "2", 5: "8", 1024: "1024", 1025: "2048"}
+	for amount, expected := range cases {
+		if b := PowerOfTwoBuckets(amount); b != expected {
+			t.Errorf("PowerOfTwoBuckets(%d) = %s, expected %s", amount, b, expected)
+		}
+	}
+}
+
+func TestLatencyBuckets(t *testing.T) {
+	f := LatencyBuckets(time.Second)
+	cases := map[time.Duration]string{
+		-time.Millisecond:       "negative",
+		10 * time.Millisecond:   "0125ms",
+		200 * time.Millisecond:  "0250ms",
+		300 * time.Millisecond:  "0500ms",
+		time.Second:             "1000ms",
+		1001 * time.Millisecond: "slow",
+	}
+	for d, expected := range cases {
+		if b := f(int64(d)); b != expected {
+			t.Errorf("LatencyBuckets(1s)(%v) = %s, expected %s", d, b, expected)
+		}
+	}
+}
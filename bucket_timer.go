@@ -0,0 +1,23 @@
+package spectator
+
+import "time"
+
+// BucketTimer records durations in a timer tagged with the bucket computed
+// for each duration. Each distinct bucket is a separate timer.
+type BucketTimer struct {
+	registry   *Registry
+	id         *Id
+	bucketFunc BucketFunction
+}
+
+func NewBucketTimer(registry *Registry, name string, tags map[string]string, bucketFunc BucketFunction) *BucketTimer {
+	return NewBucketTimerWithId(registry, NewId(name, tags), bucketFunc)
+}
+
+func NewBucketTimerWithId(registry *Registry, id *Id, bucketFunc BucketFunction) *BucketTimer {
+	return &BucketTimer{registry, id, bucketFunc}
+}
+
+func (b *BucketTimer) Record(amount time.Duration) {
+	b.registry.TimerWithId(b.id.WithTag("bucket", b.bucketFunc(int64(amount)))).Record(amount)
+}
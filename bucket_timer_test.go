@@ -0,0 +1,37 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTimer_Record(t *testing.T) {
+	r := NewRegistry(config)
+	b := r.BucketTimer("req.latency", nil, LatencyBuckets(time.Second))
+	b.Record(10 * time.Millisecond)
+	b.Record(20 * time.Millisecond)
+	b.Record(400 * time.Millisecond)
+	b.Record(2 * time.Second)
+
+	expected := map[string]int64{"0125ms": 2, "0500ms": 1, "slow": 1}
+	timers := 0
+	for _, m := range r.Meters() {
+		id := m.MeterId()
+		if id.name != "req.latency" {
+			continue
+		}
+		timers++
+		bucket := id.tags["bucket"]
+		if v := m.(*Timer).Count(); v != expected[bucket] {
+			t.Errorf("Bucket %s: expected %d, got %d", bucket, expected[bucket], v)
+		}
+	}
+	if timers != len(expected) {
+		t.Errorf("Expected %d bucket timers, got %d", len(expected), timers)
+	}
+
+	slow := r.Timer("req.latency", map[string]string{"bucket": "slow"})
+	if v := slow.TotalTime(); v != 2*time.Second {
+		t.Errorf("Expected the duration to be recorded, got %v", v)
+	}
+}
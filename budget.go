@@ -0,0 +1,73 @@
+package spectator
+
+import "sort"
+
+// the estimated size of a measurement in an Atlas JSON payload besides its
+// strings: the indices of its tags, its op and value
+const measurementOverhead = 32
+
+// returns the measurements of a publish that fit in the budget set by
+// MaxMeasurementsPerPublish and MaxBytesPerPublish, counting the others in
+// spectator.measurements with id=dropped and error=budget. It's only applied
+// to the measurements actually sent.
+//
+// The measurements of the current interval are kept before the deltas
+// retained from failed publishes, newest first. Within an interval they're
+// ordered by id, starting from the first one dropped by the previous
+// publish and wrapping around, so a series over the budget is dropped for
+// one publish at a time rather than starved.
+func (r *Registry) withinBudget(measurements []Measurement, windows deltaWindows) []Measurement {
+	maxMeasurements, maxBytes := r.config.MaxMeasurementsPerPublish, r.config.MaxBytesPerPublish
+	if maxMeasurements <= 0 && maxBytes <= 0 {
+		return measurements
+	}
+	size := 0
+	if maxBytes > 0 {
+		for _, m := range measurements {
+			size += estimatedSize(m)
+		}
+	}
+	if (maxMeasurements <= 0 || len(measurements) <= maxMeasurements) && (maxBytes <= 0 || size <= maxBytes) {
+		return measurements
+	}
+
+	cursor := r.budgetCursor
+	sort.Slice(measurements, func(i, j int) bool {
+		a, b := measurements[i], measurements[j]
+		if startA, startB := windows.startOf(a), windows.startOf(b); startA != startB {
+			return startA > startB
+		}
+		keyA, keyB := a.id.mapKey(), b.id.mapKey()
+		if wrappedA, wrappedB := keyA < cursor, keyB < cursor; wrappedA != wrappedB {
+			return wrappedB
+		}
+		return keyA < keyB
+	})
+	kept, size := 0, 0
+	for _, m := range measurements {
+		size += estimatedSize(m)
+		if (maxMeasurements > 0 && kept >= maxMeasurements) || (maxBytes > 0 && size > maxBytes) {
+			break
+		}
+		kept++
+	}
+	dropped := len(measurements) - kept
+	r.budgetCursor = measurements[kept].id.mapKey()
+	r.logPublishError("Dropping measurements over the publish budget", "count", dropped,
+		"maxMeasurements", maxMeasurements, "maxBytes", maxBytes)
+	r.Counter("spectator.measurements", map[string]string{
+		"id":    "dropped",
+		"error": "budget",
+	}).Add(int64(dropped))
+	return measurements[:kept]
+}
+
+// returns the estimated size of the measurement in an Atlas JSON payload,
+// counting its strings as if they weren't shared with other measurements
+func estimatedSize(m Measurement) int {
+	size := measurementOverhead + len(m.id.name)
+	for k, v := range m.id.tags {
+		size += len(k) + len(v)
+	}
+	return size
+}
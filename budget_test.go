@@ -0,0 +1,98 @@
+package spectator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func publishedNames(batch []Measurement) []string {
+	var names []string
+	for _, m := range batch {
+		names = append(names, m.id.name)
+	}
+	return names
+}
+
+func TestRegistry_MaxMeasurementsPerPublish(t *testing.T) {
+	publisher := &recordingPublisher{}
+	cfg := makeConfig("")
+	cfg.Publisher = publisher
+	cfg.MaxMeasurementsPerPublish = 2
+	// keeps the drop counter out of the budget of the next publish
+	cfg.Filters = &Filters{DenyMeters: &NameFilter{Prefix: []string{"spectator."}}}
+	r := NewRegistry(cfg)
+	r.Counter("c", nil).Increment()
+	r.Counter("a", nil).Increment()
+	r.Counter("b", nil).Increment()
+	r.publish()
+
+	if names := publishedNames(publisher.batches[0]); !reflect.DeepEqual(names, []string{"a", "b"}) {
+		t.Errorf("Expected the first series by id to be kept, got %v", names)
+	}
+	dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "budget"})
+	assertEqual(t, dropped.Count(), 1.0, "expected the measurement over the budget to be counted")
+
+	// the next publish starts from the series dropped, rather than starving it
+	r.Counter("c", nil).Increment()
+	r.Counter("a", nil).Increment()
+	r.Counter("b", nil).Increment()
+	r.publish()
+	if names := publishedNames(publisher.batches[1]); !reflect.DeepEqual(names, []string{"c", "a"}) {
+		t.Errorf("Expected the series dropped to be kept next, got %v", names)
+	}
+}
+
+func TestRegistry_MaxMeasurementsPerPublishDisabled(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.Publisher = &recordingPublisher{}
+	cfg.MaxMeasurementsPerPublish = 1
+	cfg.IsEnabled = func() bool { return false }
+	published := 0
+	cfg.OnPublish = func(payload []interface{}, err error) { published++ }
+	r := NewRegistry(cfg)
+	r.Counter("a", nil).Increment()
+	r.Counter("b", nil).Increment()
+	r.publish()
+
+	assertEqual(t, published, 1, "expected OnPublish to be called")
+	dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "budget"})
+	assertEqual(t, dropped.Count(), 0.0, "expected no drops when nothing is sent")
+}
+
+func TestRegistry_MaxMeasurementsPerPublishRetained(t *testing.T) {
+	publisher := &recordingPublisher{err: errors.New("unavailable")}
+	cfg := makeConfig("")
+	cfg.Publisher = publisher
+	cfg.MaxMeasurementsPerPublish = 1
+	r := NewRegistry(cfg)
+	r.Counter("a", nil).Increment()
+	r.publish()
+
+	publisher.err = nil
+	r.Counter("b", nil).Increment()
+	r.publish()
+	if names := publishedNames(publisher.batches[1]); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Errorf("Expected the retained deltas to be dropped first, got %v", names)
+	}
+}
+
+func TestRegistry_MaxBytesPerPublish(t *testing.T) {
+	publisher := &recordingPublisher{}
+	cfg := makeConfig("")
+	cfg.Publisher = publisher
+	cfg.MaxBytesPerPublish = 2*measurementOverhead + 20
+	r := NewRegistry(cfg)
+	r.Counter("a", map[string]string{"k": "v"}).Increment()
+	r.Counter("b", map[string]string{"k": "v"}).Increment()
+	r.Counter("c", map[string]string{"k": "v"}).Increment()
+	r.publish()
+
+	// each counter is measurementOverhead plus 17 bytes of strings, counting
+	// its statistic tag, so only one fits
+	if names := publishedNames(publisher.batches[0]); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("Expected the measurements over the byte budget to be dropped, got %v", names)
+	}
+	dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "budget"})
+	assertEqual(t, dropped.Count(), 2.0, "expected the measurements over the budget to be counted")
+}
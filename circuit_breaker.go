@@ -0,0 +1,83 @@
+package spectator
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultCircuitBreakerInterval = time.Minute
+
+// circuitBreaker pauses the scheduled publishes while the aggregator keeps
+// failing, see Config.CircuitBreakerThreshold
+type circuitBreaker struct {
+	mutex sync.Mutex
+	// consecutive failed publishes
+	failures int
+	// whether the circuit is open, and until when scheduled publishes are
+	// skipped
+	open      bool
+	openUntil int64
+}
+
+// returns whether a scheduled publish should happen at the given time: the
+// circuit is closed, or open long enough that the publish probes the
+// aggregator
+func (b *circuitBreaker) allow(now int64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return !b.open || now >= b.openUntil
+}
+
+// records the outcome of a publish, opening the circuit for interval after
+// threshold consecutive failures, or again if a probe failed, and closing it
+// after a success. Returns whether the circuit changed state.
+func (b *circuitBreaker) record(failed bool, now int64, threshold int, interval time.Duration) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !failed {
+		b.failures = 0
+		wasOpen := b.open
+		b.open = false
+		return wasOpen
+	}
+	b.failures++
+	if !b.open && b.failures < threshold {
+		return false
+	}
+	wasOpen := b.open
+	b.open, b.openUntil = true, now+int64(interval)
+	return !wasOpen
+}
+
+// publishes as scheduled by Start, unless the circuit breaker is open
+func (r *Registry) scheduledPublish() {
+	if r.config.CircuitBreakerThreshold > 0 && !r.breaker.allow(r.clock.Nanos()) {
+		r.config.Log.Debug("Skipping the publish while the aggregator is failing")
+		return
+	}
+	r.config.Log.Debug("Sending measurements")
+	r.publishWithin(r.publishTimeout())
+}
+
+// updates the circuit breaker with the result of a publish. Only failures
+// that would be retried count: a rejected payload doesn't mean the
+// aggregator is down.
+func (r *Registry) recordPublishOutcome(err error) {
+	threshold := r.config.CircuitBreakerThreshold
+	if threshold <= 0 {
+		return
+	}
+	interval := r.config.CircuitBreakerInterval
+	if interval <= 0 {
+		interval = defaultCircuitBreakerInterval
+	}
+	failed := shouldRetry(err)
+	if !r.breaker.record(failed, r.clock.Nanos(), threshold, interval) {
+		return
+	}
+	if failed {
+		r.config.Log.Warn("The aggregator keeps failing, pausing publishes", "interval", interval, "error", err)
+	} else {
+		r.config.Log.Info("The aggregator recovered, resuming publishes")
+	}
+}
@@ -0,0 +1,74 @@
+package spectator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRegistry_CircuitBreaker(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	requests := 0
+	var sent float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+		w.Write(okMsg)
+		if status == http.StatusOK {
+			for _, e := range payloadToEntries(t, readPayload(t, r)) {
+				if e.tags["name"] == "requests" {
+					sent += e.value
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.CircuitBreakerThreshold = 2
+	r := NewRegistry(cfg)
+	clock := &ManualClock{}
+	r.clock = clock
+	counter := r.Counter("requests", nil)
+	publish := func() {
+		counter.Increment()
+		r.scheduledPublish()
+	}
+
+	publish()
+	publish()
+	assertEqual(t, requests, 2, "expected the publishes before the threshold to be posted")
+	publish()
+	publish()
+	assertEqual(t, requests, 2, "expected the publishes to be skipped while the circuit is open")
+
+	// the probe fails, opening the circuit for another interval
+	clock.SetFromDuration(time.Minute)
+	publish()
+	assertEqual(t, requests, 3, "expected a probe after the interval")
+	publish()
+	assertEqual(t, requests, 3, "expected the publishes to be skipped after a failed probe")
+
+	status = http.StatusOK
+	clock.SetFromDuration(2 * time.Minute)
+	publish()
+	publish()
+	assertEqual(t, requests, 5, "expected the publishes to resume after a successful probe")
+	assertEqual(t, sent, 8.0, "expected the deltas of the failed and skipped publishes to be sent")
+}
+
+func TestRegistry_CircuitBreakerRejected(t *testing.T) {
+	requests := 0
+	server := countingServer(http.StatusBadRequest, &requests)
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.CircuitBreakerThreshold = 1
+	r := NewRegistry(cfg)
+	for i := 0; i < 3; i++ {
+		r.Counter("requests", nil).Increment()
+		r.scheduledPublish()
+	}
+	assertEqual(t, requests, 3, "expected rejected payloads not to open the circuit")
+}
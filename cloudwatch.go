@@ -0,0 +1,112 @@
+package spectator
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+)
+
+// CloudWatch accepts up to 30 dimensions per metric
+const maxCloudWatchDimensions = 30
+
+type emfMetric struct {
+	Name string `json:"Name"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+// returns the tag keys used as dimensions: the keys in dimensionKeys, or all
+// of them if it's empty, capped at the CloudWatch limit. The statistic is
+// always a dimension so the values of a timer are kept apart.
+func emfDimensions(tags map[string]string, dimensionKeys []string) []string {
+	dims := []string{}
+	if _, ok := tags["statistic"]; ok {
+		dims = append(dims, "statistic")
+	}
+	keys := dimensionKeys
+	if len(keys) == 0 {
+		keys = sortedTagKeys(tags)
+	}
+	for _, k := range keys {
+		if _, ok := tags[k]; !ok || k == "statistic" {
+			continue
+		}
+		if len(dims) == maxCloudWatchDimensions {
+			break
+		}
+		dims = append(dims, k)
+	}
+	sort.Strings(dims)
+	return dims
+}
+
+// converts the measurements to CloudWatch Embedded Metric Format documents,
+// one per measurement. All tags are added as properties so they can be
+// queried with Logs Insights, but only the ones selected by dimensionKeys
+// become dimensions.
+func measurementsToEmf(measurements []Measurement, commonTags map[string]string, namespace string, dimensionKeys []string, timestampMillis int64) []interface{} {
+	payload := make([]interface{}, len(measurements))
+	for i, m := range measurements {
+		tags := make(map[string]string, len(commonTags)+len(m.id.tags))
+		for k, v := range commonTags {
+			tags[k] = v
+		}
+		for k, v := range m.id.tags {
+			tags[k] = v
+		}
+
+		doc := make(map[string]interface{}, len(tags)+2)
+		for k, v := range tags {
+			doc[k] = v
+		}
+		doc["_aws"] = emfMetadata{
+			Timestamp: timestampMillis,
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  namespace,
+				Dimensions: [][]string{emfDimensions(tags, dimensionKeys)},
+				Metrics:    []emfMetric{{m.id.name}},
+			}},
+		}
+		// the value wins over a tag with the same key as the name
+		doc[m.id.name] = m.value
+		payload[i] = doc
+	}
+	return payload
+}
+
+// writes the documents as JSON lines to CloudWatchOutput, stdout by default,
+// for the CloudWatch agent or the Lambda and ECS log drivers to pick up
+func (r *Registry) writeEmf(payload []interface{}, numMeasurements int) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, doc := range payload {
+		if err := encoder.Encode(doc); err != nil {
+			r.logPublishError("Unable to convert measurements to json", "error", err)
+			return &payloadError{err}
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if r.config.CloudWatchOutput != nil {
+		out = r.config.CloudWatchOutput
+	}
+	r.config.Log.Debug("Writing measurements in the CloudWatch embedded metric format", "count", numMeasurements)
+	r.emfMutex.Lock()
+	defer r.emfMutex.Unlock()
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		r.logPublishError("Unable to write the CloudWatch embedded metric documents", "error", err)
+		return err
+	}
+	return nil
+}
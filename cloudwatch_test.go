@@ -0,0 +1,66 @@
+package spectator
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_publishCloudWatch(t *testing.T) {
+	var out bytes.Buffer
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.CloudWatchNamespace = "spectator"
+	cfg.CloudWatchDimensions = []string{"status", "missing"}
+	cfg.CloudWatchOutput = &out
+	r := NewRegistry(cfg)
+	r.clock = &ManualClock{int64(90 * time.Second)}
+	r.Counter("requests", map[string]string{"status": "2xx", "path": "api"}).Add(3)
+	r.publish()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected one document, got %v", lines)
+	}
+	var doc struct {
+		Aws       emfMetadata `json:"_aws"`
+		Requests  float64     `json:"requests"`
+		Status    string      `json:"status"`
+		Path      string      `json:"path"`
+		App       string      `json:"nf.app"`
+		Statistic string      `json:"statistic"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &doc); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, doc.Aws.Timestamp, int64(90000), "expected the timestamp in milliseconds")
+	directive := doc.Aws.CloudWatchMetrics[0]
+	assertEqual(t, directive.Namespace, "spectator", "unexpected namespace")
+	if expected := [][]string{{"statistic", "status"}}; !reflect.DeepEqual(directive.Dimensions, expected) {
+		t.Errorf("Expected dimensions %v, got %v", expected, directive.Dimensions)
+	}
+	assertEqual(t, directive.Metrics[0].Name, "requests", "unexpected metric name")
+	assertEqual(t, doc.Requests, 3.0, "unexpected value")
+	assertEqual(t, doc.Path, "api", "expected the other tags as properties")
+	assertEqual(t, doc.App, "test", "expected the common tags as properties")
+	assertEqual(t, doc.Statistic, "count", "unexpected statistic")
+}
+
+func TestEmfDimensions_Limit(t *testing.T) {
+	tags := map[string]string{"statistic": "gauge"}
+	for i := 0; i < 40; i++ {
+		tags[string(rune('a'+i))] = "v"
+	}
+	dims := emfDimensions(tags, nil)
+	assertEqual(t, len(dims), maxCloudWatchDimensions, "expected the dimensions to be capped")
+	found := false
+	for _, d := range dims {
+		found = found || d == "statistic"
+	}
+	if !found {
+		t.Errorf("Expected the statistic to be kept as a dimension, got %v", dims)
+	}
+}
@@ -0,0 +1,239 @@
+package spectator
+
+import "sync"
+
+// CompositeRegistry forwards meter updates to a set of child registries, for
+// example to publish to Atlas while also exporting the same meters through
+// the PrometheusHandler of a second registry.
+//
+// The counters, timers, gauges and distribution summaries it returns are not
+// registered anywhere themselves: they forward each update to the meters with
+// the same id in every child registry.
+type CompositeRegistry struct {
+	mutex      sync.RWMutex
+	registries []*Registry
+	// composite meters by id, so lookups return the same instance
+	meters map[string]Meter
+}
+
+var _ MeterRegistry = (*CompositeRegistry)(nil)
+
+func NewCompositeRegistry(registries ...*Registry) *CompositeRegistry {
+	return &CompositeRegistry{registries: registries, meters: map[string]Meter{}}
+}
+
+// Add adds a child registry. Meters obtained from the composite before the
+// registry was added don't forward their updates to it.
+func (c *CompositeRegistry) Add(r *Registry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.registries = append(c.registries, r)
+	c.meters = map[string]Meter{}
+}
+
+func (c *CompositeRegistry) Registries() []*Registry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	registries := make([]*Registry, len(c.registries))
+	copy(registries, c.registries)
+	return registries
+}
+
+// Start starts all child registries, returning the first error found
+func (c *CompositeRegistry) Start() error {
+	var firstErr error
+	for _, r := range c.Registries() {
+		if err := r.Start(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (c *CompositeRegistry) Stop() {
+	for _, r := range c.Registries() {
+		r.Stop()
+	}
+}
+
+func (c *CompositeRegistry) NewId(name string, tags map[string]string) *Id {
+	return NewId(name, tags)
+}
+
+// Clock returns the clock of the first child registry, or the system clock if
+// there are none
+func (c *CompositeRegistry) Clock() Clock {
+	return firstClock(c.Registries())
+}
+
+func firstClock(registries []*Registry) Clock {
+	if len(registries) == 0 {
+		return &SystemClock{}
+	}
+	return registries[0].Clock()
+}
+
+// NewMeter returns the meter registered with the given id in the first child
+// registry, creating it with meterFactory if needed. Unlike the built-in
+// meters, custom meters can't forward their updates, and measuring the same
+// instance from several registries would split its deltas between them, so
+// they are only registered with the first child.
+func (c *CompositeRegistry) NewMeter(id *Id, meterFactory MeterFactoryFun) Meter {
+	registries := c.Registries()
+	if len(registries) == 0 {
+		return meterFactory()
+	}
+	return registries[0].NewMeter(id, meterFactory)
+}
+
+// Register adds a custom meter to the first child registry, see NewMeter
+func (c *CompositeRegistry) Register(meter Meter) error {
+	registries := c.Registries()
+	if len(registries) == 0 {
+		return nil
+	}
+	return registries[0].Register(meter)
+}
+
+// Meters returns the meters of all child registries
+func (c *CompositeRegistry) Meters() []Meter {
+	var meters []Meter
+	for _, r := range c.Registries() {
+		meters = append(meters, r.Meters()...)
+	}
+	return meters
+}
+
+// Measurements returns the measurements of all child registries
+func (c *CompositeRegistry) Measurements() []Measurement {
+	var measurements []Measurement
+	for _, r := range c.Registries() {
+		measurements = append(measurements, r.Measurements()...)
+	}
+	return measurements
+}
+
+// returns the composite meter with the given id, creating it with
+// meterFactory from the child registries if needed
+func (c *CompositeRegistry) composite(id *Id, meterFactory func(registries []*Registry) Meter) Meter {
+	key := id.mapKey()
+	c.mutex.RLock()
+	meter, exists := c.meters[key]
+	c.mutex.RUnlock()
+	if exists {
+		return meter
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if meter, exists = c.meters[key]; !exists {
+		registries := make([]*Registry, len(c.registries))
+		copy(registries, c.registries)
+		meter = meterFactory(registries)
+		c.meters[key] = meter
+	}
+	return meter
+}
+
+func (c *CompositeRegistry) CounterWithId(id *Id) *Counter {
+	m := c.composite(id, func(registries []*Registry) Meter {
+		counter := NewCounter(id)
+		for _, r := range registries {
+			counter.forward = append(counter.forward, r.CounterWithId(id))
+		}
+		return counter
+	})
+
+	counter, ok := m.(*Counter)
+	if ok {
+		return counter
+	}
+
+	c.logError("Unable to register a counter, another meter has the same id", "id", id, "meter", m)
+
+	// throw in strict mode
+	return NewCounter(id)
+}
+
+func (c *CompositeRegistry) Counter(name string, tags map[string]string) *Counter {
+	return c.CounterWithId(NewId(name, tags))
+}
+
+func (c *CompositeRegistry) TimerWithId(id *Id) *Timer {
+	m := c.composite(id, func(registries []*Registry) Meter {
+		timer := newTimerWithClock(id, firstClock(registries))
+		for _, r := range registries {
+			timer.forward = append(timer.forward, r.TimerWithId(id))
+		}
+		return timer
+	})
+
+	timer, ok := m.(*Timer)
+	if ok {
+		return timer
+	}
+
+	c.logError("Unable to register a timer, another meter has the same id", "id", id, "meter", m)
+
+	// throw in strict mode
+	return newTimerWithClock(id, c.Clock())
+}
+
+func (c *CompositeRegistry) Timer(name string, tags map[string]string) *Timer {
+	return c.TimerWithId(NewId(name, tags))
+}
+
+func (c *CompositeRegistry) GaugeWithId(id *Id) *Gauge {
+	m := c.composite(id, func(registries []*Registry) Meter {
+		gauge := NewGauge(id)
+		for _, r := range registries {
+			gauge.forward = append(gauge.forward, r.GaugeWithId(id))
+		}
+		return gauge
+	})
+
+	gauge, ok := m.(*Gauge)
+	if ok {
+		return gauge
+	}
+
+	c.logError("Unable to register a gauge, another meter has the same id", "id", id, "meter", m)
+
+	// throw in strict mode
+	return NewGauge(id)
+}
+
+func (c *CompositeRegistry) Gauge(name string, tags map[string]string) *Gauge {
+	return c.GaugeWithId(NewId(name, tags))
+}
+
+func (c *CompositeRegistry) DistributionSummaryWithId(id *Id) *DistributionSummary {
+	m := c.composite(id, func(registries []*Registry) Meter {
+		summary := NewDistributionSummary(id)
+		for _, r := range registries {
+			summary.forward = append(summary.forward, r.DistributionSummaryWithId(id))
+		}
+		return summary
+	})
+
+	summary, ok := m.(*DistributionSummary)
+	if ok {
+		return summary
+	}
+
+	c.logError("Unable to register a distribution summary, another meter has the same id", "id", id, "meter", m)
+
+	// throw in strict mode
+	return NewDistributionSummary(id)
+}
+
+func (c *CompositeRegistry) DistributionSummary(name string, tags map[string]string) *DistributionSummary {
+	return c.DistributionSummaryWithId(NewId(name, tags))
+}
+
+// logs using the logger of the first child registry
+func (c *CompositeRegistry) logError(msg string, keysAndValues ...interface{}) {
+	if registries := c.Registries(); len(registries) > 0 {
+		registries[0].config.Log.Error(msg, keysAndValues...)
+	}
+}
@@ -0,0 +1,86 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompositeRegistry(t *testing.T) {
+	atlas := NewRegistry(config)
+	prom := NewRegistry(config)
+	c := NewCompositeRegistry(atlas)
+	c.Add(prom)
+
+	c.Counter("foo", nil).Add(2)
+	c.Timer("bar", nil).Record(time.Second)
+	c.Gauge("baz", nil).Set(3)
+	c.DistributionSummary("qux", nil).Record(10)
+
+	for _, r := range []*Registry{atlas, prom} {
+		assertEqual(t, r.Counter("foo", nil).Count(), 2.0, "unexpected count")
+		assertEqual(t, r.Timer("bar", nil).TotalTime(), time.Second, "unexpected total time")
+		assertEqual(t, r.Gauge("baz", nil).Get(), 3.0, "unexpected gauge value")
+		assertEqual(t, r.DistributionSummary("qux", nil).TotalAmount(), int64(10), "unexpected total amount")
+	}
+}
+
+func TestCompositeRegistry_Empty(t *testing.T) {
+	c := NewCompositeRegistry()
+	c.Counter("foo", nil).Increment()
+	c.Timer("bar", nil).TimeFunc(func() {})
+	if err := c.Start(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	c.Stop()
+}
+
+func TestCompositeRegistry_SameInstance(t *testing.T) {
+	c := NewCompositeRegistry(NewRegistry(config))
+	var r MeterRegistry = c
+	if r.Counter("foo", nil) != r.Counter("foo", nil) {
+		t.Error("Expected the same counter to be returned")
+	}
+	if r.Timer("bar", nil) != r.TimerWithId(NewId("bar", nil)) {
+		t.Error("Expected the same timer to be returned")
+	}
+
+	// a registry added later gets the updates of meters looked up afterwards
+	added := NewRegistry(config)
+	c.Add(added)
+	c.Counter("foo", nil).Increment()
+	assertEqual(t, added.Counter("foo", nil).Count(), 1.0, "unexpected count")
+}
+
+func TestCompositeRegistry_Clock(t *testing.T) {
+	child := NewTestRegistry()
+	clock := child.Clock().(*ManualClock)
+	c := NewCompositeRegistry(child)
+	c.Timer("bar", nil).TimeFunc(func() {
+		clock.SetFromDuration(3 * time.Second)
+	})
+	assertEqual(t, child.Timer("bar", nil).TotalTime(), 3*time.Second, "expected the timer to use the registry clock")
+}
+
+func TestCompositeRegistry_Meters(t *testing.T) {
+	a := NewRegistry(config)
+	b := NewRegistry(config)
+	c := NewCompositeRegistry(a, b)
+
+	id := NewId("cache.hitRatio", nil)
+	h := &hitRatio{id, NewCounter(id), NewCounter(id)}
+	h.hits.Increment()
+	if err := c.Register(h); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	m := c.NewMeter(NewId("custom", nil), func() Meter {
+		return NewMaxGauge(NewId("custom", nil))
+	})
+	if a.NewMeter(NewId("custom", nil), nil) != m {
+		t.Error("Expected the meter to be registered with the first child")
+	}
+	c.Counter("foo", nil).Increment()
+
+	assertEqual(t, len(a.Meters()), 3, "expected the custom meters in the first child")
+	assertEqual(t, len(c.Meters()), 4, "expected the meters of both children")
+	assertEqual(t, len(c.Measurements()), 3, "expected the measurements of both children")
+}
@@ -0,0 +1,143 @@
+package spectator
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Environment variables read by ConfigFromEnv
+const (
+	EnvUri        = "SPECTATOR_URI"
+	EnvFrequency  = "SPECTATOR_FREQUENCY"
+	EnvTimeout    = "SPECTATOR_TIMEOUT"
+	EnvBatchSize  = "SPECTATOR_BATCH_SIZE"
+	EnvCommonTags = "SPECTATOR_COMMON_TAGS"
+)
+
+// environment variables set by the Netflix and EC2 tooling, and the common
+// tags they map to. Tags from SPECTATOR_COMMON_TAGS take precedence.
+var envCommonTags = []struct {
+	env string
+	tag string
+}{
+	{"NETFLIX_APP", "nf.app"},
+	{"NETFLIX_CLUSTER", "nf.cluster"},
+	{"NETFLIX_AUTO_SCALE_GROUP", "nf.asg"},
+	{"NETFLIX_STACK", "nf.stack"},
+	{"NETFLIX_ACCOUNT_ID", "nf.account"},
+	{"EC2_REGION", "nf.region"},
+	{"EC2_AVAILABILITY_ZONE", "nf.zone"},
+	{"EC2_INSTANCE_ID", "nf.node"},
+}
+
+const (
+	defaultFrequency = 5 * time.Second
+	defaultTimeout   = 1 * time.Second
+	defaultBatchSize = 10000
+)
+
+func parseDurationEnv(name string, defaultValue time.Duration) (time.Duration, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return defaultValue, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, errors.Wrapf(err, "Invalid duration in %s", name)
+	}
+	if d <= 0 {
+		return 0, errors.Errorf("%s must be a positive duration, got %s", name, v)
+	}
+	return d, nil
+}
+
+// parses comma separated key=value pairs
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.Errorf("Invalid tag %q, expected key=value", pair)
+		}
+		tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return tags, nil
+}
+
+// ConfigFromEnv builds a Config from the SPECTATOR_* environment variables,
+// using defaults for any variable that is not set. Durations use the
+// time.ParseDuration format (e.g. 5s), and common tags are specified as
+// comma separated key=value pairs. Common tags are also taken from the
+// NETFLIX_APP, NETFLIX_CLUSTER, NETFLIX_AUTO_SCALE_GROUP, NETFLIX_STACK,
+// NETFLIX_ACCOUNT_ID, EC2_REGION, EC2_AVAILABILITY_ZONE and EC2_INSTANCE_ID
+// variables.
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Uri:        os.Getenv(EnvUri),
+		BatchSize:  defaultBatchSize,
+		CommonTags: map[string]string{},
+	}
+
+	var err error
+	if config.Frequency, err = parseDurationEnv(EnvFrequency, defaultFrequency); err != nil {
+		return nil, err
+	}
+	if config.Timeout, err = parseDurationEnv(EnvTimeout, defaultTimeout); err != nil {
+		return nil, err
+	}
+
+	if v := os.Getenv(EnvBatchSize); v != "" {
+		config.BatchSize, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid integer in %s", EnvBatchSize)
+		}
+		if config.BatchSize <= 0 {
+			return nil, errors.Errorf("%s must be positive, got %s", EnvBatchSize, v)
+		}
+	}
+
+	for _, e := range envCommonTags {
+		if v := strings.TrimSpace(os.Getenv(e.env)); v != "" {
+			config.CommonTags[e.tag] = v
+		}
+	}
+	if v := os.Getenv(EnvCommonTags); v != "" {
+		tags, err := parseTags(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s", EnvCommonTags)
+		}
+		for k, v := range tags {
+			config.CommonTags[k] = v
+		}
+	}
+
+	return config, nil
+}
+
+// NewRegistryFromEnv creates a registry using ConfigFromEnv. It returns the
+// error of Config.Validate if the config is invalid.
+func NewRegistryFromEnv() (*Registry, error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return NewRegistry(config), nil
+}
+
+// NewRegistryConfiguredByEnv creates a registry using ConfigFromEnv.
+//
+// Deprecated: use NewRegistryFromEnv.
+func NewRegistryConfiguredByEnv() (*Registry, error) {
+	return NewRegistryFromEnv()
+}
@@ -0,0 +1,114 @@
+package spectator
+
+import (
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func setEnv(t *testing.T, env map[string]string) func() {
+	for k, v := range env {
+		if err := os.Setenv(k, v); err != nil {
+			t.Fatal("Unable to set env", err)
+		}
+	}
+	return func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		EnvUri:        "http://example.org/api/v4/update",
+		EnvFrequency:  "10s",
+		EnvTimeout:    "500ms",
+		EnvBatchSize:  "500",
+		EnvCommonTags: "nf.app=app, nf.account=1234",
+	})()
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	expected := &Config{
+		Frequency:  10 * time.Second,
+		Timeout:    500 * time.Millisecond,
+		Uri:        "http://example.org/api/v4/update",
+		BatchSize:  500,
+		CommonTags: map[string]string{"nf.app": "app", "nf.account": "1234"},
+	}
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Errorf("Expected config %v, got %v", expected, cfg)
+	}
+}
+
+func TestConfigFromEnv_NetflixTags(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"NETFLIX_APP":     "app",
+		"NETFLIX_CLUSTER": "app-main",
+		"EC2_REGION":      "us-east-1",
+		"EC2_INSTANCE_ID": "i-1234",
+		EnvCommonTags:     "nf.app=override",
+	})()
+
+	r, err := NewRegistryFromEnv()
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	expected := map[string]string{
+		"nf.app":     "override",
+		"nf.cluster": "app-main",
+		"nf.region":  "us-east-1",
+		"nf.node":    "i-1234",
+	}
+	if tags := r.CommonTags(); !reflect.DeepEqual(expected, tags) {
+		t.Errorf("Expected common tags %v, got %v", expected, tags)
+	}
+}
+
+func TestConfigFromEnv_Defaults(t *testing.T) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+
+	expected := &Config{
+		Frequency:  defaultFrequency,
+		Timeout:    defaultTimeout,
+		BatchSize:  defaultBatchSize,
+		CommonTags: map[string]string{},
+	}
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Errorf("Expected config %v, got %v", expected, cfg)
+	}
+}
+
+func TestConfigFromEnv_Errors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"malformed duration": {EnvFrequency: "5"},
+		"negative timeout":   {EnvTimeout: "-1s"},
+		"malformed batch":    {EnvBatchSize: "lots"},
+		"malformed tags":     {EnvCommonTags: "nf.app"},
+	}
+
+	for name, env := range cases {
+		t.Run(name, func(t *testing.T) {
+			defer setEnv(t, env)()
+			if _, err := ConfigFromEnv(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNewRegistryFromEnv_Invalid(t *testing.T) {
+	defer setEnv(t, map[string]string{EnvUri: "http://example.org/api/v4/update"})()
+
+	if _, err := NewRegistryFromEnv(); err == nil {
+		t.Error("Expected an error for a missing nf.app common tag")
+	}
+}
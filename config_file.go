@@ -0,0 +1,215 @@
+package spectator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Config files are JSON by default, YAML for the .yaml and .yml extensions,
+// and TOML for .toml. All three are decoded to the same tree, which is then
+// unmarshalled like a JSON file.
+
+// reads the Config in filePath. Like in the JSON files, durations are in
+// seconds, and may be fractional.
+func readConfigFile(filePath string) (*Config, error) {
+	path := filepath.Clean(filePath)
+	/* #nosec G304 */
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contents, &tree)
+	case ".toml":
+		_, err = toml.Decode(string(contents), &tree)
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.UseNumber()
+		err = decoder.Decode(&tree)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid config file %s", path)
+	}
+	resolved, err := resolveTree(tree, reflect.TypeOf(Config{}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid config file %s", path)
+	}
+	contents, err = json.Marshal(resolved)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid config file %s", path)
+	}
+
+	var config Config
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid config file %s", path)
+	}
+	return &config, nil
+}
+
+// reloads the config file the registry was created from if it changed,
+// applying its common tags, frequency and enabled flag. Common tags set with
+// SetCommonTag are kept unless the file changes them.
+func (r *Registry) reloadConfig() {
+	info, err := os.Stat(r.configFile)
+	if err != nil {
+		r.config.Log.Error("Unable to reload the config", "error", err)
+		return
+	}
+	if info.ModTime().Equal(r.configModTime) {
+		return
+	}
+	config, err := readConfigFile(r.configFile)
+	if err != nil {
+		r.config.Log.Warn("Unable to reload the config, keeping the current one", "error", err)
+		return
+	}
+	r.configModTime = info.ModTime()
+
+	previous := r.fileConfig
+	for k := range previous.CommonTags {
+		if _, exists := config.CommonTags[k]; !exists {
+			r.RemoveCommonTag(k)
+		}
+	}
+	for k, v := range config.CommonTags {
+		if old, exists := previous.CommonTags[k]; !exists || old != v {
+			r.SetCommonTag(k, v)
+		}
+	}
+	if config.Frequency != previous.Frequency {
+		if err := r.SetFrequency(config.Frequency); err != nil {
+			r.config.Log.Error("Unable to reload the frequency", "error", err)
+		}
+	}
+	var enabled int32 = 1
+	if config.Enabled != nil && !*config.Enabled {
+		enabled = 0
+	}
+	atomic.StoreInt32(&r.enabled, enabled)
+	r.fileConfig = config
+	r.config.Log.Info("Reloaded the config", "file", r.configFile)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// converts a decoded tree to one encoding/json unmarshals to the type t, nil
+// if unknown: YAML mappings get string keys, numbers and booleans decoded to
+// strings are formatted, so e.g. nf.account: 1234 is a string in the common
+// tags, and durations in seconds are converted to nanoseconds
+func resolveTree(v interface{}, t reflect.Type) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			r, err := resolveTree(e, fieldType(t, k))
+			if err != nil {
+				return nil, err
+			}
+			resolved[k] = r
+		}
+		return resolved, nil
+	case map[interface{}]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			key := fmt.Sprint(k)
+			r, err := resolveTree(e, fieldType(t, key))
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = r
+		}
+		return resolved, nil
+	case []interface{}:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		resolved := make([]interface{}, len(v))
+		for i, e := range v {
+			r, err := resolveTree(e, elem)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = r
+		}
+		return resolved, nil
+	case nil:
+		return nil, nil
+	}
+	if t == durationType {
+		seconds, ok := toSeconds(v)
+		if !ok {
+			return nil, errors.Errorf("invalid duration %v, expected a number of seconds", v)
+		}
+		return int64(math.Round(seconds * float64(time.Second))), nil
+	}
+	if t != nil && t.Kind() == reflect.String {
+		switch v.(type) {
+		case bool, int, int64, uint64, float64, json.Number:
+			return fmt.Sprint(v), nil
+		}
+	}
+	return v, nil
+}
+
+func toSeconds(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// returns the type the value for key decodes to in t, a map or a struct
+// with json tags, or nil if unknown
+func fieldType(t reflect.Type, key string) reflect.Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Map:
+		return t.Elem()
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = f.Name
+			}
+			// like encoding/json, keys match case-insensitively
+			if strings.EqualFold(name, key) {
+				return f.Type
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package spectator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadConfigFile(t *testing.T) {
+	for _, path := range []string{"test_config.json", "test_config.yaml", "test_config.toml"} {
+		t.Run(path, func(t *testing.T) {
+			cfg, err := readConfigFile(path)
+			if err != nil {
+				t.Fatal("Unexpected error", err)
+			}
+			expected := &Config{
+				Frequency:  5 * time.Second,
+				Timeout:    1 * time.Second,
+				Uri:        "http://example.org/api/v4/update",
+				BatchSize:  10000,
+				CommonTags: map[string]string{"nf.app": "app", "nf.account": "1234"},
+			}
+			if !reflect.DeepEqual(expected, cfg) {
+				t.Errorf("Expected config %v, got %v", expected, cfg)
+			}
+		})
+	}
+}
+
+// writes doc to a file with the given extension and reads it
+func readConfigString(t *testing.T, ext, doc string) (*Config, error) {
+	dir, err := ioutil.TempDir("", "spectator-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spectator"+ext)
+	if err := ioutil.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return readConfigFile(path)
+}
+
+func TestReadConfigFile_FractionalSeconds(t *testing.T) {
+	docs := map[string]string{
+		".json": `{"frequency": 1.5, "retry_backoff": 0.25}`,
+		".yaml": "frequency: 1.5\nretry_backoff: 0.25\n",
+		".toml": "frequency = 1.5\nretry_backoff = 0.25\n",
+	}
+	for ext, doc := range docs {
+		t.Run(ext, func(t *testing.T) {
+			cfg, err := readConfigString(t, ext, doc)
+			if err != nil {
+				t.Fatal("Unexpected error", err)
+			}
+			assertEqual(t, cfg.Frequency, 1500*time.Millisecond, "unexpected frequency")
+			assertEqual(t, cfg.RetryBackoff, 250*time.Millisecond, "unexpected retry backoff")
+		})
+	}
+}
+
+func TestReadConfigFile_Yaml(t *testing.T) {
+	cfg, err := readConfigString(t, ".yaml", `---
+defaults: &defaults
+  nf.app: app
+  nf.account: 1234
+uri: >-
+  http://example.org/api/v4/publish
+uris:
+- http://a.example.org
+- 'http://b.example.org'
+cloudwatch_dimensions: [nf.app, "nf.cluster"]
+headers:
+  X-Token: |
+    secret
+compression_enabled: false
+common_tags:
+  <<: *defaults
+  nf.stack: 42
+`)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	disabled := false
+	expected := &Config{
+		Uri:                  "http://example.org/api/v4/publish",
+		Uris:                 []string{"http://a.example.org", "http://b.example.org"},
+		CloudWatchDimensions: []string{"nf.app", "nf.cluster"},
+		Headers:              map[string]string{"X-Token": "secret\n"},
+		CompressionEnabled:   &disabled,
+		CommonTags:           map[string]string{"nf.app": "app", "nf.account": "1234", "nf.stack": "42"},
+	}
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Errorf("Expected config %v, got %v", expected, cfg)
+	}
+}
+
+func TestReadConfigFile_Toml(t *testing.T) {
+	cfg, err := readConfigString(t, ".toml", `
+uri = "http://example.org/api/v4/publish" # the aggregator
+uris = [
+  "http://a.example.org",
+  'http://b.example.org', # trailing comma
+]
+headers = { "X-Token" = """
+secret""" }
+common_tags."nf.app" = "app"
+
+[filters.allow_meters]
+exact = ["requests"]
+`)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	expected := &Config{
+		Uri:        "http://example.org/api/v4/publish",
+		Uris:       []string{"http://a.example.org", "http://b.example.org"},
+		Headers:    map[string]string{"X-Token": "secret"},
+		CommonTags: map[string]string{"nf.app": "app"},
+		Filters:    &Filters{AllowMeters: &NameFilter{Exact: []string{"requests"}}},
+	}
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Errorf("Expected config %v, got %v", expected, cfg)
+	}
+}
+
+func TestReadConfigFile_Errors(t *testing.T) {
+	cases := map[string]string{
+		"yaml tabs":          "common_tags:\n\tnf.app: app",
+		"yaml not a mapping": "- a",
+		"yaml unterminated":  "uris: [a, b",
+		"yaml bad duration":  "frequency: often",
+		"toml unquoted":      "uri = http://unquoted",
+		"toml duplicate key": "uri = 'a'\nuri = 'b'",
+		"toml missing value": "uri =",
+		"toml not a table":   "uri = 'a'\n[uri]",
+		"json unterminated":  `{"uri": "a"`,
+		"json wrong type":    `{"batch_size": "many"}`,
+		"json bad duration":  `{"frequency": "5s"}`,
+	}
+	for name, doc := range cases {
+		t.Run(name, func(t *testing.T) {
+			ext := "." + strings.Fields(name)[0]
+			if _, err := readConfigString(t, ext, doc); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestNewRegistryConfiguredBy_Invalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spectator-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spectator.yaml")
+	if err := ioutil.WriteFile(path, []byte("frequency: 5\ntimeout: -1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewRegistryConfiguredBy(path); err == nil {
+		t.Error("Expected an error for a negative timeout")
+	}
+}
+
+func TestRegistry_reloadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spectator-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spectator.yaml")
+	write := func(doc string, modTime time.Time) {
+		if err := ioutil.WriteFile(path, []byte(doc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write("frequency: 5\nreload_interval: 10\ncommon_tags:\n  nf.app: app\n  nf.stack: main\n", start)
+
+	r, err := NewRegistryConfiguredBy(path)
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	assertEqual(t, r.config.ReloadInterval, 10*time.Second, "unexpected reload interval")
+	r.SetCommonTag("nf.node", "i-1234")
+
+	write("frequency: 60\nenabled: false\ncommon_tags:\n  nf.app: other\n", start.Add(time.Minute))
+	r.reloadConfig()
+	expected := map[string]string{"nf.app": "other", "nf.node": "i-1234"}
+	if tags := r.CommonTags(); !reflect.DeepEqual(expected, tags) {
+		t.Errorf("Expected common tags %v, got %v", expected, tags)
+	}
+	assertEqual(t, r.Frequency(), time.Minute, "expected the frequency to be reloaded")
+	assertEqual(t, atomic.LoadInt32(&r.enabled), int32(0), "expected publishing to be disabled")
+
+	// invalid files are ignored
+	write("frequency: [", start.Add(2*time.Minute))
+	r.reloadConfig()
+	assertEqual(t, r.Frequency(), time.Minute, "expected the frequency to be kept")
+}
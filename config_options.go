@@ -0,0 +1,78 @@
+package spectator
+
+import "time"
+
+// Option sets a field of the Config built by NewConfig
+type Option func(*Config)
+
+// NewConfig returns a Config with the same defaults as ConfigFromEnv, a 5s
+// frequency, a 1s timeout and batches of 10,000 measurements, changed by
+// the given options. Config literals keep working.
+func NewConfig(opts ...Option) *Config {
+	config := &Config{
+		Frequency:  defaultFrequency,
+		Timeout:    defaultTimeout,
+		BatchSize:  defaultBatchSize,
+		CommonTags: map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	return config
+}
+
+func WithURI(uri string) Option {
+	return func(c *Config) {
+		c.Uri = uri
+	}
+}
+
+// WithURIs sets several aggregators, see Config.Uris
+func WithURIs(uris ...string) Option {
+	return func(c *Config) {
+		c.Uris = append([]string(nil), uris...)
+	}
+}
+
+func WithFrequency(frequency time.Duration) Option {
+	return func(c *Config) {
+		c.Frequency = frequency
+	}
+}
+
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.Timeout = timeout
+	}
+}
+
+func WithBatchSize(batchSize int) Option {
+	return func(c *Config) {
+		c.BatchSize = batchSize
+	}
+}
+
+// WithCommonTags adds tags to the common tags, replacing those with the same
+// keys
+func WithCommonTags(tags map[string]string) Option {
+	return func(c *Config) {
+		if c.CommonTags == nil {
+			c.CommonTags = map[string]string{}
+		}
+		for k, v := range tags {
+			c.CommonTags[k] = v
+		}
+	}
+}
+
+func WithLogger(log Logger) Option {
+	return func(c *Config) {
+		c.Log = log
+	}
+}
+
+func WithIsEnabled(isEnabled func() bool) Option {
+	return func(c *Config) {
+		c.IsEnabled = isEnabled
+	}
+}
@@ -0,0 +1,44 @@
+package spectator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewConfig(t *testing.T) {
+	cfg := NewConfig()
+	expected := &Config{
+		Frequency:  defaultFrequency,
+		Timeout:    defaultTimeout,
+		BatchSize:  defaultBatchSize,
+		CommonTags: map[string]string{},
+	}
+	if !reflect.DeepEqual(expected, cfg) {
+		t.Errorf("Expected config %v, got %v", expected, cfg)
+	}
+
+	log := defaultLogger()
+	cfg = NewConfig(
+		WithURI("http://example.org/api/v4/publish"),
+		WithURIs("http://a.example.org", "http://b.example.org"),
+		WithFrequency(10*time.Second),
+		WithTimeout(2*time.Second),
+		WithBatchSize(500),
+		WithCommonTags(map[string]string{"nf.app": "app", "nf.stack": "main"}),
+		WithCommonTags(map[string]string{"nf.app": "other"}),
+		WithLogger(log),
+		WithIsEnabled(func() bool { return false }),
+	)
+	assertEqual(t, cfg.Uri, "http://example.org/api/v4/publish", "unexpected uri")
+	assertEqual(t, len(cfg.Uris), 2, "unexpected uris")
+	assertEqual(t, cfg.Frequency, 10*time.Second, "unexpected frequency")
+	assertEqual(t, cfg.Timeout, 2*time.Second, "unexpected timeout")
+	assertEqual(t, cfg.BatchSize, 500, "unexpected batch size")
+	if !reflect.DeepEqual(cfg.CommonTags, map[string]string{"nf.app": "other", "nf.stack": "main"}) {
+		t.Errorf("Expected the common tags to be merged, got %v", cfg.CommonTags)
+	}
+	if cfg.Log != log || cfg.IsEnabled() {
+		t.Error("Expected the logger and IsEnabled to be set")
+	}
+}
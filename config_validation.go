@@ -0,0 +1,92 @@
+package spectator
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Validate checks the configuration for mistakes that would otherwise only
+// show up when publishing, returning an error listing all of them.
+// NewRegistryConfiguredBy and NewRegistryFromEnv return it, while
+// NewRegistry only logs it; Start refuses to start with a frequency that
+// isn't positive.
+func (c *Config) Validate() error {
+	var problems []string
+	if c.Frequency <= 0 {
+		problems = append(problems, fmt.Sprintf("frequency must be positive, got %v", c.Frequency))
+	}
+	if c.Timeout < 0 {
+		problems = append(problems, fmt.Sprintf("timeout can't be negative, got %v", c.Timeout))
+	}
+	switch c.TagPolicy {
+	case "", TagPolicySanitize, TagPolicyReject, TagPolicyLogOnce:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown TagPolicy %q, expected %s, %s or %s", c.TagPolicy,
+			TagPolicySanitize, TagPolicyReject, TagPolicyLogOnce))
+	}
+	if _, err := c.Filters.compile(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if c.BatchSize < 0 {
+		problems = append(problems, fmt.Sprintf("batch size can't be negative, got %d", c.BatchSize))
+	}
+
+	uris := map[string][]string{"Uri": {c.Uri}, "Uris": c.Uris, "OtlpUri": {c.OtlpUri}, "InfluxUri": {c.InfluxUri}}
+	for _, field := range []string{"Uri", "Uris", "OtlpUri", "InfluxUri"} {
+		for _, uri := range uris[field] {
+			if err := validateUri(uri, field == "Uri" || field == "Uris"); err != nil {
+				problems = append(problems, fmt.Sprintf("invalid %s %q: %v", field, uri, err))
+			}
+		}
+	}
+
+	for _, k := range sortedTagKeys(c.CommonTags) {
+		v := c.CommonTags[k]
+		if !isValidTagString(k, maxKeyLength) {
+			problems = append(problems, fmt.Sprintf("invalid common tag key %q, expected up to %d of the characters "+
+				"a-z, A-Z, 0-9, -, ., _, ~ and ^", k, maxKeyLength))
+		}
+		if !isValidTagString(v, maxValueLength) {
+			problems = append(problems, fmt.Sprintf("invalid value %q for the common tag %s, expected 1 to %d of the "+
+				"characters a-z, A-Z, 0-9, -, ., _, ~ and ^", v, k, maxValueLength))
+		}
+	}
+	if (c.Uri != "" || len(c.Uris) > 0) && c.CommonTags["nf.app"] == "" {
+		problems = append(problems, "the nf.app common tag is required to publish to Atlas")
+	}
+
+	if len(problems) > 0 {
+		return errors.Errorf("Invalid config: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// an empty uri is valid, since it's not used
+func validateUri(uri string, allowUnix bool) error {
+	if uri == "" {
+		return nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https":
+		if u.Host == "" {
+			return errors.New("missing host")
+		}
+	case "unix":
+		if !allowUnix {
+			return errors.New("unix sockets are not supported")
+		}
+		if u.Path == "" {
+			return errors.New("missing socket path")
+		}
+	default:
+		return errors.Errorf("expected an http or https uri, got %q", u.Scheme)
+	}
+	return nil
+}
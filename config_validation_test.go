@@ -0,0 +1,56 @@
+package spectator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	if err := makeConfig("http://example.org/api/v4/publish").Validate(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	if err := makeConfig("unix:///run/agent.sock?path=/publish").Validate(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+
+	cases := map[string]func(c *Config){
+		"frequency":       func(c *Config) { c.Frequency = 0 },
+		"timeout":         func(c *Config) { c.Timeout = -time.Second },
+		"batch size":      func(c *Config) { c.BatchSize = -1 },
+		"uri scheme":      func(c *Config) { c.Uri = "example.org/api/v4/publish" },
+		"uri host":        func(c *Config) { c.Uri = "http:///api/v4/publish" },
+		"uris":            func(c *Config) { c.Uris = []string{"http://a.example.org", "ftp://b.example.org"} },
+		"otlp unix":       func(c *Config) { c.OtlpUri = "unix:///run/collector.sock" },
+		"socket path":     func(c *Config) { c.Uri = "unix://" },
+		"tag key":         func(c *Config) { c.CommonTags["nf app"] = "app" },
+		"empty tag value": func(c *Config) { c.CommonTags["nf.stack"] = "" },
+		"missing nf.app":  func(c *Config) { delete(c.CommonTags, "nf.app") },
+		"tag policy":      func(c *Config) { c.TagPolicy = "ignore" },
+	}
+	for name, change := range cases {
+		t.Run(name, func(t *testing.T) {
+			cfg := makeConfig("http://example.org/api/v4/publish")
+			change(cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	cfg := makeConfig("ftp://example.org")
+	cfg.Frequency = 0
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "frequency") || !strings.Contains(err.Error(), "ftp") {
+		t.Errorf("Expected all the problems to be reported, got %v", err)
+	}
+}
+
+func TestRegistry_StartInvalidFrequency(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.Frequency = 0
+	r := NewRegistry(cfg)
+	if err := r.Start(); err == nil {
+		t.Error("Expected an error for a zero frequency")
+	}
+}
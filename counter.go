@@ -1,39 +1,119 @@
 package spectator
 
+import "sync/atomic"
+
 type Counter struct {
-	id    *Id
+	// integer increments since the last measurement, kept apart so Increment
+	// and Add are a single atomic add. The 64-bit fields come first so
+	// they're aligned on 32-bit platforms.
+	ints int64
+	// fractional increments since the last measurement, as float64 bits
 	count uint64
+	// the sum of the previous measurements, as float64 bits
+	measured uint64
+	id       *Id
+	exemplar atomic.Value
+	// the counters of the child registries of a CompositeRegistry
+	forward []*Counter
+	// called when a negative delta is dropped, set by the registry
+	onNegative func()
+}
+
+// Exemplar is a sample increment of a counter with labels identifying where
+// it came from, usually a trace id. Only the OpenMetrics output of the
+// PrometheusHandler includes exemplars.
+type Exemplar struct {
+	Labels map[string]string
+	Value  float64
 }
 
 func NewCounter(id *Id) *Counter {
-	return &Counter{id, 0}
+	return &Counter{id: id}
 }
 
 func (c *Counter) MeterId() *Id {
 	return c.id
 }
 
+// Measure returns the delta since the last time the counter was measured.
+// The deltas are swapped out atomically, so each increment racing with
+// Measure is reported exactly once, by this measurement or the next one.
 func (c *Counter) Measure() []Measurement {
-	cnt := swapFloat64(&c.count, 0.0)
+	cnt := float64(atomic.SwapInt64(&c.ints, 0)) + swapFloat64(&c.count, 0.0)
+	addFloat64(&c.measured, cnt)
 	return []Measurement{{c.id.WithDefaultStat("count"), cnt}}
 }
 
+// Increment adds one to the counter. It doesn't allocate and, unless the
+// counter forwards to a CompositeRegistry, is a single atomic add.
 func (c *Counter) Increment() {
-	addFloat64(&c.count, 1)
+	c.Add(1)
 }
 
+// AddFloat adds delta to the counter. Like in the other spectator clients,
+// counters can't be decremented: negative deltas are dropped and, for
+// counters created by a Registry, counted in spectator.measurements with
+// id=dropped and error=negativeValue.
 func (c *Counter) AddFloat(delta float64) {
 	if delta > 0.0 {
-		addFloat64(&c.count, delta)
+		c.add(delta)
+		for _, f := range c.forward {
+			f.AddFloat(delta)
+		}
+	} else if delta < 0 {
+		c.negative()
+	}
+}
+
+// records that a negative delta was dropped
+func (c *Counter) negative() {
+	if c.onNegative != nil {
+		c.onNegative()
+	}
+	for _, f := range c.forward {
+		f.negative()
 	}
 }
 
+func (c *Counter) add(delta float64) {
+	addFloat64(&c.count, delta)
+}
+
+// Add adds delta to the counter, dropping negative values like AddFloat.
+// Like Increment, it doesn't allocate.
 func (c *Counter) Add(delta int64) {
 	if delta > 0 {
-		addFloat64(&c.count, float64(delta))
+		atomic.AddInt64(&c.ints, delta)
+		for _, f := range c.forward {
+			f.Add(delta)
+		}
+	} else if delta < 0 {
+		c.negative()
 	}
 }
 
+// Count returns the lifetime value of the counter. It is not reset when the
+// counter is measured, though it can briefly miss the delta being measured.
 func (c *Counter) Count() float64 {
-	return loadFloat64(&c.count)
+	return loadFloat64(&c.measured) + float64(atomic.LoadInt64(&c.ints)) + loadFloat64(&c.count)
+}
+
+// AddWithExemplar adds delta to the counter and keeps it as the last
+// exemplar of the counter, replacing the previous one
+func (c *Counter) AddWithExemplar(delta float64, labels map[string]string) {
+	if delta > 0.0 {
+		c.add(delta)
+		c.exemplar.Store(&Exemplar{labels, delta})
+		for _, f := range c.forward {
+			f.AddWithExemplar(delta, labels)
+		}
+	} else if delta < 0 {
+		c.negative()
+	}
+}
+
+// Exemplar returns the last exemplar added to the counter, or nil
+func (c *Counter) Exemplar() *Exemplar {
+	e, _ := c.exemplar.Load().(*Exemplar)
+	return e
 }
@@ -2,7 +2,9 @@ package spectator
 
 import (
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func getCounter(name string) *Counter {
@@ -90,7 +92,124 @@ func TestCounter_Measure(t *testing.T) {
 		t.Error("Expecting a statistic=count tag")
 	}
 
-	if c.Count() != 0 {
-		t.Error("Value should be reset after being measured. Got ", c.Count())
+	if c.Count() != 1 {
+		t.Error("Count should report the lifetime value after being measured. Got ", c.Count())
+	}
+
+	if v := c.Measure()[0].value; v != 0 {
+		t.Error("Delta should be reset after being measured. Got ", v)
+	}
+}
+
+func TestCounter_AddWithExemplar(t *testing.T) {
+	c := NewCounter(NewId("foo", nil))
+	if c.Exemplar() != nil {
+		t.Error("Expected no exemplar")
+	}
+	c.AddWithExemplar(2, map[string]string{"trace_id": "abc"})
+	c.AddWithExemplar(-1, map[string]string{"trace_id": "def"})
+	e := c.Exemplar()
+	if e == nil || e.Value != 2 || e.Labels["trace_id"] != "abc" {
+		t.Errorf("Unexpected exemplar %v", e)
+	}
+	if c.Count() != 2 {
+		t.Errorf("Count should be 2, got %f", c.Count())
+	}
+}
+
+func TestCounter_MixedIncrements(t *testing.T) {
+	c := getCounter("mixed")
+	c.Increment()
+	c.Add(2)
+	c.AddFloat(0.5)
+	assertEqual(t, c.Count(), 3.5, "expected integer and fractional increments to add up")
+	assertEqual(t, c.Measure()[0].value, 3.5, "expected the delta to include both")
+	c.Increment()
+	assertEqual(t, c.Count(), 4.5, "expected the lifetime value to include the measured deltas")
+}
+
+func TestCounter_ZeroAllocs(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	id := NewId("requests", map[string]string{"status": "200"})
+	c := r.CounterWithId(id)
+	checks := map[string]func(){
+		"Increment":               func() { c.Increment() },
+		"Add":                     func() { c.Add(3) },
+		"AddFloat":                func() { c.AddFloat(0.5) },
+		"CounterWithId+Increment": func() { r.CounterWithId(id).Increment() },
+	}
+	for name, f := range checks {
+		if allocs := testing.AllocsPerRun(100, f); allocs != 0 {
+			t.Errorf("Expected %s not to allocate, got %v allocations", name, allocs)
+		}
+	}
+}
+
+// increments racing with measurements are reported exactly once
+func TestCounter_MeasureStress(t *testing.T) {
+	c := getCounter("stress")
+	const writers = 8
+	const increments = 20000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if i%2 == 0 {
+					c.Increment()
+				} else {
+					c.AddFloat(1)
+				}
+			}
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	measured := 0.0
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		measured += c.Measure()[0].Value()
+	}
+
+	assertEqual(t, measured, float64(writers*increments), "expected every increment to be measured once")
+	assertEqual(t, c.Count(), float64(writers*increments), "expected the lifetime count to match")
+}
+
+func TestCounter_NegativeDropped(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	c := r.Counter("c", nil)
+	c.Add(-5)
+	c.AddFloat(-0.5)
+	c.AddWithExemplar(-1, nil)
+	c.Add(0)
+	r.Timer("t", nil).Record(-time.Second)
+	r.DistributionSummary("d", nil).Record(-1)
+
+	assertEqual(t, c.Count(), 0.0, "expected negative deltas to be dropped")
+	dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "negativeValue"})
+	assertEqual(t, dropped.Count(), 5.0, "expected each negative value to be counted")
+	assertEqual(t, r.Timer("t", nil).Count(), int64(0), "expected the negative duration to be dropped")
+	assertEqual(t, r.DistributionSummary("d", nil).Count(), int64(0), "expected the negative amount to be dropped")
+
+	// standalone meters have no registry to count them in
+	NewCounter(NewId("standalone", nil)).Add(-1)
+}
+
+func TestCounter_NegativeDroppedComposite(t *testing.T) {
+	a := NewRegistry(makeConfig(""))
+	b := NewRegistry(makeConfig(""))
+	NewCompositeRegistry(a, b).Counter("c", nil).Add(-1)
+	for _, r := range []*Registry{a, b} {
+		dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "negativeValue"})
+		assertEqual(t, dropped.Count(), 1.0, "expected the child registries to count the negative delta")
 	}
 }
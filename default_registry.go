@@ -0,0 +1,54 @@
+package spectator
+
+import "sync"
+
+var (
+	defaultRegistry      = NewNoopRegistry()
+	defaultRegistryMutex sync.RWMutex
+)
+
+// DefaultRegistry returns the package-level registry, which libraries can use
+// to record metrics without having a Registry injected. Until the application
+// calls SetDefaultRegistry it's a no-op registry, so meters obtained before
+// then are never published.
+func DefaultRegistry() *Registry {
+	defaultRegistryMutex.RLock()
+	defer defaultRegistryMutex.RUnlock()
+	return defaultRegistry
+}
+
+// SetDefaultRegistry replaces the registry returned by DefaultRegistry. It's
+// meant to be called once, early during application startup. A nil registry
+// restores the no-op default.
+func SetDefaultRegistry(r *Registry) {
+	if r == nil {
+		r = NewNoopRegistry()
+	}
+	defaultRegistryMutex.Lock()
+	defer defaultRegistryMutex.Unlock()
+	defaultRegistry = r
+}
+
+// DefaultCounter returns the counter with the given name and tags from the
+// default registry.
+func DefaultCounter(name string, tags map[string]string) *Counter {
+	return DefaultRegistry().Counter(name, tags)
+}
+
+// DefaultTimer returns the timer with the given name and tags from the
+// default registry.
+func DefaultTimer(name string, tags map[string]string) *Timer {
+	return DefaultRegistry().Timer(name, tags)
+}
+
+// DefaultGauge returns the gauge with the given name and tags from the
+// default registry.
+func DefaultGauge(name string, tags map[string]string) *Gauge {
+	return DefaultRegistry().Gauge(name, tags)
+}
+
+// DefaultDistributionSummary returns the distribution summary with the given
+// name and tags from the default registry.
+func DefaultDistributionSummary(name string, tags map[string]string) *DistributionSummary {
+	return DefaultRegistry().DistributionSummary(name, tags)
+}
@@ -0,0 +1,33 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultRegistry(t *testing.T) {
+	defer SetDefaultRegistry(nil)
+
+	// the no-op default accepts updates but doesn't register anything
+	DefaultCounter("foo", nil).Increment()
+	if len(DefaultRegistry().Meters()) != 0 {
+		t.Error("Expected the default registry to be a no-op")
+	}
+
+	r := NewRegistry(config)
+	SetDefaultRegistry(r)
+	if DefaultRegistry() != r {
+		t.Fatal("Expected the default registry to be replaced")
+	}
+	DefaultCounter("foo", nil).Increment()
+	DefaultTimer("bar", nil).Record(time.Second)
+	DefaultGauge("baz", nil).Set(1)
+	DefaultDistributionSummary("qux", nil).Record(10)
+	assertEqual(t, r.Counter("foo", nil).Count(), 1.0, "expected the counter in the registry")
+	assertEqual(t, len(r.Meters()), 4, "expected 4 meters")
+
+	SetDefaultRegistry(nil)
+	if DefaultRegistry() == r {
+		t.Error("Expected a nil registry to restore the default")
+	}
+}
@@ -0,0 +1,121 @@
+package spectator
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// the EC2 instance metadata service, replaced in tests
+	imdsEndpoint = "http://169.254.169.254"
+	// the namespace of the pod, mounted with its service account token
+	k8sNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+)
+
+// limits each request to the instance metadata service, which is not
+// reachable outside of EC2
+const imdsTimeout = 500 * time.Millisecond
+
+// DiscoverCommonTags returns common tags describing where the process runs,
+// to use with WithCommonTags or Config.CommonTags:
+//
+//   - nf.node, nf.zone and nf.region from the EC2 instance metadata service,
+//     using IMDSv2. nf.node is the host name outside of EC2.
+//   - k8s.pod and k8s.namespace in Kubernetes, from the POD_NAME and
+//     POD_NAMESPACE variables set with the downward API, or the host name and
+//     the service account namespace.
+//   - process.name, the name of the executable.
+//
+// Tags that can't be discovered are left out. It returns once done or ctx is
+// done; outside of EC2 it gives up on the metadata service after half a
+// second.
+func DiscoverCommonTags(ctx context.Context) map[string]string {
+	tags := ec2Tags(ctx)
+	hostname, _ := os.Hostname()
+	if tags["nf.node"] == "" && hostname != "" {
+		tags["nf.node"] = hostname
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if pod := firstNonEmpty(os.Getenv("POD_NAME"), hostname); pod != "" {
+			tags["k8s.pod"] = pod
+		}
+		namespace := os.Getenv("POD_NAMESPACE")
+		if namespace == "" {
+			/* #nosec G304 */
+			b, _ := ioutil.ReadFile(k8sNamespaceFile)
+			namespace = strings.TrimSpace(string(b))
+		}
+		if namespace != "" {
+			tags["k8s.namespace"] = namespace
+		}
+	}
+	if len(os.Args) > 0 {
+		tags["process.name"] = filepath.Base(os.Args[0])
+	}
+	for k, v := range tags {
+		tags[k] = normalizeTagString(v, maxValueLength)
+	}
+	return tags
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// returns the instance id, zone and region from the instance metadata
+// service, or no tags outside of EC2
+func ec2Tags(ctx context.Context) map[string]string {
+	tags := map[string]string{}
+	// the metadata service must not be reached through a proxy
+	client := &http.Client{Transport: &http.Transport{}, Timeout: imdsTimeout}
+	token, err := imdsRequest(ctx, client, "PUT", "/latest/api/token", "")
+	if err != nil {
+		return tags
+	}
+	paths := map[string]string{
+		"nf.node":   "/latest/meta-data/instance-id",
+		"nf.zone":   "/latest/meta-data/placement/availability-zone",
+		"nf.region": "/latest/meta-data/placement/region",
+	}
+	for tag, path := range paths {
+		if v, err := imdsRequest(ctx, client, "GET", path, token); err == nil && v != "" {
+			tags[tag] = v
+		}
+	}
+	return tags
+}
+
+func imdsRequest(ctx context.Context, client *http.Client, method string, path string, token string) (string, error) {
+	req, err := http.NewRequest(method, imdsEndpoint+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	if token == "" {
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	} else {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", errors.Errorf("HTTP %d from %s", resp.StatusCode, path)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	return strings.TrimSpace(string(b)), err
+}
@@ -0,0 +1,83 @@
+package spectator
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiscoverCommonTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Write([]byte("token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		case "/latest/meta-data/placement/region":
+			w.Write([]byte("us-east-1"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+	defer func(endpoint string) { imdsEndpoint = endpoint }(imdsEndpoint)
+	imdsEndpoint = server.URL
+
+	dir, err := ioutil.TempDir("", "spectator-k8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(file string) { k8sNamespaceFile = file }(k8sNamespaceFile)
+	k8sNamespaceFile = filepath.Join(dir, "namespace")
+	if err := ioutil.WriteFile(k8sNamespaceFile, []byte("spinnaker\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(t, map[string]string{"KUBERNETES_SERVICE_HOST": "10.0.0.1", "POD_NAME": "clouddriver-abc"})()
+
+	tags := DiscoverCommonTags(context.Background())
+	expected := map[string]string{
+		"nf.node":       "i-1234",
+		"nf.zone":       "us-east-1a",
+		"nf.region":     "us-east-1",
+		"k8s.pod":       "clouddriver-abc",
+		"k8s.namespace": "spinnaker",
+		"process.name":  normalizeTagString(filepath.Base(os.Args[0]), maxValueLength),
+	}
+	for k, v := range expected {
+		assertEqual(t, tags[k], v, "unexpected "+k)
+	}
+	assertEqual(t, len(tags), len(expected), "unexpected tags")
+}
+
+func TestDiscoverCommonTags_NotEC2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	}))
+	defer server.Close()
+	defer func(endpoint string) { imdsEndpoint = endpoint }(imdsEndpoint)
+	imdsEndpoint = server.URL
+
+	tags := DiscoverCommonTags(context.Background())
+	hostname, _ := os.Hostname()
+	assertEqual(t, tags["nf.node"], normalizeTagString(hostname, maxValueLength), "expected the host name")
+	if _, ok := tags["nf.region"]; ok {
+		t.Errorf("Expected no region outside of EC2, got %v", tags)
+	}
+}
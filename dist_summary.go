@@ -1,31 +1,85 @@
 package spectator
 
 import (
+	"math"
 	"sync/atomic"
 )
 
+// sentinel for a min statistic with no values recorded
+const noMin = math.MaxInt64
+
+// returns the min statistic scaled by the given factor, or NaN if nothing was recorded
+func minValue(min int64, scale float64) float64 {
+	if min == noMin {
+		return math.NaN()
+	}
+	return float64(min) / scale
+}
+
+// DistributionSummary records the distribution of amounts, e.g. response
+// sizes. Like for Timer, the total amount saturates at math.MaxInt64 and the
+// total of squares is kept as a float64.
 type DistributionSummary struct {
 	id          *Id
 	count       int64
 	totalAmount int64
 	totalSqBits uint64
 	max         int64
+	min         int64
+	trackMin    int32
+	// the summaries of the child registries of a CompositeRegistry
+	forward []*DistributionSummary
+	// called when a negative amount is dropped, set by the registry
+	onNegative func()
 }
 
 func NewDistributionSummary(id *Id) *DistributionSummary {
-	return &DistributionSummary{id, 0, 0, 0, 0}
+	return &DistributionSummary{id, 0, 0, 0, 0, noMin, 0, nil, nil}
+}
+
+// TrackMin enables the min statistic, the smallest amount recorded during
+// each interval. The aggregator has no min operation, so the min is
+// published as a gauge with the max op: it's the min of a single instance,
+// and aggregating it across instances, e.g. in a graph without a group by
+// nf.node, gives the largest of the per-instance mins rather than the
+// overall min.
+func (d *DistributionSummary) TrackMin() *DistributionSummary {
+	atomic.StoreInt32(&d.trackMin, 1)
+	for _, f := range d.forward {
+		f.TrackMin()
+	}
+	return d
 }
 
 func (d *DistributionSummary) MeterId() *Id {
 	return d.id
 }
 
+// Record records an amount. Negative amounts are dropped and, for summaries
+// created by a Registry, counted in spectator.measurements with id=dropped
+// and error=negativeValue.
 func (d *DistributionSummary) Record(amount int64) {
-	if amount >= 0 {
-		atomic.AddInt64(&d.count, 1)
-		atomic.AddInt64(&d.totalAmount, amount)
-		addFloat64(&d.totalSqBits, float64(amount)*float64(amount))
-		updateMax(&d.max, amount)
+	if amount < 0 {
+		d.negative()
+		return
+	}
+	atomic.AddInt64(&d.count, 1)
+	addSaturating(&d.totalAmount, amount)
+	addFloat64(&d.totalSqBits, float64(amount)*float64(amount))
+	updateMax(&d.max, amount)
+	updateMin(&d.min, amount)
+	for _, f := range d.forward {
+		f.Record(amount)
+	}
+}
+
+// records that a negative amount was dropped
+func (d *DistributionSummary) negative() {
+	if d.onNegative != nil {
+		d.onNegative()
+	}
+	for _, f := range d.forward {
+		f.negative()
 	}
 }
 
@@ -42,6 +96,10 @@ func (d *DistributionSummary) Measure() []Measurement {
 	tTime := Measurement{d.id.WithStat("totalAmount"), float64(atomic.SwapInt64(&d.totalAmount, 0))}
 	tSq := Measurement{d.id.WithStat("totalOfSquares"), swapFloat64(&d.totalSqBits, 0.0)}
 	mx := Measurement{d.id.WithStat("max"), float64(atomic.SwapInt64(&d.max, 0))}
+	minAmount := atomic.SwapInt64(&d.min, noMin)
 
-	return []Measurement{cnt, tTime, tSq, mx}
+	if atomic.LoadInt32(&d.trackMin) == 0 {
+		return []Measurement{cnt, tTime, tSq, mx}
+	}
+	return []Measurement{cnt, tTime, tSq, mx, {d.id.WithStat("min"), minValue(minAmount, 1)}}
 }
@@ -1,6 +1,7 @@
 package spectator
 
 import (
+	"math"
 	"reflect"
 	"testing"
 )
@@ -83,3 +84,37 @@ func TestDistributionSummary_Measure(t *testing.T) {
 	c.Record(200)
 	assertDistributionSummary(t, c, 2, 300, 100*100+200*200, 200)
 }
+
+func TestDistributionSummary_Min(t *testing.T) {
+	d := getDistributionSummary("min")
+	if len(d.Measure()) != 4 {
+		t.Error("The min statistic should be disabled by default")
+	}
+
+	d.TrackMin()
+	ms := d.Measure()
+	if len(ms) != 5 || !math.IsNaN(ms[4].value) {
+		t.Errorf("Expected a NaN min when nothing was recorded, got %v", ms)
+	}
+
+	d.Record(30)
+	d.Record(10)
+	d.Record(20)
+	ms = d.Measure()
+	if ms[4].id.tags["statistic"] != "min" || ms[4].value != 10 {
+		t.Errorf("Expected min=10, got %v", ms[4])
+	}
+}
+
+func TestDistributionSummary_ExtremeValues(t *testing.T) {
+	d := NewDistributionSummary(NewId("extreme", nil))
+	d.Record(math.MaxInt64)
+	d.Record(math.MaxInt64)
+	ms := d.Measure()
+	assertEqual(t, ms[0].Value(), 2.0, "unexpected count")
+	assertEqual(t, ms[1].Value(), float64(math.MaxInt64), "expected the total amount to saturate")
+	if sq := ms[2].Value(); math.IsInf(sq, 0) || sq <= 0 {
+		t.Errorf("Expected a finite total of squares, got %v", sq)
+	}
+	assertEqual(t, ms[3].Value(), float64(math.MaxInt64), "unexpected max")
+}
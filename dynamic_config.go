@@ -0,0 +1,101 @@
+package spectator
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDynamicConfigInterval = 60 * time.Second
+
+// DynamicConfig is the part of the configuration that can change at runtime,
+// polled from Config.DynamicConfigUri or returned by Config.DynamicConfigFunc.
+// Unset fields leave the current settings unchanged. Like in config files
+// the frequency is in seconds in the JSON document, e.g.
+//
+//	{"enabled": false, "frequency": 60}
+type DynamicConfig struct {
+	// Enabled stops or resumes publishing, on top of Config.IsEnabled
+	Enabled   *bool         `json:"enabled"`
+	Frequency time.Duration `json:"frequency"`
+	// Filters replaces Config.Filters
+	Filters *Filters `json:"filters"`
+}
+
+func (r *Registry) dynamicConfigInterval() time.Duration {
+	if r.config.DynamicConfigInterval > 0 {
+		return r.config.DynamicConfigInterval
+	}
+	return defaultDynamicConfigInterval
+}
+
+// polls the dynamic config until quit is closed
+func (r *Registry) pollDynamicConfig(quit chan struct{}) {
+	ticker := time.NewTicker(r.dynamicConfigInterval())
+	defer ticker.Stop()
+	r.updateDynamicConfig()
+	for {
+		select {
+		case <-ticker.C:
+			r.updateDynamicConfig()
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (r *Registry) fetchDynamicConfig() (*DynamicConfig, error) {
+	if f := r.config.DynamicConfigFunc; f != nil {
+		return f()
+	}
+	status, body, err := r.http.Get(r.config.DynamicConfigUri)
+	if err != nil {
+		return nil, err
+	}
+	if status != 200 {
+		return nil, &httpStatusError{status}
+	}
+	var dc DynamicConfig
+	if err := json.Unmarshal(body, &dc); err != nil {
+		return nil, errors.Wrap(err, "Invalid dynamic config")
+	}
+	dc.Frequency *= time.Second
+	return &dc, nil
+}
+
+func (r *Registry) updateDynamicConfig() {
+	dc, err := r.fetchDynamicConfig()
+	if err != nil {
+		r.config.Log.Warn("Unable to get the dynamic config, keeping the current one", "error", err)
+		return
+	}
+	r.applyDynamicConfig(dc)
+}
+
+func (r *Registry) applyDynamicConfig(dc *DynamicConfig) {
+	if dc == nil {
+		return
+	}
+	if dc.Enabled != nil {
+		var enabled int32
+		if *dc.Enabled {
+			enabled = 1
+		}
+		if atomic.SwapInt32(&r.dynamicEnabled, enabled) != enabled {
+			r.config.Log.Info("Publishing enabled by the dynamic config", "enabled", *dc.Enabled)
+		}
+	}
+	if dc.Filters != nil {
+		if err := r.setFilters(dc.Filters); err != nil {
+			r.config.Log.Warn("Invalid filters in the dynamic config, keeping the current ones", "error", err)
+		}
+	}
+	if dc.Frequency > 0 && dc.Frequency != r.Frequency() {
+		r.config.Log.Info("Changing the frequency from the dynamic config", "frequency", dc.Frequency)
+		if err := r.SetFrequency(dc.Frequency); err != nil {
+			r.config.Log.Error("Unable to change the frequency", "error", err)
+		}
+	}
+}
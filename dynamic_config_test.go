@@ -0,0 +1,56 @@
+package spectator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_updateDynamicConfig(t *testing.T) {
+	doc := `{"enabled": false, "frequency": 60}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(doc))
+	}))
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.DynamicConfigUri = server.URL
+	r := NewRegistry(cfg)
+	r.updateDynamicConfig()
+	assertEqual(t, atomic.LoadInt32(&r.dynamicEnabled), int32(0), "expected publishing to be disabled")
+	assertEqual(t, r.Frequency(), time.Minute, "expected the frequency to change")
+
+	// unset fields are left alone
+	doc = `{"enabled": true}`
+	r.updateDynamicConfig()
+	assertEqual(t, atomic.LoadInt32(&r.dynamicEnabled), int32(1), "expected publishing to be enabled")
+	assertEqual(t, r.Frequency(), time.Minute, "expected the frequency to be kept")
+
+	doc = `not json`
+	r.updateDynamicConfig()
+	assertEqual(t, atomic.LoadInt32(&r.dynamicEnabled), int32(1), "expected an invalid document to be ignored")
+}
+
+func TestRegistry_pollDynamicConfig(t *testing.T) {
+	polled := make(chan struct{}, 1)
+	disabled := false
+	cfg := makeConfig("")
+	cfg.Frequency = time.Hour
+	cfg.DynamicConfigFunc = func() (*DynamicConfig, error) {
+		select {
+		case polled <- struct{}{}:
+		default:
+		}
+		return &DynamicConfig{Enabled: &disabled}, nil
+	}
+	r := NewRegistry(cfg)
+	r.Start()
+	defer r.Stop()
+	select {
+	case <-polled:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the dynamic config to be polled when starting")
+	}
+}
@@ -0,0 +1,59 @@
+package spectator
+
+import (
+	"bytes"
+	"expvar"
+	"math"
+)
+
+// PublishExpvar mirrors the meters of the registry in expvar under name, so
+// they show up in /debug/vars. The variable is a map from each measured id,
+// formatted as name{key=value,...} with the tags sorted by key, to its value
+// during the last publish interval. Common tags are not included. Like
+// expvar.Publish, it panics if name is already in use.
+func PublishExpvar(registry *Registry, name string) {
+	if registry.root != nil {
+		registry = registry.root
+	}
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return expvarValues(registry.lastPublished())
+	}))
+}
+
+func expvarValues(measurements []Measurement) map[string]float64 {
+	values := make(map[string]float64, len(measurements))
+	for _, m := range measurements {
+		// expvar is JSON, which can't represent NaN or infinities
+		if math.IsNaN(m.value) || math.IsInf(m.value, 0) {
+			continue
+		}
+		values[expvarKey(m.id)] = m.value
+	}
+	return values
+}
+
+func expvarKey(id *Id) string {
+	var buf bytes.Buffer
+	buf.WriteString(id.name)
+	buf.WriteByte('{')
+	for i, k := range sortedTagKeys(id.tags) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(id.tags[k])
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// records the measurements of the last publish for PublishExpvar
+func (r *Registry) setLastPublished(measurements []Measurement) {
+	r.published.Store(measurements)
+}
+
+func (r *Registry) lastPublished() []Measurement {
+	measurements, _ := r.published.Load().([]Measurement)
+	return measurements
+}
@@ -0,0 +1,34 @@
+package spectator
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"testing"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	r := NewRegistry(config)
+	PublishExpvar(r, "spectator.test")
+	r.Counter("requests", map[string]string{"status": "2xx"}).Add(3)
+	r.Timer("latency", nil).TrackMin()
+	r.publish()
+
+	var values map[string]float64
+	if err := json.Unmarshal([]byte(expvar.Get("spectator.test").String()), &values); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, values["requests{statistic=count,status=2xx}"], 3.0, "unexpected counter value")
+	if _, exists := values["latency{statistic=min}"]; exists {
+		t.Error("Expected NaN values to be skipped")
+	}
+}
+
+func TestExpvarValues(t *testing.T) {
+	values := expvarValues([]Measurement{
+		NewMeasurement(NewId("a", nil), 1),
+		NewMeasurement(NewId("b", nil), math.Inf(1)),
+	})
+	assertEqual(t, len(values), 1, "expected infinities to be skipped")
+	assertEqual(t, values["a{}"], 1.0, "unexpected value")
+}
@@ -0,0 +1,181 @@
+package spectator
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NameFilter matches meter names or tag keys exactly, by prefix or with
+// regular expressions
+type NameFilter struct {
+	Exact  []string `json:"exact"`
+	Prefix []string `json:"prefix"`
+	Regex  []string `json:"regex"`
+}
+
+// Filters drop meters and tags before publishing, e.g. to block a
+// high-cardinality tag from the config instead of a code change. Meters are
+// published if their name matches AllowMeters, when set, and doesn't match
+// DenyMeters. Tags are kept if their key matches AllowTags, when set, and
+// doesn't match DenyTags; the statistic tag is always kept. Measurements
+// left with the same id once their tags are removed are merged.
+type Filters struct {
+	AllowMeters *NameFilter `json:"allow_meters"`
+	DenyMeters  *NameFilter `json:"deny_meters"`
+	AllowTags   *NameFilter `json:"allow_tags"`
+	DenyTags    *NameFilter `json:"deny_tags"`
+}
+
+type compiledNameFilter struct {
+	exact    map[string]bool
+	prefixes []string
+	regexps  []*regexp.Regexp
+}
+
+func (f *NameFilter) compile() (*compiledNameFilter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	c := &compiledNameFilter{exact: make(map[string]bool, len(f.Exact)), prefixes: f.Prefix}
+	for _, s := range f.Exact {
+		c.exact[s] = true
+	}
+	for _, expr := range f.Regex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid filter regex %q", expr)
+		}
+		c.regexps = append(c.regexps, re)
+	}
+	return c, nil
+}
+
+// a nil filter matches nothing
+func (f *compiledNameFilter) matches(s string) bool {
+	if f == nil {
+		return false
+	}
+	if f.exact[s] {
+		return true
+	}
+	for _, prefix := range f.prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	for _, re := range f.regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+type compiledFilters struct {
+	allowMeters *compiledNameFilter
+	denyMeters  *compiledNameFilter
+	allowTags   *compiledNameFilter
+	denyTags    *compiledNameFilter
+}
+
+func (f *Filters) compile() (*compiledFilters, error) {
+	if f == nil {
+		return nil, nil
+	}
+	c := &compiledFilters{}
+	var err error
+	if c.allowMeters, err = f.AllowMeters.compile(); err != nil {
+		return nil, err
+	}
+	if c.denyMeters, err = f.DenyMeters.compile(); err != nil {
+		return nil, err
+	}
+	if c.allowTags, err = f.AllowTags.compile(); err != nil {
+		return nil, err
+	}
+	if c.denyTags, err = f.DenyTags.compile(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (f *compiledFilters) keepMeter(name string) bool {
+	return (f.allowMeters == nil || f.allowMeters.matches(name)) && !f.denyMeters.matches(name)
+}
+
+func (f *compiledFilters) keepTag(key string) bool {
+	if key == "statistic" {
+		return true
+	}
+	return (f.allowTags == nil || f.allowTags.matches(key)) && !f.denyTags.matches(key)
+}
+
+// returns id without the filtered tags
+func (f *compiledFilters) filterTags(id *Id) *Id {
+	for k := range id.tags {
+		if f.keepTag(k) {
+			continue
+		}
+		tags := make(map[string]string, len(id.tags))
+		for k, v := range id.tags {
+			if f.keepTag(k) {
+				tags[k] = v
+			}
+		}
+		return NewId(id.name, tags)
+	}
+	return id
+}
+
+// returns the measurements that pass the filters, merging those left with
+// the same id
+func (f *compiledFilters) apply(measurements []Measurement) []Measurement {
+	if f == nil {
+		return measurements
+	}
+	filterTags := f.allowTags != nil || f.denyTags != nil
+	filtered := make([]Measurement, 0, len(measurements))
+	index := map[string]int{}
+	for _, m := range measurements {
+		if !f.keepMeter(m.id.name) {
+			continue
+		}
+		if !filterTags {
+			filtered = append(filtered, m)
+			continue
+		}
+		id := f.filterTags(m.id)
+		key := id.mapKey()
+		if i, exists := index[key]; exists {
+			if opFromTags(id.tags) == addOp {
+				filtered[i].value += m.value
+			} else {
+				filtered[i].value = math.Max(filtered[i].value, m.value)
+			}
+			continue
+		}
+		index[key] = len(filtered)
+		filtered = append(filtered, Measurement{id, m.value})
+	}
+	return filtered
+}
+
+// returns the filters currently applied when publishing
+func (r *Registry) currentFilters() *compiledFilters {
+	f, _ := r.filters.Load().(*compiledFilters)
+	return f
+}
+
+// replaces the filters applied when publishing, keeping the current ones if
+// the new ones are invalid
+func (r *Registry) setFilters(filters *Filters) error {
+	c, err := filters.compile()
+	if err != nil {
+		return err
+	}
+	r.filters.Store(c)
+	return nil
+}
@@ -0,0 +1,94 @@
+package spectator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFilters_apply(t *testing.T) {
+	filters, err := (&Filters{
+		DenyMeters: &NameFilter{Exact: []string{"debug.requests"}, Prefix: []string{"tmp."}},
+		DenyTags:   &NameFilter{Regex: []string{"^request[._]?id$"}},
+	}).compile()
+	if err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	measurements := []Measurement{
+		{NewId("requests", map[string]string{"statistic": "count", "requestId": "1", "status": "200"}), 1},
+		{NewId("requests", map[string]string{"statistic": "count", "request.id": "2", "status": "200"}), 2},
+		{NewId("latency", map[string]string{"statistic": "max", "requestid": "1"}), 3},
+		{NewId("latency", map[string]string{"statistic": "max", "requestid": "2"}), 5},
+		{NewId("debug.requests", map[string]string{"statistic": "count"}), 1},
+		{NewId("tmp.size", map[string]string{"statistic": "gauge"}), 1},
+	}
+	filtered := filters.apply(measurements)
+	if len(filtered) != 3 {
+		t.Fatalf("Expected 3 measurements, got %v", filtered)
+	}
+	byKey := map[string]float64{}
+	for _, m := range filtered {
+		byKey[m.id.mapKey()] = m.value
+	}
+	counts := NewId("requests", map[string]string{"statistic": "count", "status": "200"})
+	assertEqual(t, byKey[counts.mapKey()], 2.0, "expected the request.id tag to be dropped")
+	counts = NewId("requests", map[string]string{"statistic": "count", "status": "200", "requestId": "1"})
+	assertEqual(t, byKey[counts.mapKey()], 1.0, "expected the regex to be case sensitive")
+	max := NewId("latency", map[string]string{"statistic": "max"})
+	assertEqual(t, byKey[max.mapKey()], 5.0, "expected the max of the merged gauges")
+
+	allow, _ := (&Filters{AllowMeters: &NameFilter{Prefix: []string{"req"}}, AllowTags: &NameFilter{Exact: []string{"status"}}}).compile()
+	filtered = allow.apply(measurements)
+	if len(filtered) != 1 || filtered[0].value != 3 || len(filtered[0].id.tags) != 2 {
+		t.Errorf("Expected the merged requests counter, got %v", filtered)
+	}
+
+	if _, err := (&Filters{DenyTags: &NameFilter{Regex: []string{"("}}}).compile(); err == nil {
+		t.Error("Expected an error for an invalid regex")
+	}
+}
+
+func TestRegistry_publishFilters(t *testing.T) {
+	var entries []payloadEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries = payloadToEntries(t, readPayload(t, r))
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"filters": {"deny_tags": {"exact": ["requestId"]}}}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	config := makeConfig(server.URL)
+	config.Filters = cfg.Filters
+	r := NewRegistry(config)
+	r.Counter("requests", map[string]string{"requestId": "1"}).Increment()
+	r.Counter("requests", map[string]string{"requestId": "2"}).Increment()
+	r.publish()
+
+	var found bool
+	for _, e := range entries {
+		if e.tags["name"] == "requests" {
+			found = true
+			assertEqual(t, e.value, 2.0, "expected the counters to be merged")
+			if _, ok := e.tags["requestId"]; ok {
+				t.Errorf("Expected the requestId tag to be dropped, got %v", e.tags)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Expected the requests counter to be published, got %v", entries)
+	}
+
+	r.applyDynamicConfig(&DynamicConfig{Filters: &Filters{DenyMeters: &NameFilter{Exact: []string{"requests"}}}})
+	r.Counter("requests", map[string]string{"requestId": "1"}).Increment()
+	entries = nil
+	r.publish()
+	for _, e := range entries {
+		if e.tags["name"] == "requests" {
+			t.Errorf("Expected the dynamic config filters to drop the counter, got %v", e)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package spectator
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const defaultGaugeFuncTimeout = 1 * time.Second
+
+// FuncGauge is a gauge whose value is sampled by calling a function when the
+// registry is measured, instead of being set by the caller.
+type FuncGauge struct {
+	registry *Registry
+	id       *Id
+	valueFn  func() float64
+	// set while a call to valueFn is running
+	inFlight int32
+}
+
+func NewFuncGauge(registry *Registry, id *Id, valueFn func() float64) *FuncGauge {
+	return &FuncGauge{registry: registry, id: id, valueFn: valueFn}
+}
+
+func (g *FuncGauge) MeterId() *Id {
+	return g.id
+}
+
+func (g *FuncGauge) Measure() []Measurement {
+	return []Measurement{{g.id.WithDefaultStat("gauge"), g.Get()}}
+}
+
+func (g *FuncGauge) timeout() time.Duration {
+	if t := g.registry.config.GaugeFuncTimeout; t > 0 {
+		return t
+	}
+	return defaultGaugeFuncTimeout
+}
+
+// Get samples the value of the gauge. If the function does not return within
+// Config.GaugeFuncTimeout, or it panics, NaN is returned so nothing is
+// published. While a call that timed out is still running the function is not
+// called again, and NaN is returned.
+func (g *FuncGauge) Get() float64 {
+	if !atomic.CompareAndSwapInt32(&g.inFlight, 0, 1) {
+		g.registry.config.Log.Debug("Skipping gauge function, the previous call is still running", "id", g.id)
+		return math.NaN()
+	}
+	result := make(chan float64, 1)
+	go func() {
+		defer func() {
+			atomic.StoreInt32(&g.inFlight, 0)
+			if p := recover(); p != nil {
+				g.registry.config.Log.Error("Gauge function panicked", "id", g.id, "panic", p)
+				result <- math.NaN()
+			}
+		}()
+		result <- g.valueFn()
+	}()
+
+	timer := time.NewTimer(g.timeout())
+	defer timer.Stop()
+	select {
+	case v := <-result:
+		return v
+	case <-timer.C:
+		g.registry.config.Log.Error("Timed out sampling gauge function", "id", g.id)
+		return math.NaN()
+	}
+}
@@ -0,0 +1,88 @@
+package spectator
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistry_GaugeFunc(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	queue := []int{1, 2, 3}
+	g := r.GaugeFunc("queue.size", nil, func() float64 {
+		return float64(len(queue))
+	})
+
+	if v := g.Get(); v != 3 {
+		t.Errorf("Expected 3, got %f", v)
+	}
+
+	queue = append(queue, 4)
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 4 {
+		t.Errorf("Expected the value to be sampled at measurement time, got %v", ms)
+	}
+}
+
+func TestFuncGauge_Timeout(t *testing.T) {
+	cfg := makeConfig("http://example.org")
+	cfg.GaugeFuncTimeout = 10 * time.Millisecond
+	r := NewRegistry(cfg)
+	var calls int32
+	g := r.GaugeFunc("slow", nil, func() float64 {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(100 * time.Millisecond)
+		return 1
+	})
+
+	if v := g.Get(); !math.IsNaN(v) {
+		t.Errorf("Expected NaN on timeout, got %f", v)
+	}
+	if ms := r.Measurements(); len(ms) != 0 {
+		t.Errorf("Expected no measurements, got %v", ms)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Expected the function to not be called while the previous call is running, got %d calls", n)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	g.Get()
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected the function to be called once the previous call returned, got %d calls", n)
+	}
+}
+
+func TestFuncGauge_SampledWithoutLock(t *testing.T) {
+	cfg := makeConfig("http://example.org")
+	cfg.GaugeFuncTimeout = time.Second
+	r := NewRegistry(cfg)
+	// creating a meter needs the registry lock
+	r.GaugeFunc("creates.meter", nil, func() float64 {
+		r.Counter("inner", nil)
+		return 1
+	})
+
+	start := time.Now()
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 1 {
+		t.Errorf("Expected the gauge value, got %v", ms)
+	}
+	if !r.Remove("creates.meter", nil) {
+		t.Error("Expected the gauge to be removed")
+	}
+	if elapsed := time.Since(start); elapsed >= cfg.GaugeFuncTimeout {
+		t.Errorf("Expected the gauge to be sampled without waiting for the lock, took %v", elapsed)
+	}
+}
+
+func TestFuncGauge_Panic(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	g := r.GaugeFunc("panic", nil, func() float64 {
+		panic("oops")
+	})
+
+	if v := g.Get(); !math.IsNaN(v) {
+		t.Errorf("Expected NaN on panic, got %f", v)
+	}
+}
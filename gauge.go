@@ -1,14 +1,34 @@
 package spectator
 
-import "math"
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
 
+// Gauge reports the last value it was set to. It is safe for concurrent
+// use: the value is stored and loaded atomically, so concurrent calls to Set
+// never tear the value and the last write wins. A publish that races with Set
+// reports either the previous or the new value.
 type Gauge struct {
-	id        *Id
-	valueBits uint64
+	id          *Id
+	valueBits   uint64
+	clock       Clock
+	ttl         time.Duration
+	lastUpdated int64
+	// the gauges of the child registries of a CompositeRegistry
+	forward []*Gauge
 }
 
 func NewGauge(id *Id) *Gauge {
-	return &Gauge{id, math.Float64bits(math.NaN())}
+	return &Gauge{id, math.Float64bits(math.NaN()), nil, 0, 0, nil}
+}
+
+// NewGaugeWithTTL creates a gauge that keeps reporting its last value on
+// each publish until ttl has elapsed since it was last set. Plain gauges
+// report their value only once.
+func NewGaugeWithTTL(id *Id, clock Clock, ttl time.Duration) *Gauge {
+	return &Gauge{id, math.Float64bits(math.NaN()), clock, ttl, 0, nil}
 }
 
 func (g *Gauge) MeterId() *Id {
@@ -16,13 +36,33 @@ func (g *Gauge) MeterId() *Id {
 }
 
 func (g *Gauge) Measure() []Measurement {
+	if g.ttl > 0 {
+		// loaded before the update time, see Set
+		value := g.Get()
+		if g.clock.Nanos()-atomic.LoadInt64(&g.lastUpdated) >= int64(g.ttl) {
+			value = math.NaN()
+		}
+		return []Measurement{{g.id.WithDefaultStat("gauge"), value}}
+	}
 	return []Measurement{{g.id.WithDefaultStat("gauge"), swapFloat64(&g.valueBits, math.NaN())}}
 }
 
+// Set sets the value of the gauge, replacing any value set since the last
+// publish
 func (g *Gauge) Set(value float64) {
+	if g.ttl > 0 {
+		// stored before the value, so Measure never sees a new value with a
+		// stale update time
+		atomic.StoreInt64(&g.lastUpdated, g.clock.Nanos())
+	}
 	storeFloat64(&g.valueBits, value)
+	for _, f := range g.forward {
+		f.Set(value)
+	}
 }
 
+// Get returns the last value set, or NaN if it was reported by a publish
+// and not set since. Gauges created with a TTL keep their value.
 func (g *Gauge) Get() float64 {
 	return loadFloat64(&g.valueBits)
 }
@@ -3,7 +3,9 @@ package spectator
 import (
 	"math"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func getGauge(name string) *Gauge {
@@ -41,3 +43,80 @@ func TestGauge_Measure(t *testing.T) {
 		t.Error("Gauge values should be reset after being measured, got ", v)
 	}
 }
+
+func TestGauge_TTL(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	r.clock = clock
+	g := r.GaugeWithTTL("g", nil, time.Minute)
+	g.Set(42.0)
+
+	clock.SetFromDuration(30 * time.Second)
+	for i := 0; i < 2; i++ {
+		if v := g.Measure()[0].value; v != 42.0 {
+			t.Errorf("Expected the last value to be reported before the TTL, got %f", v)
+		}
+	}
+
+	clock.SetFromDuration(time.Minute)
+	if v := g.Measure()[0].value; !math.IsNaN(v) {
+		t.Errorf("Expected the gauge to expire after the TTL, got %f", v)
+	}
+
+	g.Set(1.0)
+	if v := g.Measure()[0].value; v != 1.0 {
+		t.Errorf("Expected an updated gauge to be reported again, got %f", v)
+	}
+}
+
+// run with -race: concurrent Sets never tear the value, and the last one wins
+func TestGauge_ConcurrentSet(t *testing.T) {
+	g := getGauge("g")
+	const writers = 8
+	var wg sync.WaitGroup
+	for i := 1; i <= writers; i++ {
+		wg.Add(1)
+		go func(v float64) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				g.Set(v)
+			}
+		}(float64(i))
+	}
+	wg.Wait()
+
+	v := g.Get()
+	if v < 1 || v > writers || v != math.Trunc(v) {
+		t.Errorf("Expected one of the values set, got %v", v)
+	}
+	g.Set(42)
+	assertEqual(t, g.Get(), 42.0, "expected the last write to win")
+}
+
+func TestGauge_ConcurrentSetAndMeasure(t *testing.T) {
+	for _, g := range []*Gauge{getGauge("g"), NewGaugeWithTTL(NewId("ttl", nil), &SystemClock{}, time.Minute)} {
+		var wg sync.WaitGroup
+		stop := make(chan struct{})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+					g.Set(float64(i % 100))
+				}
+			}
+		}()
+		for i := 0; i < 1000; i++ {
+			for _, m := range g.Measure() {
+				if v := m.Value(); !math.IsNaN(v) && (v < 0 || v >= 100) {
+					t.Errorf("Unexpected value %v", v)
+				}
+			}
+		}
+		close(stop)
+		wg.Wait()
+	}
+}
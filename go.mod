@@ -3,6 +3,8 @@ module github.com/armory-io/spectator-go
 go 1.12
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.4.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,49 @@
+package spectator
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// GraphiteHierarchicalNaming flattens an id into a dotted Graphite path: the
+// name followed by key.value for each tag, sorted by key. Dots within tag
+// keys and values are replaced with underscores so each one stays a single
+// path component.
+func GraphiteHierarchicalNaming(id *Id) string {
+	var buf bytes.Buffer
+	buf.WriteString(id.name)
+	for _, k := range sortedTagKeys(id.tags) {
+		buf.WriteString("." + strings.Replace(k, ".", "_", -1))
+		buf.WriteString("." + strings.Replace(id.tags[k], ".", "_", -1))
+	}
+	return buf.String()
+}
+
+// GraphiteTaggedNaming uses the tag support in Graphite 1.1+, name;key=value
+func GraphiteTaggedNaming(id *Id) string {
+	var buf bytes.Buffer
+	buf.WriteString(id.name)
+	for _, k := range sortedTagKeys(id.tags) {
+		buf.WriteString(";" + k + "=" + id.tags[k])
+	}
+	return buf.String()
+}
+
+// newGraphitePublisher returns a publisher using the Carbon plaintext
+// protocol, path value timestamp, with the timestamp in seconds
+func newGraphitePublisher(address string, naming func(*Id) string, clock Clock) (*linePublisher, error) {
+	if naming == nil {
+		naming = GraphiteHierarchicalNaming
+	}
+	return newLinePublisherFor("tcp", address, func(m Measurement, tags map[string]string) []byte {
+		var buf bytes.Buffer
+		buf.WriteString(naming(NewId(m.id.name, tags)))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatFloat(m.value, 'f', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(clock.Now().Unix(), 10))
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}), nil
+}
@@ -0,0 +1,84 @@
+package spectator
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func graphiteServer(t *testing.T) (net.Listener, chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var lines []string
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		sort.Strings(lines)
+		received <- lines
+	}()
+	return listener, received
+}
+
+func TestGraphite_Hierarchical(t *testing.T) {
+	listener, received := graphiteServer(t)
+	defer listener.Close()
+
+	p, err := newGraphitePublisher(listener.Addr().String(), nil, &ManualClock{int64(90 * time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	measurements := []Measurement{
+		NewMeasurement(NewId("requests", map[string]string{"status": "2xx"}).WithStat("count"), 3),
+		NewMeasurement(NewId("temperature", nil).WithStat("gauge"), 21.5),
+	}
+	if _, err := p.send(p.payload(measurements, map[string]string{"nf.app": "test"})); err != nil {
+		t.Fatal(err)
+	}
+	p.conn.Close()
+
+	expected := []string{
+		"requests.nf_app.test.statistic.count.status.2xx 3 90",
+		"temperature.nf_app.test.statistic.gauge 21.5 90",
+	}
+	if lines := <-received; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestGraphite_Tagged(t *testing.T) {
+	id := NewId("requests", map[string]string{"status": "2xx", "statistic": "count"})
+	assertEqual(t, GraphiteTaggedNaming(id), "requests;statistic=count;status=2xx", "unexpected path")
+}
+
+func TestRegistry_publishGraphite(t *testing.T) {
+	listener, received := graphiteServer(t)
+	defer listener.Close()
+
+	cfg := makeConfig("")
+	cfg.GraphiteAddress = listener.Addr().String()
+	cfg.GraphiteNaming = GraphiteTaggedNaming
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+	r.publish()
+	r.agent.conn.Close()
+
+	lines := <-received
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 line, got %v", lines)
+	}
+	assertEqual(t, lines[0][:len("requests;nf.app=test")], "requests;nf.app=test", "unexpected line")
+}
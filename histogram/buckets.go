@@ -1,7 +1,7 @@
 package histogram
 
 import (
-	"github.com/Netflix/spectator-go"
+	"github.com/armory-io/spectator-go"
 	"math"
 	"math/bits"
 )
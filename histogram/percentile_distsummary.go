@@ -2,7 +2,9 @@ package histogram
 
 import (
 	"fmt"
-	"github.com/Netflix/spectator-go"
+	"github.com/armory-io/spectator-go"
+	"github.com/pkg/errors"
+	"math"
 )
 
 var distTagValues []string
@@ -19,26 +21,105 @@ func init() {
 type PercentileDistributionSummary struct {
 	registry *spectator.Registry
 	id       *spectator.Id
+	min      int64
+	max      int64
 	summary  *spectator.DistributionSummary
 	counters []*spectator.Counter
 }
 
+// default min and max amounts we track
+const defaultMinAmount = 0
+const defaultMaxAmount = math.MaxInt64
+
 func NewPercentileDistributionSummary(registry *spectator.Registry, name string, tags map[string]string) *PercentileDistributionSummary {
 	return NewPercentileDistributionSummaryWithId(registry, registry.NewId(name, tags))
 }
 
 func NewPercentileDistributionSummaryWithId(registry *spectator.Registry, id *spectator.Id) *PercentileDistributionSummary {
+	return NewPercentileDistributionSummaryWithIdRange(registry, id, defaultMinAmount, defaultMaxAmount)
+}
+
+type percDistSummaryBuilder struct {
+	registry *spectator.Registry
+	id       *spectator.Id
+	name     string
+	tags     map[string]string
+	min      int64
+	max      int64
+}
+
+func (b *percDistSummaryBuilder) Build() (*PercentileDistributionSummary, error) {
+	if b.registry == nil {
+		return nil, errors.New("Need a registry in order to construct a PercentileDistributionSummary")
+	}
+	if b.id == nil && len(b.name) == 0 {
+		return nil, errors.New("Need a name or id in order to construct a PercentileDistributionSummary")
+	}
+
+	id := b.id
+	if id == nil {
+		id = b.registry.NewId(b.name, b.tags)
+	} else {
+		id = id.WithTags(b.tags)
+	}
+
+	return NewPercentileDistributionSummaryWithIdRange(b.registry, id, b.min, b.max), nil
+}
+
+func PercentileDistributionSummaryBuilder() *percDistSummaryBuilder {
+	return &percDistSummaryBuilder{min: defaultMinAmount, max: defaultMaxAmount}
+}
+
+func (b *percDistSummaryBuilder) Using(registry *spectator.Registry) *percDistSummaryBuilder {
+	b.registry = registry
+	return b
+}
+
+func (b *percDistSummaryBuilder) WithId(id *spectator.Id) *percDistSummaryBuilder {
+	b.id = id
+	return b
+}
+
+func (b *percDistSummaryBuilder) WithName(name string) *percDistSummaryBuilder {
+	b.name = name
+	return b
+}
+
+func (b *percDistSummaryBuilder) WithTags(tags map[string]string) *percDistSummaryBuilder {
+	b.tags = tags
+	return b
+}
+
+func (b *percDistSummaryBuilder) WithRange(min int64, max int64) *percDistSummaryBuilder {
+	b.min = min
+	b.max = max
+	return b
+}
+
+func NewPercentileDistributionSummaryWithIdRange(registry *spectator.Registry, id *spectator.Id,
+	min int64, max int64) *PercentileDistributionSummary {
 	ds := registry.DistributionSummaryWithId(id)
 	var counters = make([]*spectator.Counter, PercentileBucketsLength())
 	for i := 0; i < PercentileBucketsLength(); i++ {
 		counters[i] = counterFor(registry, id, i, distTagValues)
 	}
-	return &PercentileDistributionSummary{registry: registry, id: id, summary: ds, counters: counters}
+	return &PercentileDistributionSummary{registry: registry, id: id, min: min, max: max, summary: ds, counters: counters}
+}
+
+func restrictAmount(amount int64, min int64, max int64) int64 {
+	r := amount
+	if r > max {
+		r = max
+	} else if r < min {
+		r = min
+	}
+	return r
 }
 
 func (t *PercentileDistributionSummary) Record(amount int64) {
 	t.summary.Record(amount)
-	t.counters[PercentileBucketsIndex(amount)].Increment()
+	restricted := restrictAmount(amount, t.min, t.max)
+	t.counters[PercentileBucketsIndex(restricted)].Increment()
 }
 
 func (t *PercentileDistributionSummary) Count() int64 {
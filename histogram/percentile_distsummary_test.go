@@ -1,7 +1,7 @@
 package histogram
 
 import (
-	"github.com/Netflix/spectator-go"
+	"github.com/armory-io/spectator-go"
 	"math"
 	"reflect"
 	"testing"
@@ -82,3 +82,47 @@ func TestPercentileDistributionSummary_Percentile(t *testing.T) {
 
 	checkPercentilesDs(t, ds)
 }
+
+func TestPercentileDistributionSummary_Range(t *testing.T) {
+	r := spectator.NewRegistry(config)
+	ds, err := PercentileDistributionSummaryBuilder().Using(r).WithName("ds").WithRange(100, 2000).Build()
+	if err != nil {
+		t.Fatalf("should succeed")
+	}
+
+	ds.Record(10)   // restricted to 100 = 0x19
+	ds.Record(3000) // restricted to 2000 = 0x2C
+
+	measurementMap := measurementsToMap(r.Measurements())
+	if measurementMap["ds|percentile|D0019"] != 1 || measurementMap["ds|percentile|D002C"] != 1 {
+		t.Errorf("Expected amounts to be restricted to the range, got %v", measurementMap)
+	}
+	if measurementMap["ds|max"] != 3000 {
+		t.Errorf("The distribution summary should record the unrestricted amount, got %v", measurementMap["ds|max"])
+	}
+}
+
+func TestPercentileDistributionSummaryBuilder(t *testing.T) {
+	r := spectator.NewRegistry(config)
+
+	_, err := PercentileDistributionSummaryBuilder().Using(r).Build()
+	if err == nil {
+		t.Errorf("should fail if name/id are missing")
+	}
+
+	_, err = PercentileDistributionSummaryBuilder().WithName("foo").Build()
+	if err == nil {
+		t.Errorf("should fail if registry is missing")
+	}
+
+	tags := map[string]string{"foo": "bar", "k": "v"}
+	id := r.NewId("foo", map[string]string{})
+	p, err := PercentileDistributionSummaryBuilder().WithId(id).WithTags(tags).Using(r).Build()
+	if err != nil {
+		t.Fatalf("should succeed")
+	}
+
+	if !reflect.DeepEqual(p.id.Tags(), tags) {
+		t.Errorf("Expected extra tags %v, got %v", tags, p.id.Tags())
+	}
+}
@@ -2,7 +2,7 @@ package histogram
 
 import (
 	"fmt"
-	"github.com/Netflix/spectator-go"
+	"github.com/armory-io/spectator-go"
 	"github.com/pkg/errors"
 	"time"
 )
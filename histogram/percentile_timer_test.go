@@ -2,9 +2,11 @@ package histogram
 
 import (
 	"fmt"
-	"github.com/Netflix/spectator-go"
+	"github.com/armory-io/spectator-go"
 	"math"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -196,3 +198,32 @@ func TestPercentileTimerBuilder_IdTags(t *testing.T) {
 		t.Errorf("Expected extra tags %v, got %v", tags, p.id.Tags())
 	}
 }
+
+func TestPercentileTimer_Prometheus(t *testing.T) {
+	r := spectator.NewRegistry(makeConfig(""))
+	timer := NewPercentileTimer(r, "latency", nil)
+	r.Start()
+	timer.Record(2 * time.Second)
+	r.Stop()
+
+	w := httptest.NewRecorder()
+	spectator.PrometheusHandler(r)(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	tags := `nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1"`
+	expected := []string{
+		"# TYPE latency summary\n",
+		"latency_count{" + tags + "} 1\n",
+		"latency_sum{" + tags + "} 2\n",
+		"# TYPE latency_percentile_total counter\n",
+		"latency_percentile_total{" + tags + `,percentile="T0086"} 1` + "\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+	if strings.Count(body, "# TYPE latency ") != 1 {
+		t.Errorf("Expected a single latency family, got:\n%s", body)
+	}
+}
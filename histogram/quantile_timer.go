@@ -0,0 +1,127 @@
+package histogram
+
+import (
+	"github.com/armory-io/spectator-go"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// default quantiles reported by a QuantileTimer
+var defaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// QuantileTimer is a timer that keeps a log-linear (HDR style) histogram of
+// the durations recorded during each interval, using the same buckets as the
+// percentile meters, and reports the requested quantiles when measured.
+// Unlike PercentileTimer the quantiles are computed locally, so they're
+// available through the HttpHandler and Prometheus exports. The relative
+// error of the reported quantiles is bounded by the bucket width.
+type QuantileTimer struct {
+	id        *spectator.Id
+	timer     *spectator.Timer
+	quantiles []float64
+	tagValues []string
+	mutex     *sync.Mutex
+	counts    []int64
+}
+
+func NewQuantileTimer(registry *spectator.Registry, name string, tags map[string]string, quantiles ...float64) *QuantileTimer {
+	return NewQuantileTimerWithId(registry, registry.NewId(name, tags), quantiles...)
+}
+
+func NewQuantileTimerWithId(registry *spectator.Registry, id *spectator.Id, quantiles ...float64) *QuantileTimer {
+	m := registry.NewMeter(id, func() spectator.Meter {
+		return newQuantileTimer(id, quantiles)
+	})
+
+	t, ok := m.(*QuantileTimer)
+	if ok {
+		return t
+	}
+
+	// a meter of a different type is registered with this id
+	return newQuantileTimer(id, quantiles)
+}
+
+func newQuantileTimer(id *spectator.Id, quantiles []float64) *QuantileTimer {
+	if len(quantiles) == 0 {
+		quantiles = defaultQuantiles
+	}
+	tagValues := make([]string, len(quantiles))
+	for i, q := range quantiles {
+		tagValues[i] = strconv.FormatFloat(q, 'f', -1, 64)
+	}
+	return &QuantileTimer{
+		id:        id,
+		timer:     spectator.NewTimer(id),
+		quantiles: quantiles,
+		tagValues: tagValues,
+		mutex:     &sync.Mutex{},
+		counts:    make([]int64, PercentileBucketsLength()),
+	}
+}
+
+func (t *QuantileTimer) MeterId() *spectator.Id {
+	return t.id
+}
+
+func (t *QuantileTimer) Record(amount time.Duration) {
+	if amount < 0 {
+		return
+	}
+	t.timer.Record(amount)
+	t.mutex.Lock()
+	t.counts[PercentileBucketsIndex(amount.Nanoseconds())]++
+	t.mutex.Unlock()
+}
+
+func (t *QuantileTimer) Count() int64 {
+	return t.timer.Count()
+}
+
+func (t *QuantileTimer) TotalTime() time.Duration {
+	return t.timer.TotalTime()
+}
+
+func pcts(quantiles []float64) []float64 {
+	result := make([]float64, len(quantiles))
+	for i, q := range quantiles {
+		result[i] = q * 100
+	}
+	return result
+}
+
+// Quantile returns the estimated quantile (between 0 and 1) in seconds for
+// the durations recorded since the timer was last measured
+func (t *QuantileTimer) Quantile(q float64) float64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return PercentileBucketsPercentile(t.counts, q*100) / 1e9
+}
+
+// Measure returns the timer statistics plus one statistic=quantile
+// measurement, in seconds, per configured quantile. The histogram is reset
+// after being measured.
+func (t *QuantileTimer) Measure() []spectator.Measurement {
+	ms := t.timer.Measure()
+
+	t.mutex.Lock()
+	counts := t.counts
+	t.counts = make([]int64, PercentileBucketsLength())
+	t.mutex.Unlock()
+
+	var total int64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return ms
+	}
+
+	values := PercentileBucketsPercentiles(counts, pcts(t.quantiles))
+	for i, v := range values {
+		id := t.id.WithStat("quantile").WithTag("quantile", t.tagValues[i])
+		ms = append(ms, spectator.NewMeasurement(id, v/1e9))
+	}
+	return ms
+}
@@ -0,0 +1,69 @@
+package histogram
+
+import (
+	"github.com/armory-io/spectator-go"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantileTimer_Measure(t *testing.T) {
+	r := spectator.NewRegistry(config)
+	timer := NewQuantileTimer(r, "latency", nil, 0.5, 0.99)
+	for i := 1; i <= 1000; i++ {
+		timer.Record(time.Duration(i) * time.Millisecond)
+	}
+
+	if v := timer.Quantile(0.5); math.Abs(v-0.5) > 0.05 {
+		t.Errorf("Expected p50 near 0.5s, got %f", v)
+	}
+
+	var p50, p99 float64
+	for _, m := range r.Measurements() {
+		tags := m.Id().Tags()
+		switch {
+		case tags["statistic"] == "count" && m.Value() != 1000:
+			t.Errorf("Expected count = 1000, got %f", m.Value())
+		case tags["quantile"] == "0.5":
+			p50 = m.Value()
+		case tags["quantile"] == "0.99":
+			p99 = m.Value()
+		}
+	}
+	if math.Abs(p50-0.5) > 0.05 {
+		t.Errorf("Expected p50 near 0.5s, got %f", p50)
+	}
+	if math.Abs(p99-0.99) > 0.1 {
+		t.Errorf("Expected p99 near 0.99s, got %f", p99)
+	}
+
+	// histogram is reset after being measured
+	for _, m := range r.Measurements() {
+		if m.Id().Tags()["statistic"] == "quantile" {
+			t.Errorf("Unexpected quantile after reset: %v", m)
+		}
+	}
+
+	if NewQuantileTimer(r, "latency", nil) != timer {
+		t.Error("Expected the registered timer to be returned")
+	}
+}
+
+func TestQuantileTimer_Prometheus(t *testing.T) {
+	r := spectator.NewRegistry(config)
+	timer := NewQuantileTimer(r, "latency", nil)
+	timer.Record(100 * time.Millisecond)
+
+	// with no uri the registry publishes internally, updating the export
+	r.Start()
+	r.Stop()
+
+	w := httptest.NewRecorder()
+	spectator.PrometheusHandler(r)(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, `latency{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1",quantile="0.99"}`) {
+		t.Errorf("Expected a quantile series, got:\n%s", body)
+	}
+}
@@ -3,12 +3,16 @@ package spectator
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,10 +21,71 @@ import (
 type HttpClient struct {
 	registry *Registry
 	timeout  time.Duration
+	// the transport for http and https uris
+	transport *http.Transport
+	// transports for unix:// uris by socket path, so connections are reused
+	unixTransports map[string]*http.Transport
+	mutex          sync.Mutex
 }
 
 func NewHttpClient(registry *Registry, timeout time.Duration) *HttpClient {
-	return &HttpClient{registry, timeout}
+	transport, err := newTransport(registry.config)
+	if err != nil {
+		registry.config.Log.Error("Invalid HTTP transport configuration", "error", err)
+	}
+	return &HttpClient{
+		registry:       registry,
+		timeout:        timeout,
+		transport:      transport,
+		unixTransports: map[string]*http.Transport{},
+	}
+}
+
+// resolves unix:///path/to/socket uris, optionally with a path query
+// parameter for the request path, / by default, to an http uri and a
+// transport dialing the socket. Other uris use the shared transport.
+func (h *HttpClient) target(uri string) (string, http.RoundTripper, error) {
+	if !strings.HasPrefix(uri, "unix://") {
+		if t := h.registry.config.Transport; t != nil {
+			return uri, t, nil
+		}
+		return uri, h.transport, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", nil, err
+	}
+	socket := u.Path
+	if socket == "" {
+		return "", nil, errors.Errorf("Missing the socket path in %s", uri)
+	}
+	path := u.Query().Get("path")
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	transport, exists := h.unixTransports[socket]
+	if !exists {
+		transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				d := net.Dialer{Timeout: connectTimeout(h.registry.config)}
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		h.unixTransports[socket] = transport
+	}
+	return "http://unix" + path, transport, nil
+}
+
+func (h *HttpClient) closeIdleConnections() {
+	h.transport.CloseIdleConnections()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, t := range h.unixTransports {
+		t.CloseIdleConnections()
+	}
 }
 
 func userFriendlyErr(errStr string) string {
@@ -31,57 +96,147 @@ func userFriendlyErr(errStr string) string {
 	return "HttpErr"
 }
 
-func (h *HttpClient) createPayloadRequest(uri string, jsonBytes []byte) (*http.Request, error) {
-	const JsonType = "application/json"
-	const CompressThreshold = 512
-	compressed := len(jsonBytes) > CompressThreshold
+const jsonContentType = "application/json"
+
+// bodies up to this size are sent uncompressed
+const compressThreshold = 512
+
+// gzip writers are expensive to create, reuse them across requests
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+
+func (h *HttpClient) createPayloadRequest(uri string, contentType string, body []byte) (*http.Request, error) {
+	compressed := h.compresses(body)
 	var payloadBuffer *bytes.Buffer
 	if compressed {
 		payloadBuffer = &bytes.Buffer{}
-		g := gzip.NewWriter(payloadBuffer)
-		if _, err := g.Write(jsonBytes); err != nil {
-			return nil, errors.Wrap(err, "Unable to compress json payload")
+		g := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(g)
+		g.Reset(payloadBuffer)
+		if _, err := g.Write(body); err != nil {
+			return nil, errors.Wrap(err, "Unable to compress payload")
 		}
 		if err := g.Close(); err != nil {
 			return nil, errors.Wrap(err, "Unable to close gzip stream")
 		}
 	} else {
-		payloadBuffer = bytes.NewBuffer(jsonBytes)
+		payloadBuffer = bytes.NewBuffer(body)
 	}
 
-	req, err := http.NewRequest("POST", uri, payloadBuffer)
+	req, err := h.newRequest("POST", uri, payloadBuffer)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("User-Agent", "spectator-go")
-	req.Header.Set("Accept", JsonType)
-	req.Header.Set("Content-Type", JsonType)
+	req.Header.Set("Accept", contentType)
+	req.Header.Set("Content-Type", contentType)
 	if compressed {
 		req.Header.Set("Content-Encoding", "gzip")
 	}
 	return req, nil
 }
 
+// returns a request with the configured headers
+func (h *HttpClient) newRequest(method string, uri string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.registry.config.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("User-Agent", "spectator-go")
+	return req, nil
+}
+
+func (h *HttpClient) compressionEnabled() bool {
+	enabled := h.registry.config.CompressionEnabled
+	return enabled == nil || *enabled
+}
+
+// returns whether the body is compressed when posted. The request then reads
+// from a compressed copy, so the body can be reused once the post returns.
+func (h *HttpClient) compresses(body []byte) bool {
+	return h.compressionEnabled() && len(body) > compressThreshold
+}
+
 func (h *HttpClient) PostJson(uri string, jsonBytes []byte) (statusCode int, err error) {
+	statusCode, _, err = h.Post(uri, jsonContentType, jsonBytes)
+	return
+}
+
+// Post sends body with the given content type, compressing it if it's large,
+// and returns the status and body of the response
+func (h *HttpClient) Post(uri string, contentType string, body []byte) (statusCode int, respBody []byte, err error) {
+	return h.post(context.Background(), uri, contentType, body)
+}
+
+// posts like Post, cancelling the request when ctx is done
+func (h *HttpClient) post(ctx context.Context, uri string, contentType string, body []byte) (statusCode int, respBody []byte, err error) {
+	h.registry.config.Log.Debug("Posting data", "uri", uri, "bytes", len(body))
+	return h.do(ctx, "POST", uri, func(requestUri string) (*http.Request, error) {
+		return h.createPayloadRequest(requestUri, contentType, body)
+	})
+}
+
+// Get fetches a JSON document, e.g. the DynamicConfig, and returns the
+// status and body of the response
+func (h *HttpClient) Get(uri string) (statusCode int, respBody []byte, err error) {
+	return h.do(context.Background(), "GET", uri, func(requestUri string) (*http.Request, error) {
+		req, err := h.newRequest("GET", requestUri, nil)
+		if err == nil {
+			req.Header.Set("Accept", jsonContentType)
+		}
+		return req, err
+	})
+}
+
+// sends the request built by newRequest for the resolved uri, and records
+// it in the http.req.complete timer
+func (h *HttpClient) do(ctx context.Context, method string, uri string, newRequest func(requestUri string) (*http.Request, error)) (statusCode int, respBody []byte, err error) {
 	statusCode = 400
 	log := h.registry.config.Log
+	requestUri, transport, err := h.target(uri)
+	if err != nil {
+		log.Error("Invalid uri", "uri", uri, "error", err)
+		return
+	}
 	var req *http.Request
-	req, err = h.createPayloadRequest(uri, jsonBytes)
+	req, err = newRequest(requestUri)
 	if err != nil {
 		panic(err)
 	}
-	client := http.Client{}
-	client.Timeout = h.timeout
+	req = req.WithContext(ctx)
+	if auth := h.registry.config.AuthProvider; auth != nil {
+		var name, value string
+		name, value, err = auth()
+		if err != nil {
+			log.Error("Unable to get the credentials", "method", method, "uri", uri, "error", err)
+			return
+		}
+		req.Header.Set(name, value)
+	}
+	client := http.Client{Transport: transport}
+	if c := h.registry.config.HTTPClient; c != nil {
+		client = *c
+		if strings.HasPrefix(uri, "unix://") {
+			client.Transport = transport
+		}
+	}
+	if client.Timeout == 0 {
+		client.Timeout = h.timeout
+	}
 
 	tags := map[string]string{
 		"client": "spectator-go",
-		"method": "POST",
+		"method": method,
 		"mode":   "http-client",
 	}
 
 	clock := h.registry.clock
 	start := clock.Now()
-	log.Debugf("posting data to %s, payload %d bytes", uri, len(jsonBytes))
 	resp, err := client.Do(req)
 	if err != nil {
 		if urlerr, ok := err.(*url.Error); ok {
@@ -96,23 +251,22 @@ func (h *HttpClient) PostJson(uri string, jsonBytes []byte) (statusCode int, err
 			tags["status"] = err.Error()
 		}
 		tags["statusCode"] = tags["status"]
-		log.Errorf("Unable to POST to %s: %v", uri, err)
+		log.Debug("Request failed", "method", method, "uri", uri, "error", err)
 	} else {
 		defer func() {
 			if err = resp.Body.Close(); err != nil {
-				log.Errorf("Unable to close body: %v", err)
+				log.Error("Unable to close body", "error", err)
 			}
 		}()
 		statusCode = resp.StatusCode
 		tags["statusCode"] = strconv.Itoa(resp.StatusCode)
 		tags["status"] = fmt.Sprintf("%dxx", resp.StatusCode/100)
-		var body []byte
-		body, err = ioutil.ReadAll(resp.Body)
+		respBody, err = ioutil.ReadAll(resp.Body)
 		if err != nil {
-			log.Errorf("Unable to read response body: %v", err)
+			log.Error("Unable to read response body", "error", err)
 			return
 		}
-		log.Debugf("response HTTP %d: %s", resp.StatusCode, body)
+		log.Debug("Got response", "status", resp.StatusCode, "body", string(respBody))
 	}
 	elapsed := clock.Now().Sub(start)
 	h.registry.Timer("http.req.complete", tags).Record(elapsed)
@@ -2,11 +2,17 @@ package spectator
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -74,7 +80,7 @@ func TestHttpClient_PostJsonOk(t *testing.T) {
 	expectedId := NewId("http.req.complete", expectedTags)
 	gotMeter := meters[0]
 	if expectedId.name != gotMeter.MeterId().name || !reflect.DeepEqual(expectedTags, gotMeter.MeterId().tags) {
-		log.Errorf("Unexpected meter registered. Expecting %v. Got %v", expectedId, gotMeter.MeterId())
+		log.Error("Unexpected meter registered", "expected", expectedId, "got", gotMeter.MeterId())
 	}
 
 	assertTimer(t, gotMeter.(*Timer), 1, 1000, 1000*1000.0, 1000)
@@ -124,10 +130,120 @@ func TestHttpClient_PostJsonTimeout(t *testing.T) {
 	expectedId := NewId("http.req.complete", expectedTags)
 	gotMeter := meters[0]
 	if expectedId.name != gotMeter.MeterId().name || !reflect.DeepEqual(expectedTags, gotMeter.MeterId().tags) {
-		log.Errorf("Unexpected meter registered. Expecting %v. Got %v", expectedId, gotMeter.MeterId())
+		log.Error("Unexpected meter registered", "expected", expectedId, "got", gotMeter.MeterId())
 	}
 
 	total := int64(Timeout + 1)
 	totalSq := float64(total) * float64(total)
 	assertTimer(t, gotMeter.(*Timer), 1, total, totalSq, total)
 }
+
+func TestHttpClient_Compression(t *testing.T) {
+	var encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	config := makeConfig(server.URL)
+	registry := NewRegistry(config)
+	client := NewHttpClient(registry, time.Second)
+	large := []byte("[" + strings.Repeat("1,", 512) + "1]")
+
+	client.PostJson(config.Uri, large)
+	assertEqual(t, encoding, "gzip", "expected large bodies to be compressed by default")
+	client.PostJson(config.Uri, []byte("42"))
+	assertEqual(t, encoding, "", "expected small bodies not to be compressed")
+
+	disabled := false
+	config.CompressionEnabled = &disabled
+	client.PostJson(config.Uri, large)
+	assertEqual(t, encoding, "", "expected no compression when disabled")
+}
+
+func TestHttpClient_UnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("Unix sockets are not supported", err)
+	}
+	var path string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write(okMsg)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := NewHttpClient(NewRegistry(makeConfig("")), time.Second)
+	status, err := client.PostJson("unix://"+socket+"?path=/api/v1/publish", []byte("42"))
+	if err != nil || status != 200 {
+		t.Fatalf("Expected the post to succeed, got %d %v", status, err)
+	}
+	assertEqual(t, path, "/api/v1/publish", "unexpected request path")
+
+	client.PostJson("unix://"+socket, []byte("42"))
+	assertEqual(t, path, "/", "expected / by default")
+}
+
+func TestHttpClient_AuthProvider(t *testing.T) {
+	var auth string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		auth = r.Header.Get("Authorization")
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	config := makeConfig(server.URL)
+	token := 0
+	config.AuthProvider = func() (string, string, error) {
+		token++
+		if token > 2 {
+			return "", "", errors.New("token endpoint unavailable")
+		}
+		return "Authorization", fmt.Sprintf("Bearer token-%d", token), nil
+	}
+	client := NewHttpClient(NewRegistry(config), time.Second)
+
+	client.PostJson(config.Uri, []byte("42"))
+	assertEqual(t, auth, "Bearer token-1", "unexpected authorization")
+	client.PostJson(config.Uri, []byte("42"))
+	assertEqual(t, auth, "Bearer token-2", "expected a refreshed token on each request")
+
+	if _, err := client.PostJson(config.Uri, []byte("42")); err == nil {
+		t.Error("Expected an error when the credentials are unavailable")
+	}
+	assertEqual(t, requests, 2, "expected no request without credentials")
+}
+
+func TestHttpClient_Headers(t *testing.T) {
+	var header http.Header
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		host = r.Host
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	config := makeConfig(server.URL)
+	config.Headers = map[string]string{
+		"X-Org-Id":     "42",
+		"Host":         "atlas.example.org",
+		"Content-Type": "text/plain",
+	}
+	client := NewHttpClient(NewRegistry(config), time.Second)
+	client.PostJson(config.Uri, []byte("42"))
+
+	assertEqual(t, header.Get("X-Org-Id"), "42", "expected the custom header")
+	assertEqual(t, host, "atlas.example.org", "expected the host to be overridden")
+	assertEqual(t, header.Get("Content-Type"), "application/json", "expected the content type to be kept")
+}
@@ -11,8 +11,8 @@ type Tag struct {
 }
 
 type Value struct {
-	V int   `json:"v"`
-	T int64 `json:"t"`
+	V float64 `json:"v"`
+	T int64   `json:"t"`
 }
 
 type TopValue struct {
@@ -25,8 +25,15 @@ type Metric struct {
 	Values []TopValue `json:"values"`
 }
 
+// HttpHandler exposes the data returned by GetExport as JSON. Clients that
+// prefer OpenMetrics in the Accept header get the PrometheusHandler output
+// instead.
 func HttpHandler(registry *Registry) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if acceptsOpenMetrics(r) {
+			writePrometheus(w, registry, true)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 		payload := registry.GetExport()
 		b, _ := json.Marshal(payload)
@@ -6,18 +6,27 @@ import (
 	"sort"
 )
 
+// Id identifies a meter by its name and tags. Ids are immutable, and NewId
+// precomputes their map key and its hash, so code on a hot path can create an
+// Id once and pass it to the *WithId methods of the registry on each call
+// instead of rebuilding and hashing the tags every time.
 type Id struct {
 	name string
 	tags map[string]string
 	key  string
+	hash uint32
 }
 
-// computes and saves a key to be used to address Ids in maps
+// returns the key used to address Ids in maps. Ids created by NewId compute
+// it upfront so they can be shared by goroutines without synchronization.
 func (id *Id) mapKey() string {
 	if len(id.key) > 0 {
 		return id.key
 	}
+	return id.computeKey()
+}
 
+func (id *Id) computeKey() string {
 	var buf bytes.Buffer
 	_, err := buf.WriteString(id.name)
 	const errKey = "ERR"
@@ -49,8 +58,25 @@ func (id *Id) mapKey() string {
 			return errKey
 		}
 	}
-	id.key = buf.String()
-	return id.key
+	return buf.String()
+}
+
+// returns the hash of the map key
+func (id *Id) mapHash() uint32 {
+	if id.hash != 0 {
+		return id.hash
+	}
+	return hashKey(id.mapKey())
+}
+
+// returns the FNV-1a hash of a map key
+func hashKey(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	return hash
 }
 
 func NewId(name string, tags map[string]string) *Id {
@@ -58,7 +84,10 @@ func NewId(name string, tags map[string]string) *Id {
 	for k, v := range tags {
 		myTags[k] = v
 	}
-	return &Id{name, myTags, ""}
+	id := &Id{name: name, tags: myTags}
+	id.key = id.computeKey()
+	id.hash = hashKey(id.key)
+	return id
 }
 
 func (id *Id) WithTag(key string, value string) *Id {
@@ -14,7 +14,7 @@ func TestId_mapKey(t *testing.T) {
 		t.Error("Expected foo, got", k)
 	}
 
-	reusesKey := Id{"foo", nil, "bar"}
+	reusesKey := Id{name: "foo", key: "bar"}
 	k2 := reusesKey.mapKey()
 	if k2 != "bar" {
 		t.Error("Expected mapKey to be reused: bar !=", k2)
@@ -95,3 +95,17 @@ func TestId_WithStat(t *testing.T) {
 		t.Errorf("Got %s", id2.String())
 	}
 }
+
+func TestId_mapHash(t *testing.T) {
+	a := NewId("foo", map[string]string{"a": "1", "b": "2"})
+	b := NewId("foo", nil).WithTags(map[string]string{"b": "2", "a": "1"})
+	if a.mapHash() != b.mapHash() {
+		t.Errorf("Expected equal ids to have the same hash: %d != %d", a.mapHash(), b.mapHash())
+	}
+	if a.mapHash() == NewId("foo", nil).mapHash() {
+		t.Error("Expected different ids to have different hashes")
+	}
+
+	literal := Id{name: "foo", tags: map[string]string{"a": "1", "b": "2"}}
+	assertEqual(t, literal.mapHash(), a.mapHash(), "expected the hash to be computed for ids not created by NewId")
+}
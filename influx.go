@@ -0,0 +1,116 @@
+package spectator
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// InfluxDB timestamp precisions, accepted by both the 1.x and 2.x write APIs
+const (
+	InfluxNanoseconds  = "ns"
+	InfluxMilliseconds = "ms"
+	InfluxSeconds      = "s"
+)
+
+// nanoseconds per unit of each precision
+var influxUnits = map[string]int64{
+	InfluxNanoseconds:  1,
+	InfluxMilliseconds: 1e6,
+	InfluxSeconds:      1e9,
+}
+
+func validateInfluxPrecision(precision string) error {
+	if _, ok := influxUnits[precision]; !ok && precision != "" {
+		return fmt.Errorf("unknown InfluxDB precision %q, expected ns, ms or s", precision)
+	}
+	return nil
+}
+
+func influxPrecision(precision string) string {
+	if _, ok := influxUnits[precision]; !ok {
+		return InfluxNanoseconds
+	}
+	return precision
+}
+
+var (
+	influxNameEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTagEscaper  = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// influxFormatter formats measurements in the InfluxDB line protocol: the
+// name is the measurement, the tags, including the statistic, are sorted by
+// key, and the value is in the value field, with the given timestamp.
+func influxFormatter(timestamp int64) lineFormatter {
+	ts := strconv.FormatInt(timestamp, 10)
+	return func(m Measurement, tags map[string]string) []byte {
+		var buf bytes.Buffer
+		buf.WriteString(influxNameEscaper.Replace(m.id.name))
+		for _, k := range sortedTagKeys(tags) {
+			if tags[k] == "" {
+				// empty tag values are not allowed
+				continue
+			}
+			buf.WriteByte(',')
+			buf.WriteString(influxTagEscaper.Replace(k))
+			buf.WriteByte('=')
+			buf.WriteString(influxTagEscaper.Replace(tags[k]))
+		}
+		buf.WriteString(" value=")
+		buf.WriteString(strconv.FormatFloat(m.value, 'g', -1, 64))
+		buf.WriteByte(' ')
+		buf.WriteString(ts)
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+}
+
+// returns the lines for the measurements, timestamped with the current time
+// in the configured precision
+func (r *Registry) influxPayload(measurements []Measurement) []interface{} {
+	precision := influxPrecision(r.config.InfluxPrecision)
+	timestamp := r.clock.Nanos() / influxUnits[precision]
+	return formatLines(influxFormatter(timestamp), measurements, r.CommonTags())
+}
+
+// adds the precision parameter to the write uri unless it's already there
+func influxWriteUri(uri string, precision string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if query.Get("precision") == "" {
+		query.Set("precision", influxPrecision(precision))
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+// writes the lines to InfluxUri, or appends them to InfluxFile
+func (r *Registry) writeInflux(payload []interface{}, numMeasurements int) error {
+	var body bytes.Buffer
+	for _, lines := range payload {
+		body.WriteString(lines.(string))
+	}
+
+	if r.config.InfluxUri != "" {
+		uri, err := influxWriteUri(r.config.InfluxUri, r.config.InfluxPrecision)
+		if err != nil {
+			r.logPublishError("Invalid InfluxDB uri", "uri", r.config.InfluxUri, "error", err)
+			return &payloadError{err}
+		}
+		_, err = r.postBody(uri, "text/plain; charset=utf-8", body.Bytes(), numMeasurements)
+		return err
+	}
+
+	r.config.Log.Debug("Writing measurements", "count", numMeasurements, "file", r.config.InfluxFile)
+	err := appendFile(r.config.InfluxFile, body.Bytes())
+	if err != nil {
+		r.logPublishError("Unable to write measurements", "file", r.config.InfluxFile, "error", err)
+	}
+	return err
+}
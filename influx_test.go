@@ -0,0 +1,85 @@
+package spectator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxFormatter(t *testing.T) {
+	format := influxFormatter(90)
+	m := NewMeasurement(NewId("http requests", nil).WithStat("count"), 3)
+	line := string(format(m, map[string]string{"path": "/a,b", "k=": "v w", "empty": "", "statistic": "count"}))
+	expected := `http\ requests,k\==v\ w,path=/a\,b,statistic=count value=3 90` + "\n"
+	assertEqual(t, line, expected, "unexpected line")
+}
+
+func TestRegistry_publishInflux(t *testing.T) {
+	var body, precision, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		precision = r.URL.Query().Get("precision")
+		contentType = r.Header.Get("Content-Type")
+		w.WriteHeader(204)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.InfluxUri = server.URL + "/write?db=metrics"
+	cfg.InfluxPrecision = InfluxSeconds
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	r.clock = &ManualClock{int64(90 * time.Second)}
+	r.Counter("requests", map[string]string{"status": "2xx"}).Add(3)
+	r.publish()
+
+	if publishErr != nil {
+		t.Errorf("Expected a 204 to be a success, got %v", publishErr)
+	}
+	assertEqual(t, precision, "s", "expected the precision parameter")
+	assertEqual(t, contentType, "text/plain; charset=utf-8", "unexpected content type")
+	assertEqual(t, body, "requests,nf.app=test,statistic=count,status=2xx value=3 90\n", "unexpected body")
+}
+
+func TestRegistry_publishInfluxFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "influx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := makeConfig("")
+	cfg.CommonTags = nil
+	cfg.InfluxFile = filepath.Join(dir, "metrics.lp")
+	r := NewRegistry(cfg)
+	r.clock = &ManualClock{int64(90 * time.Second)}
+	r.Gauge("temperature", nil).Set(21.5)
+	r.publish()
+	r.Gauge("temperature", nil).Set(22)
+	r.publish()
+
+	b, err := ioutil.ReadFile(cfg.InfluxFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assertEqual(t, len(lines), 2, "expected the lines of both publishes to be appended")
+	assertEqual(t, lines[0], "temperature,statistic=gauge value=21.5 90000000000", "unexpected line")
+}
+
+func TestInfluxWriteUri(t *testing.T) {
+	uri, _ := influxWriteUri("http://localhost:8086/write?db=m&precision=ms", InfluxSeconds)
+	assertEqual(t, uri, "http://localhost:8086/write?db=m&precision=ms", "expected the uri precision to be kept")
+	uri, _ = influxWriteUri("http://localhost:8086/api/v2/write?bucket=b", "")
+	assertEqual(t, uri, "http://localhost:8086/api/v2/write?bucket=b&precision=ns", "expected nanoseconds by default")
+}
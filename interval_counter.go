@@ -0,0 +1,54 @@
+package spectator
+
+import "sync/atomic"
+
+// IntervalCounter is a counter that also reports the number of seconds
+// since it was last incremented, covering both how often and how recently
+// something happened.
+type IntervalCounter struct {
+	id        *Id
+	clock     Clock
+	counter   *Counter
+	lastNanos int64
+}
+
+func NewIntervalCounter(id *Id, clock Clock, initNanos int64) *IntervalCounter {
+	return &IntervalCounter{id, clock, NewCounter(id.WithStat("count")), initNanos}
+}
+
+func (c *IntervalCounter) MeterId() *Id {
+	return c.id
+}
+
+func (c *IntervalCounter) Measure() []Measurement {
+	ms := c.counter.Measure()
+	return append(ms, Measurement{c.id.WithStat("duration"), c.SecondsSinceLastUpdate()})
+}
+
+func (c *IntervalCounter) Increment() {
+	c.AddFloat(1)
+}
+
+func (c *IntervalCounter) Add(delta int64) {
+	if delta > 0 {
+		c.AddFloat(float64(delta))
+	}
+}
+
+func (c *IntervalCounter) AddFloat(delta float64) {
+	if delta > 0 {
+		c.counter.AddFloat(delta)
+		atomic.StoreInt64(&c.lastNanos, c.clock.Nanos())
+	}
+}
+
+// Count returns the lifetime value of the counter
+func (c *IntervalCounter) Count() float64 {
+	return c.counter.Count()
+}
+
+// SecondsSinceLastUpdate returns the number of seconds since the counter was
+// last incremented, or since the registry was created if it never was
+func (c *IntervalCounter) SecondsSinceLastUpdate() float64 {
+	return float64(c.clock.Nanos()-atomic.LoadInt64(&c.lastNanos)) / 1e9
+}
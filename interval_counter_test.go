@@ -0,0 +1,47 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalCounter(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	clock.SetNanos(r.startNanos)
+	r.clock = clock
+	c := r.IntervalCounter("jobs", nil)
+
+	clock.SetNanos(r.startNanos + int64(5*time.Second))
+	if v := c.SecondsSinceLastUpdate(); v != 5 {
+		t.Errorf("Expected the age since the registry was created, got %f", v)
+	}
+
+	c.Increment()
+	c.Add(2)
+	clock.SetNanos(r.startNanos + int64(20*time.Second))
+
+	ms := c.Measure()
+	if len(ms) != 2 {
+		t.Fatalf("Expected 2 measurements, got %d", len(ms))
+	}
+	for _, m := range ms {
+		switch m.id.tags["statistic"] {
+		case "count":
+			assertEqual(t, m.value, 3.0, "count")
+			assertEqual(t, opFromTags(m.id.tags), addOp, "count op")
+		case "duration":
+			assertEqual(t, m.value, 15.0, "duration")
+			assertEqual(t, opFromTags(m.id.tags), maxOp, "duration op")
+		default:
+			t.Errorf("Unexpected measurement %v", m)
+		}
+	}
+
+	if v := c.Measure()[0].value; v != 0 {
+		t.Errorf("Count should be reset after being measured, got %f", v)
+	}
+	if v := c.Count(); v != 3 {
+		t.Errorf("Expected a lifetime count of 3, got %f", v)
+	}
+}
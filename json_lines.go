@@ -0,0 +1,55 @@
+package spectator
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+)
+
+type jsonLine struct {
+	Timestamp int64             `json:"timestamp"`
+	Name      string            `json:"name"`
+	Tags      map[string]string `json:"tags"`
+	Value     float64           `json:"value"`
+}
+
+// appends b to the file at path, creating it if needed. The path - means stdout.
+func appendFile(path string, b []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writes one JSON object per measurement to JsonLinesFile, with the common
+// tags merged into the tags of each measurement
+func (r *Registry) writeJsonLines(measurements []Measurement) {
+	timestamp := r.clock.Nanos() / 1e6
+	commonTags := r.CommonTags()
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, m := range measurements {
+		tags := make(map[string]string, len(commonTags)+len(m.id.tags))
+		for k, v := range commonTags {
+			tags[k] = v
+		}
+		for k, v := range m.id.tags {
+			tags[k] = v
+		}
+		if err := encoder.Encode(jsonLine{timestamp, m.id.name, tags, m.value}); err != nil {
+			r.logPublishError("Unable to convert a measurement to json", "measurement", m, "error", err)
+		}
+	}
+	if err := appendFile(r.config.JsonLinesFile, buf.Bytes()); err != nil {
+		r.logPublishError("Unable to write measurements", "file", r.config.JsonLinesFile, "error", err)
+	}
+}
@@ -0,0 +1,83 @@
+package spectator
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readJsonLines(t *testing.T, path string) []jsonLine {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var lines []jsonLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line jsonLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Unable to decode %s: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestRegistry_publishJsonLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonlines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.JsonLinesFile = filepath.Join(dir, "metrics.jsonl")
+	r := NewRegistry(cfg)
+	r.clock = &ManualClock{int64(90 * time.Second)}
+	r.Counter("requests", map[string]string{"status": "2xx"}).Add(3)
+	r.publish()
+	r.Counter("requests", map[string]string{"status": "2xx"}).Add(2)
+	r.publish()
+
+	lines := readJsonLines(t, cfg.JsonLinesFile)
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per publish, got %v", lines)
+	}
+	assertEqual(t, lines[0].Timestamp, int64(90000), "expected the timestamp in milliseconds")
+	assertEqual(t, lines[0].Name, "requests", "unexpected name")
+	assertEqual(t, lines[0].Value, 3.0, "unexpected value")
+	assertEqual(t, lines[1].Value, 2.0, "expected the delta of the second interval")
+	assertEqual(t, lines[0].Tags["nf.app"], "test", "expected the common tags")
+	assertEqual(t, lines[0].Tags["statistic"], "count", "expected the statistic")
+}
+
+func TestRegistry_publishJsonLinesDisabled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jsonlines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	posted := false
+	cfg := makeConfig("http://example.org")
+	cfg.IsEnabled = func() bool { return false }
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		posted = true
+	}
+	cfg.JsonLinesFile = filepath.Join(dir, "metrics.jsonl")
+	r := NewRegistry(cfg)
+	r.Gauge("temperature", nil).Set(21.5)
+	r.publish()
+
+	lines := readJsonLines(t, cfg.JsonLinesFile)
+	assertEqual(t, len(lines), 1, "expected the measurements even if publishing is disabled")
+	if !posted {
+		t.Error("Expected the other destinations to be used too")
+	}
+}
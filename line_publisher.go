@@ -0,0 +1,147 @@
+package spectator
+
+import (
+	"bytes"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// keeps datagrams under the typical ethernet MTU
+const maxPacketSize = 1432
+
+// formats a measurement, with the common tags already merged into tags, as
+// one or more newline terminated lines
+type lineFormatter func(m Measurement, tags map[string]string) []byte
+
+// linePublisher sends measurements to an agent using a line based protocol,
+// packing as many lines as possible in each write. The connection is dialed
+// on the first publish, and if dialing or a write fails it is dropped and
+// dialed again on the next one, so the agent doesn't need to be up when the
+// registry is created.
+type linePublisher struct {
+	network string
+	address string
+	format  lineFormatter
+	// lines in a stream need to keep their terminator, a datagram doesn't
+	stream bool
+	// limits dialing and each write, if set
+	timeout time.Duration
+	mutex   sync.Mutex
+	conn    net.Conn
+}
+
+func newLinePublisherFor(network string, address string, format lineFormatter) *linePublisher {
+	stream := network == "tcp"
+	return &linePublisher{network: network, address: address, format: format, stream: stream}
+}
+
+// returns the publisher for the agent configured in config, if any
+func newLinePublisher(config *Config, clock Clock) (*linePublisher, error) {
+	var p *linePublisher
+	var err error
+	switch {
+	case config.SpectatordAddress != "":
+		p, err = newSpectatordPublisher(config.SpectatordAddress)
+	case config.StatsdAddress != "":
+		p, err = newStatsdPublisher(config.StatsdAddress, config.StatsdFlavor)
+	case config.GraphiteAddress != "":
+		p, err = newGraphitePublisher(config.GraphiteAddress, config.GraphiteNaming, clock)
+	}
+	if p != nil {
+		p.timeout = config.Timeout
+	}
+	return p, err
+}
+
+func sortedTagKeys(tags map[string]string) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// returns the lines for the given measurements, one entry per measurement.
+// Common tags are added unless the measurement sets them itself.
+func (p *linePublisher) payload(measurements []Measurement, commonTags map[string]string) []interface{} {
+	return formatLines(p.format, measurements, commonTags)
+}
+
+func formatLines(format lineFormatter, measurements []Measurement, commonTags map[string]string) []interface{} {
+	payload := make([]interface{}, len(measurements))
+	for i, m := range measurements {
+		tags := make(map[string]string, len(commonTags)+len(m.id.tags))
+		for k, v := range commonTags {
+			tags[k] = v
+		}
+		for k, v := range m.id.tags {
+			tags[k] = v
+		}
+		payload[i] = string(format(m, tags))
+	}
+	return payload
+}
+
+// sends the payload packing as many lines as possible in each write. Stops
+// at the first error, returning it with the number of entries of the payload
+// that were written completely.
+func (p *linePublisher) send(payload []interface{}) (int, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.conn == nil {
+		conn, err := net.DialTimeout(p.network, p.address, p.timeout)
+		if err != nil {
+			return 0, err
+		}
+		p.conn = conn
+	}
+
+	sent := 0
+	var packet bytes.Buffer
+	// where each entry in the packet ends
+	var ends []int
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		b := packet.Bytes()
+		if !p.stream {
+			b = b[:len(b)-1]
+		}
+		if p.timeout > 0 {
+			p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+		}
+		n, err := p.conn.Write(b)
+		if err != nil {
+			// a stream could have been written partially
+			for _, end := range ends {
+				if end <= n {
+					sent++
+				}
+			}
+			p.conn.Close()
+			p.conn = nil
+			return err
+		}
+		sent += len(ends)
+		packet.Reset()
+		ends = ends[:0]
+		return nil
+	}
+
+	for _, entry := range payload {
+		lines := entry.(string)
+		if packet.Len()+len(lines) > maxPacketSize {
+			if err := flush(); err != nil {
+				return sent, err
+			}
+		}
+		packet.WriteString(lines)
+		ends = append(ends, packet.Len())
+	}
+	err := flush()
+	return sent, err
+}
@@ -0,0 +1,110 @@
+package spectator
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a connection accepting up to limit bytes
+type limitedConn struct {
+	net.Conn
+	limit    int
+	written  []byte
+	deadline time.Time
+	closed   bool
+}
+
+func (c *limitedConn) Write(b []byte) (int, error) {
+	n := len(b)
+	if len(c.written)+n > c.limit {
+		n = c.limit - len(c.written)
+	}
+	c.written = append(c.written, b[:n]...)
+	if n < len(b) {
+		return n, errors.New("connection reset")
+	}
+	return n, nil
+}
+
+func (c *limitedConn) SetWriteDeadline(t time.Time) error {
+	c.deadline = t
+	return nil
+}
+
+func (c *limitedConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func linePayload(sizes ...int) []interface{} {
+	payload := make([]interface{}, len(sizes))
+	for i, size := range sizes {
+		payload[i] = strings.Repeat("x", size-1) + "\n"
+	}
+	return payload
+}
+
+func TestLinePublisher_PartialWrite(t *testing.T) {
+	// the first two entries fit in a packet, the third one goes in another
+	payload := linePayload(600, 600, 600)
+	cases := []struct {
+		limit int
+		sent  int
+	}{
+		{0, 0},
+		{700, 1},
+		{1200, 2},
+		{1500, 2},
+		{1800, 3},
+	}
+	for _, c := range cases {
+		conn := &limitedConn{limit: c.limit}
+		p := newLinePublisherFor("tcp", "127.0.0.1:0", nil)
+		p.timeout = time.Second
+		p.conn = conn
+
+		sent, err := p.send(payload)
+		if sent != c.sent {
+			t.Errorf("limit %d: expected %d entries sent, got %d", c.limit, c.sent, sent)
+		}
+		failed := c.sent < len(payload)
+		if failed != (err != nil) || failed != conn.closed || failed != (p.conn == nil) {
+			t.Errorf("limit %d: unexpected error %v, closed=%v", c.limit, err, conn.closed)
+		}
+		if conn.deadline.IsZero() && c.limit > 0 {
+			t.Errorf("limit %d: expected a write deadline", c.limit)
+		}
+	}
+}
+
+func TestRegistry_publishAgentPartialWrite(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.CommonTags = nil
+	cfg.SpectatordAddress = "udp://127.0.0.1:1234"
+	cfg.StrictTags = true
+	r := NewRegistry(cfg)
+	// long tags make each line take most of a packet
+	tags := map[string]string{}
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		tags[k] = strings.Repeat("x", maxValueLength)
+	}
+	tags["id"] = "a"
+	r.Counter("requests", tags).Increment()
+	tags["id"] = "b"
+	r.Counter("requests", tags).Increment()
+
+	conn := &limitedConn{limit: maxPacketSize}
+	r.agent.conn = conn
+	r.publish()
+
+	pending, _ := r.withPendingDeltas(nil)
+	if len(pending) != 1 {
+		t.Fatalf("Expected only the entry not written to be retained, got %v", pending)
+	}
+	if strings.Contains(string(conn.written), ",id="+pending[0].Id().Tags()["id"]+":") {
+		t.Errorf("The retained entry was written: %s", conn.written)
+	}
+}
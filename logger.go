@@ -1,19 +1,32 @@
 package spectator
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"sync"
+	"time"
 )
 
+// Logger receives the messages logged by the registry: a short constant
+// message, followed by pairs of keys and values giving its context, e.g.
+//
+//	log.Error("Could not POST measurements", "uri", uri, "status", 503)
+//
+// A *slog.Logger implements it as is. NewZapLogger, NewLogrusLogger and
+// NewPrintfLogger adapt other loggers.
 type Logger interface {
-	Debugf(format string, v ...interface{})
-	Infof(format string, v ...interface{})
-	Errorf(format string, v ...interface{})
+	Debug(msg string, keysAndValues ...interface{})
+	Info(msg string, keysAndValues ...interface{})
+	Warn(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
 }
 
 type DefaultLogger struct {
 	debug *log.Logger
 	info  *log.Logger
+	warn  *log.Logger
 	error *log.Logger
 }
 
@@ -22,23 +35,198 @@ func defaultLogger() *DefaultLogger {
 
 	debug := log.New(os.Stdout, "DEBUG: ", flags)
 	info := log.New(os.Stdout, "INFO: ", flags)
+	warn := log.New(os.Stdout, "WARN: ", flags)
 	err := log.New(os.Stdout, "ERROR: ", flags)
 
 	return &DefaultLogger{
 		debug,
 		info,
+		warn,
 		err,
 	}
 }
 
-func (l *DefaultLogger) Debugf(format string, v ...interface{}) {
-	l.debug.Printf(format, v...)
+func (l *DefaultLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.debug.Print(withFields(msg, keysAndValues))
+}
+
+func (l *DefaultLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.info.Print(withFields(msg, keysAndValues))
+}
+
+func (l *DefaultLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.warn.Print(withFields(msg, keysAndValues))
+}
+
+func (l *DefaultLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.error.Print(withFields(msg, keysAndValues))
+}
+
+// returns the message followed by the fields formatted as key=value, quoting
+// values with spaces, like "Could not POST measurements status=503"
+func withFields(msg string, keysAndValues []interface{}) string {
+	if len(keysAndValues) == 0 {
+		return msg
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, value := "!BADKEY", keysAndValues[i]
+		if i+1 < len(keysAndValues) {
+			key, value = fmt.Sprint(keysAndValues[i]), keysAndValues[i+1]
+		}
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " =\"") {
+			s = fmt.Sprintf("%q", s)
+		}
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// PrintfLogger is the printf-style logger interface used by earlier versions
+type PrintfLogger interface {
+	Debugf(format string, v ...interface{})
+	Infof(format string, v ...interface{})
+	Errorf(format string, v ...interface{})
+}
+
+// NewPrintfLogger adapts a printf-style logger, formatting the fields as
+// key=value after the message. Warnings are logged with Errorf.
+func NewPrintfLogger(l PrintfLogger) Logger {
+	return &printfLogger{l}
+}
+
+type printfLogger struct {
+	l PrintfLogger
+}
+
+func (p *printfLogger) Debug(msg string, keysAndValues ...interface{}) {
+	p.l.Debugf("%s", withFields(msg, keysAndValues))
+}
+
+func (p *printfLogger) Info(msg string, keysAndValues ...interface{}) {
+	p.l.Infof("%s", withFields(msg, keysAndValues))
+}
+
+func (p *printfLogger) Warn(msg string, keysAndValues ...interface{}) {
+	p.l.Errorf("%s", withFields(msg, keysAndValues))
+}
+
+func (p *printfLogger) Error(msg string, keysAndValues ...interface{}) {
+	p.l.Errorf("%s", withFields(msg, keysAndValues))
+}
+
+// ZapSugaredLogger is the subset of a *zap.SugaredLogger used by NewZapLogger
+type ZapSugaredLogger interface {
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+// NewZapLogger adapts a zap logger, e.g. NewZapLogger(zapLogger.Sugar()),
+// keeping the fields structured.
+func NewZapLogger(l ZapSugaredLogger) Logger {
+	return &zapLogger{l}
+}
+
+type zapLogger struct {
+	l ZapSugaredLogger
+}
+
+func (z *zapLogger) Debug(msg string, keysAndValues ...interface{}) {
+	z.l.Debugw(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	z.l.Infow(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Warn(msg string, keysAndValues ...interface{}) {
+	z.l.Warnw(msg, keysAndValues...)
+}
+
+func (z *zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	z.l.Errorw(msg, keysAndValues...)
+}
+
+// LogrusLogger is the subset of a *logrus.Logger or *logrus.Entry used by
+// NewLogrusLogger
+type LogrusLogger interface {
+	Debug(args ...interface{})
+	Info(args ...interface{})
+	Warn(args ...interface{})
+	Error(args ...interface{})
+}
+
+// NewLogrusLogger adapts a logrus logger or entry. Since logrus.Fields can't
+// be built without depending on logrus, the fields are formatted as
+// key=value after the message.
+func NewLogrusLogger(l LogrusLogger) Logger {
+	return &logrusLogger{l}
+}
+
+type logrusLogger struct {
+	l LogrusLogger
 }
 
-func (l *DefaultLogger) Infof(format string, v ...interface{}) {
-	l.info.Printf(format, v...)
+func (l *logrusLogger) Debug(msg string, keysAndValues ...interface{}) {
+	l.l.Debug(withFields(msg, keysAndValues))
 }
 
-func (l *DefaultLogger) Errorf(format string, v ...interface{}) {
-	l.error.Printf(format, v...)
+func (l *logrusLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.l.Info(withFields(msg, keysAndValues))
+}
+
+func (l *logrusLogger) Warn(msg string, keysAndValues ...interface{}) {
+	l.l.Warn(withFields(msg, keysAndValues))
+}
+
+func (l *logrusLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.l.Error(withFields(msg, keysAndValues))
+}
+
+const defaultPublishErrorLogInterval = time.Minute
+
+// logThrottle limits how often the same message is logged: the first
+// occurrence is logged, and repeats within the interval are only counted and
+// reported along with the next one logged.
+type logThrottle struct {
+	mutex    sync.Mutex
+	messages map[string]*throttledMessage
+}
+
+type throttledMessage struct {
+	logged     int64
+	suppressed int
+}
+
+func newLogThrottle() *logThrottle {
+	return &logThrottle{messages: map[string]*throttledMessage{}}
+}
+
+// returns whether the message should be logged at the given time, and how
+// many repeats were suppressed since it was last logged
+func (t *logThrottle) allow(msg string, now int64, interval time.Duration) (bool, int) {
+	if interval < 0 {
+		return true, 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	m, exists := t.messages[msg]
+	if !exists {
+		t.messages[msg] = &throttledMessage{logged: now}
+		return true, 0
+	}
+	if now-m.logged < int64(interval) {
+		m.suppressed++
+		return false, 0
+	}
+	suppressed := m.suppressed
+	m.logged, m.suppressed = now, 0
+	return true, suppressed
 }
@@ -0,0 +1,26 @@
+//go:build go1.21
+// +build go1.21
+
+package spectator
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	var log Logger = slog.New(handler)
+	log.Error("Could not POST measurements", "status", 503)
+	assertEqual(t, buf.String(), "level=ERROR msg=\"Could not POST measurements\" status=503\n",
+		"expected the fields to stay structured")
+}
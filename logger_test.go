@@ -0,0 +1,122 @@
+package spectator
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithFields(t *testing.T) {
+	assertEqual(t, withFields("msg", nil), "msg", "expected the message alone")
+	assertEqual(t, withFields("msg", []interface{}{"status", 503, "error", "connection refused"}),
+		`msg status=503 error="connection refused"`, "expected the fields after the message")
+	assertEqual(t, withFields("msg", []interface{}{"uri", ""}), `msg uri=""`, "expected empty values to be quoted")
+	assertEqual(t, withFields("msg", []interface{}{"status", 503, "odd"}), "msg status=503 !BADKEY=odd",
+		"expected a value without a key to be reported")
+}
+
+func TestDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := &DefaultLogger{
+		log.New(&buf, "DEBUG: ", 0),
+		log.New(&buf, "INFO: ", 0),
+		log.New(&buf, "WARN: ", 0),
+		log.New(&buf, "ERROR: ", 0),
+	}
+	l.Warn("Unable to reload the config", "file", "/etc/spectator.json")
+	l.Error("Could not POST measurements", "status", 400)
+	assertEqual(t, buf.String(),
+		"WARN: Unable to reload the config file=/etc/spectator.json\nERROR: Could not POST measurements status=400\n",
+		"expected the levels and fields to be logged")
+}
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) record(level string, args ...interface{}) {
+	l.lines = append(l.lines, level+" "+fmt.Sprint(args...))
+}
+
+func (l *recordingLogger) Debugf(format string, v ...interface{}) {
+	l.record("debug", fmt.Sprintf(format, v...))
+}
+func (l *recordingLogger) Infof(format string, v ...interface{}) {
+	l.record("info", fmt.Sprintf(format, v...))
+}
+func (l *recordingLogger) Errorf(format string, v ...interface{}) {
+	l.record("error", fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) Debugw(msg string, kv ...interface{}) { l.record("debug", msg, kv) }
+func (l *recordingLogger) Infow(msg string, kv ...interface{})  { l.record("info", msg, kv) }
+func (l *recordingLogger) Warnw(msg string, kv ...interface{})  { l.record("warn", msg, kv) }
+func (l *recordingLogger) Errorw(msg string, kv ...interface{}) { l.record("error", msg, kv) }
+
+func (l *recordingLogger) Debug(args ...interface{}) { l.record("debug", args...) }
+func (l *recordingLogger) Info(args ...interface{})  { l.record("info", args...) }
+func (l *recordingLogger) Warn(args ...interface{})  { l.record("warn", args...) }
+func (l *recordingLogger) Error(args ...interface{}) { l.record("error", args...) }
+
+func TestLoggerAdapters(t *testing.T) {
+	adapters := map[string]func(*recordingLogger) Logger{
+		"printf": func(l *recordingLogger) Logger { return NewPrintfLogger(l) },
+		"zap":    func(l *recordingLogger) Logger { return NewZapLogger(l) },
+		"logrus": func(l *recordingLogger) Logger { return NewLogrusLogger(l) },
+	}
+	expected := map[string][]string{
+		"printf": {"debug d a=1", "info i", "error w", "error e b=2"},
+		"zap":    {"debug d[a 1]", "info i[]", "warn w[]", "error e[b 2]"},
+		"logrus": {"debug d a=1", "info i", "warn w", "error e b=2"},
+	}
+	for name, adapter := range adapters {
+		recorded := &recordingLogger{}
+		l := adapter(recorded)
+		l.Debug("d", "a", 1)
+		l.Info("i")
+		l.Warn("w")
+		l.Error("e", "b", 2)
+		assertEqual(t, strings.Join(recorded.lines, ","), strings.Join(expected[name], ","), name)
+	}
+}
+
+func TestRegistry_PublishErrorLogThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(400)
+	}))
+	defer server.Close()
+
+	logger := &errorLogger{}
+	cfg := makeConfig(server.URL)
+	cfg.Log = logger
+	r := NewRegistry(cfg)
+	clock := &ManualClock{}
+	r.clock = clock
+	publish := func() {
+		r.Counter("a", nil).Increment()
+		r.publish()
+	}
+
+	publish()
+	clock.SetFromDuration(30 * time.Second)
+	publish()
+	publish()
+	assertEqual(t, len(logger.errors), 1, "expected the repeated errors to be suppressed")
+
+	clock.SetFromDuration(time.Minute)
+	publish()
+	assertEqual(t, len(logger.errors), 2, "expected the error to be logged again after a minute")
+	if !strings.Contains(logger.errors[1], "suppressed=2") {
+		t.Errorf("Expected the suppressed errors to be counted, got %s", logger.errors[1])
+	}
+
+	cfg.PublishErrorLogInterval = -1
+	publish()
+	publish()
+	assertEqual(t, len(logger.errors), 4, "expected every error to be logged with a negative interval")
+}
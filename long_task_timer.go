@@ -0,0 +1,71 @@
+package spectator
+
+import (
+	"sync"
+	"time"
+)
+
+// LongTaskTimer tracks tasks that are currently running. Each interval it
+// reports the number of active tasks and the sum of their durations so far,
+// so long operations are visible before they complete.
+type LongTaskTimer struct {
+	id     *Id
+	clock  Clock
+	mutex  *sync.Mutex
+	nextId int64
+	tasks  map[int64]int64
+}
+
+func NewLongTaskTimer(id *Id, clock Clock) *LongTaskTimer {
+	return &LongTaskTimer{id, clock, &sync.Mutex{}, 0, map[int64]int64{}}
+}
+
+func (t *LongTaskTimer) MeterId() *Id {
+	return t.id
+}
+
+// Start records the start of a task and returns an id to pass to Stop
+func (t *LongTaskTimer) Start() int64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nextId++
+	t.tasks[t.nextId] = t.clock.Nanos()
+	return t.nextId
+}
+
+// Stop marks the task as completed and returns its duration, or -1 if the task is unknown
+func (t *LongTaskTimer) Stop(task int64) time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	start, exists := t.tasks[task]
+	if !exists {
+		return -1
+	}
+	delete(t.tasks, task)
+	return time.Duration(t.clock.Nanos() - start)
+}
+
+// ActiveTasks returns the number of tasks currently running
+func (t *LongTaskTimer) ActiveTasks() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.tasks)
+}
+
+// Duration returns the sum of the durations of all tasks currently running
+func (t *LongTaskTimer) Duration() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.clock.Nanos()
+	var total int64
+	for _, start := range t.tasks {
+		total += now - start
+	}
+	return time.Duration(total)
+}
+
+func (t *LongTaskTimer) Measure() []Measurement {
+	active := Measurement{t.id.WithStat("activeTasks"), float64(t.ActiveTasks())}
+	duration := Measurement{t.id.WithStat("duration"), t.Duration().Seconds()}
+	return []Measurement{active, duration}
+}
@@ -0,0 +1,57 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLongTaskTimer(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	r.clock = clock
+	ltt := r.LongTaskTimer("bake", nil)
+
+	t1 := ltt.Start()
+	clock.SetFromDuration(10 * time.Second)
+	t2 := ltt.Start()
+	clock.SetFromDuration(30 * time.Second)
+
+	if v := ltt.ActiveTasks(); v != 2 {
+		t.Errorf("Expected 2 active tasks, got %d", v)
+	}
+	if v := ltt.Duration(); v != 50*time.Second {
+		t.Errorf("Expected 50s, got %v", v)
+	}
+
+	ms := ltt.Measure()
+	if len(ms) != 2 {
+		t.Fatalf("Expected 2 measurements, got %d", len(ms))
+	}
+	for _, m := range ms {
+		switch m.id.tags["statistic"] {
+		case "activeTasks":
+			assertEqual(t, m.value, 2.0, "activeTasks")
+		case "duration":
+			assertEqual(t, m.value, 50.0, "duration")
+		default:
+			t.Errorf("Unexpected measurement %v", m)
+		}
+		assertEqual(t, opFromTags(m.id.tags), maxOp, "long task timers are gauges")
+	}
+
+	if d := ltt.Stop(t1); d != 30*time.Second {
+		t.Errorf("Expected task 1 to take 30s, got %v", d)
+	}
+	if d := ltt.Stop(t1); d != -1 {
+		t.Errorf("Stopping an unknown task should return -1, got %v", d)
+	}
+	if v := ltt.ActiveTasks(); v != 1 {
+		t.Errorf("Expected 1 active task, got %d", v)
+	}
+	if d := ltt.Stop(t2); d != 20*time.Second {
+		t.Errorf("Expected task 2 to take 20s, got %v", d)
+	}
+	if v := ltt.Duration(); v != 0 {
+		t.Errorf("Expected no duration without active tasks, got %v", v)
+	}
+}
@@ -0,0 +1,33 @@
+package spectator
+
+import "math"
+
+// MaxGauge reports the maximum value set during a publish interval. The
+// value is reset after being measured.
+type MaxGauge struct {
+	id        *Id
+	valueBits uint64
+}
+
+func NewMaxGauge(id *Id) *MaxGauge {
+	return &MaxGauge{id, math.Float64bits(math.NaN())}
+}
+
+func (g *MaxGauge) MeterId() *Id {
+	return g.id
+}
+
+func (g *MaxGauge) Measure() []Measurement {
+	return []Measurement{{g.id.WithDefaultStat("max"), swapFloat64(&g.valueBits, math.NaN())}}
+}
+
+// Set updates the gauge if value is greater than the current maximum
+func (g *MaxGauge) Set(value float64) {
+	if !math.IsNaN(value) {
+		updateMaxFloat64(&g.valueBits, value)
+	}
+}
+
+func (g *MaxGauge) Get() float64 {
+	return loadFloat64(&g.valueBits)
+}
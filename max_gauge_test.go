@@ -0,0 +1,65 @@
+package spectator
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func getMaxGauge(name string) *MaxGauge {
+	return NewMaxGauge(NewId(name, nil))
+}
+
+func TestMaxGauge_Set(t *testing.T) {
+	g := getMaxGauge("g")
+	if v := g.Get(); !math.IsNaN(v) {
+		t.Error("Max gauges should not have an initial value: ", v)
+	}
+
+	g.Set(-1.0)
+	if v := g.Get(); v != -1.0 {
+		t.Error("Expected -1.0, got ", v)
+	}
+	g.Set(42.0)
+	g.Set(10.0)
+	g.Set(math.NaN())
+	if v := g.Get(); v != 42.0 {
+		t.Error("Expected 42.0, got ", v)
+	}
+}
+
+func TestMaxGauge_Measure(t *testing.T) {
+	g := getMaxGauge("g")
+	g.Set(42.0)
+	ms := g.Measure()
+
+	expectedId := NewId("g", map[string]string{"statistic": "max"})
+	expected := []Measurement{{expectedId, 42.0}}
+	if !reflect.DeepEqual(expected, ms) {
+		t.Error("Unexpected measurements: ", ms)
+	}
+	if opFromTags(ms[0].id.tags) != maxOp {
+		t.Error("Max gauges should be published with the max op")
+	}
+
+	if v := g.Get(); !math.IsNaN(v) {
+		t.Error("Max gauge values should be reset after being measured, got ", v)
+	}
+}
+
+func TestMaxGauge_Concurrent(t *testing.T) {
+	g := getMaxGauge("g")
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 0; i < 100; i++ {
+		go func(v float64) {
+			g.Set(v)
+			wg.Done()
+		}(float64(i))
+	}
+	wg.Wait()
+	if v := g.Get(); v != 99 {
+		t.Error("Expected 99, got ", v)
+	}
+}
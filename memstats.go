@@ -71,12 +71,13 @@ func CollectMemStats(registry *Registry) {
 	var mem memStatsCollector
 	initializeMemStatsCollector(registry, &mem)
 
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(collectionInterval(registry))
 	go func() {
 		log := registry.config.Log
-		for range ticker.C {
-			log.Debugf("Collecting memory stats")
+		for {
+			log.Debug("Collecting memory stats")
 			memStats(&mem)
+			<-ticker.C
 		}
 	}()
 }
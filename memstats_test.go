@@ -29,8 +29,9 @@ func TestUpdateMemStats(t *testing.T) {
 	updateMemStats(&mem, &memStats)
 
 	ms := registry.Meters()
-	if len(ms) != 6 {
-		t.Error("Expected 6 meters registered, got", len(ms))
+	// the monotonic counters are registered even before they see a delta
+	if len(ms) != 11 {
+		t.Error("Expected 11 meters registered, got", len(ms))
 	}
 
 	expectedValues := map[string]float64{
@@ -0,0 +1,180 @@
+package spectator
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// the number of shards of a meterMap, a power of two
+const meterShards = 32
+
+// meterMap holds the meters of a registry by the map key of their ids, along
+// with the number of meters registered for each name.
+//
+// It is safe for concurrent use. The meters are striped across shards by the
+// hash of their keys, each with its own lock, so goroutines creating or
+// looking up different meters rarely contend. Lookups only take a read lock;
+// adding or removing a meter takes the write lock of its shard. values
+// returns a snapshot, so publishing measures the meters without holding any
+// lock and never blocks meter creation while a gauge function runs. Meters
+// added or removed while a publish is measuring the snapshot are picked up by
+// the next publish.
+type meterMap struct {
+	// the number of meters, updated atomically. First so it's 64-bit aligned
+	size       int64
+	shards     []meterShard
+	namesMutex sync.Mutex
+	nameCounts map[string]int
+}
+
+type meterShard struct {
+	mutex  sync.RWMutex
+	meters map[string]Meter
+	// keeps the locks of adjacent shards on different cache lines
+	_ [64]byte
+}
+
+func newMeterMap() *meterMap {
+	return newShardedMeterMap(meterShards)
+}
+
+// shards must be a power of two
+func newShardedMeterMap(shards int) *meterMap {
+	m := &meterMap{shards: make([]meterShard, shards), nameCounts: map[string]int{}}
+	for i := range m.shards {
+		m.shards[i].meters = map[string]Meter{}
+	}
+	return m
+}
+
+// returns the shard for the hash of a key
+func (m *meterMap) shard(hash uint32) *meterShard {
+	return &m.shards[hash&uint32(len(m.shards)-1)]
+}
+
+func (m *meterMap) get(id *Id) (Meter, bool) {
+	key := id.mapKey()
+	shard := m.shard(id.mapHash())
+	shard.mutex.RLock()
+	meter, exists := shard.meters[key]
+	shard.mutex.RUnlock()
+	return meter, exists
+}
+
+// returns a snapshot of the meters
+func (m *meterMap) values() []Meter {
+	meters := make([]Meter, 0, m.len())
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mutex.RLock()
+		for _, meter := range shard.meters {
+			meters = append(meters, meter)
+		}
+		shard.mutex.RUnlock()
+	}
+	return meters
+}
+
+func (m *meterMap) len() int {
+	return int(atomic.LoadInt64(&m.size))
+}
+
+// returns the number of meters registered with the given name
+func (m *meterMap) nameCount(name string) int {
+	m.namesMutex.Lock()
+	defer m.namesMutex.Unlock()
+	return m.nameCounts[name]
+}
+
+// getOrAdd returns the meter registered with the id, or adds the one
+// returned by create. create is called with the lock held, so callers racing
+// to add the same id all get the same instance. If maxMeters is positive and
+// the map already holds that many meters, the created meter is returned
+// without being added and full is true.
+func (m *meterMap) getOrAdd(id *Id, maxMeters int, create MeterFactoryFun) (meter Meter, added bool, full bool) {
+	if meter, exists := m.get(id); exists {
+		return meter, false, false
+	}
+
+	key := id.mapKey()
+	shard := m.shard(id.mapHash())
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	// check again, another goroutine might have added it while we were waiting for the lock
+	if meter, exists := shard.meters[key]; exists {
+		return meter, false, false
+	}
+	meter = create()
+	if !m.reserve(maxMeters) {
+		return meter, false, true
+	}
+	shard.meters[key] = meter
+	m.countName(meter.MeterId().name, 1)
+	return meter, true, false
+}
+
+// increments the size unless it has reached maxMeters
+func (m *meterMap) reserve(maxMeters int) bool {
+	if maxMeters <= 0 {
+		atomic.AddInt64(&m.size, 1)
+		return true
+	}
+	for {
+		size := atomic.LoadInt64(&m.size)
+		if size >= int64(maxMeters) {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&m.size, size, size+1) {
+			return true
+		}
+	}
+}
+
+func (m *meterMap) countName(name string, delta int) {
+	m.namesMutex.Lock()
+	defer m.namesMutex.Unlock()
+	if count := m.nameCounts[name] + delta; count > 0 {
+		m.nameCounts[name] = count
+	} else {
+		delete(m.nameCounts, name)
+	}
+}
+
+// remove removes the meter registered with the key, if it's the given meter
+// or the given meter is nil. Returns the removed meter.
+func (m *meterMap) remove(key string, meter Meter) (Meter, bool) {
+	shard := m.shard(hashKey(key))
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+	registered, exists := shard.meters[key]
+	if !exists || (meter != nil && registered != meter) {
+		return nil, false
+	}
+	m.removeLocked(shard, key, registered)
+	return registered, true
+}
+
+// removeIf removes the meters matching the predicate and returns them. The
+// predicate is called with the lock of the shard of the meter held.
+func (m *meterMap) removeIf(predicate func(Meter) bool) []Meter {
+	var removed []Meter
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mutex.Lock()
+		for key, meter := range shard.meters {
+			if predicate(meter) {
+				m.removeLocked(shard, key, meter)
+				removed = append(removed, meter)
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return removed
+}
+
+// must be called with the write lock of the shard held
+func (m *meterMap) removeLocked(shard *meterShard, key string, meter Meter) {
+	delete(shard.meters, key)
+	atomic.AddInt64(&m.size, -1)
+	m.countName(meter.MeterId().name, -1)
+}
@@ -0,0 +1,145 @@
+package spectator
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMeterMap_GetOrAdd(t *testing.T) {
+	m := newMeterMap()
+	id := NewId("foo", nil)
+	var created int32
+	var wg sync.WaitGroup
+	meters := make([]Meter, 16)
+	for i := range meters {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			meters[i], _, _ = m.getOrAdd(id, 0, func() Meter {
+				atomic.AddInt32(&created, 1)
+				return NewCounter(id)
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	assertEqual(t, atomic.LoadInt32(&created), int32(1), "expected the factory to be called once")
+	for _, meter := range meters {
+		if meter != meters[0] {
+			t.Fatalf("Expected the same instance, got %v and %v", meter, meters[0])
+		}
+	}
+	assertEqual(t, m.len(), 1, "expected one meter")
+	assertEqual(t, m.nameCount("foo"), 1, "expected one meter named foo")
+}
+
+func TestMeterMap_Full(t *testing.T) {
+	m := newMeterMap()
+	m.getOrAdd(NewId("a", nil), 1, func() Meter { return NewCounter(NewId("a", nil)) })
+	meter, added, full := m.getOrAdd(NewId("b", nil), 1, func() Meter { return NewCounter(NewId("b", nil)) })
+	if meter == nil || added || !full {
+		t.Errorf("Expected the meter to be created but not added, got %v %v %v", meter, added, full)
+	}
+	assertEqual(t, m.len(), 1, "expected the limit to be kept")
+}
+
+func TestMeterMap_Remove(t *testing.T) {
+	m := newMeterMap()
+	x := NewId("x", nil)
+	a, _, _ := m.getOrAdd(x, 0, func() Meter { return NewCounter(x) })
+	m.getOrAdd(x.WithTag("k", "v"), 0, func() Meter { return NewCounter(x.WithTag("k", "v")) })
+	assertEqual(t, m.nameCount("x"), 2, "expected both meters to be counted")
+
+	if _, removed := m.remove(x.mapKey(), NewCounter(x)); removed {
+		t.Error("Expected a different meter not to be removed")
+	}
+	if removed, ok := m.remove(x.mapKey(), nil); !ok || removed != a {
+		t.Errorf("Expected the meter to be removed, got %v", removed)
+	}
+	assertEqual(t, m.nameCount("x"), 1, "expected the count to be decremented")
+
+	removed := m.removeIf(func(Meter) bool { return true })
+	assertEqual(t, len(removed), 1, "expected the remaining meter to be removed")
+	assertEqual(t, m.nameCount("x"), 0, "expected no meters named x")
+}
+
+// run with -race: creates, removes and publishes meters concurrently
+func TestRegistry_ConcurrentCreateAndPublish(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	r.config.MaxMetersPerName = 50
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				tags := map[string]string{"id": fmt.Sprint(j % 100)}
+				r.Counter("requests", tags).Increment()
+				r.Gauge(fmt.Sprintf("gauge.%d", i), nil).Set(float64(j))
+				if j%50 == 0 {
+					r.RemoveAll(fmt.Sprintf("gauge.%d", i))
+				}
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				r.Measurements()
+				r.Meters()
+			}
+		}
+	}()
+	for i := 0; i < 8; i++ {
+		r.Counter("requests", map[string]string{"id": fmt.Sprint(i)})
+	}
+	close(stop)
+	wg.Wait()
+
+	// goroutines racing past the limit can each add one more, plus the
+	// overflow series
+	if n := r.meters.nameCount("requests"); n > 50+9+1 {
+		t.Errorf("Expected about 50 request meters, got %d", n)
+	}
+}
+
+func TestMeterMap_Shards(t *testing.T) {
+	m := newMeterMap()
+	for i := 0; i < 1000; i++ {
+		id := NewId(fmt.Sprintf("meter.%d", i), nil)
+		m.getOrAdd(id, 0, func() Meter { return NewCounter(id) })
+	}
+	assertEqual(t, m.len(), 1000, "expected all meters to be added")
+	assertEqual(t, len(m.values()), 1000, "expected all meters in the snapshot")
+	for i := range m.shards {
+		if len(m.shards[i].meters) == 0 {
+			t.Errorf("Expected the meters to be spread across shards, shard %d is empty", i)
+		}
+	}
+}
+
+func TestMeterMap_FullAcrossShards(t *testing.T) {
+	m := newMeterMap()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				id := NewId(fmt.Sprintf("meter.%d.%d", i, j), nil)
+				m.getOrAdd(id, 50, func() Meter { return NewCounter(id) })
+			}
+		}(i)
+	}
+	wg.Wait()
+	assertEqual(t, m.len(), 50, "expected the limit to hold across shards")
+	assertEqual(t, len(m.values()), 50, "expected the snapshot to match the size")
+}
@@ -0,0 +1,37 @@
+package spectator
+
+// MeterRegistry is the set of Registry operations used to create and look up
+// meters. Code that only records metrics can depend on it instead of
+// *Registry so tests can pass a NewNoopRegistry or NewTestRegistry.
+type MeterRegistry interface {
+	NewId(name string, tags map[string]string) *Id
+	NewMeter(id *Id, meterFactory MeterFactoryFun) Meter
+	Register(meter Meter) error
+	Meters() []Meter
+	Measurements() []Measurement
+	Clock() Clock
+
+	Counter(name string, tags map[string]string) *Counter
+	CounterWithId(id *Id) *Counter
+	Timer(name string, tags map[string]string) *Timer
+	TimerWithId(id *Id) *Timer
+	Gauge(name string, tags map[string]string) *Gauge
+	GaugeWithId(id *Id) *Gauge
+	DistributionSummary(name string, tags map[string]string) *DistributionSummary
+	DistributionSummaryWithId(id *Id) *DistributionSummary
+
+	Start() error
+	Stop()
+}
+
+var _ MeterRegistry = (*Registry)(nil)
+
+// NewTestRegistry returns a registry for unit tests. It doesn't publish
+// anywhere, and its Clock is a *ManualClock starting at zero so tests can
+// control time. Use Meters or Measurements to check what was recorded.
+func NewTestRegistry() *Registry {
+	r := NewRegistry(&Config{Frequency: defaultFrequency, Timeout: defaultTimeout, BatchSize: defaultBatchSize})
+	r.clock = &ManualClock{}
+	r.startNanos = 0
+	return r
+}
@@ -0,0 +1,34 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+type requestHandler struct {
+	registry MeterRegistry
+}
+
+func (h *requestHandler) handle() {
+	h.registry.Counter("requests", nil).Increment()
+	h.registry.Timer("latency", nil).Record(time.Millisecond)
+}
+
+func TestMeterRegistry(t *testing.T) {
+	r := NewTestRegistry()
+	(&requestHandler{r}).handle()
+	assertEqual(t, r.Counter("requests", nil).Count(), 1.0, "expected the counter to be recorded")
+	assertEqual(t, len(r.Measurements()), 5, "expected the counter and timer measurements")
+
+	clock, ok := r.Clock().(*ManualClock)
+	if !ok {
+		t.Fatalf("Expected a manual clock, got %T", r.Clock())
+	}
+	clock.SetFromDuration(time.Minute)
+	assertEqual(t, r.AgeGauge("age", nil).Age(), 60.0, "expected the age relative to the manual clock")
+
+	// the handler works the same with a registry that records nothing
+	noop := NewNoopRegistry()
+	(&requestHandler{noop}).handle()
+	assertEqual(t, len(noop.Meters()), 0, "expected no meters")
+}
@@ -2,35 +2,80 @@ package spectator
 
 import "sync/atomic"
 
+// MonotonicCounter tracks a cumulative total maintained elsewhere (for example
+// a kernel counter) and reports the deltas between successive observations
+// through a regular Counter. The first observation and any decrease (a reset of
+// the source) are reported as zero, unless a wraparound value is configured.
 type MonotonicCounter struct {
-	registry *Registry
-	id       *Id
-	value    int64
-	counter  *Counter
+	id      *Id
+	value   uint64
+	seen    int32
+	counter *Counter
+	wrapAt  float64
 }
 
+// NewMonotonicCounter returns the monotonic counter registered in registry
+// with the given name and tags, creating it if needed
 func NewMonotonicCounter(registry *Registry, name string, tags map[string]string) *MonotonicCounter {
-	return NewMonotonicCounterWithId(registry, NewId(name, tags))
+	return registry.MonotonicCounter(name, tags)
 }
 
 func NewMonotonicCounterWithId(registry *Registry, id *Id) *MonotonicCounter {
-	return &MonotonicCounter{registry, id, 0, nil}
+	return registry.MonotonicCounterWithId(id)
+}
+
+func newMonotonicCounter(id *Id) *MonotonicCounter {
+	return &MonotonicCounter{id: id, counter: NewCounter(id)}
+}
+
+func (c *MonotonicCounter) MeterId() *Id {
+	return c.id
+}
+
+// Measure returns the sum of the deltas observed since the last time the
+// counter was measured
+func (c *MonotonicCounter) Measure() []Measurement {
+	return c.counter.Measure()
+}
+
+// a decrease is only taken as a wraparound if the previous total was in the
+// top quarter of the range
+const wrapThreshold = 0.75
+
+// WithWraparound configures the maximum value of the source counter. When a
+// total lower than the previous one is observed and the previous one was
+// close to max, the source is assumed to have wrapped around. Otherwise it's
+// assumed to have restarted from zero, and the new total is the delta.
+func (c *MonotonicCounter) WithWraparound(max float64) *MonotonicCounter {
+	c.wrapAt = max
+	return c
 }
 
 func (c *MonotonicCounter) Set(amount int64) {
-	prev := atomic.LoadInt64(&c.value)
-	if prev > 0 {
-		if c.counter == nil {
-			c.counter = c.registry.CounterWithId(c.id)
-		}
-		delta := amount - prev
-		if delta >= 0 {
-			c.counter.Add(delta)
+	c.SetFloat(float64(amount))
+}
+
+func (c *MonotonicCounter) SetFloat(total float64) {
+	prev := swapFloat64(&c.value, total)
+	if atomic.CompareAndSwapInt32(&c.seen, 0, 1) {
+		// first observation, nothing to compare against
+		return
+	}
+
+	delta := total - prev
+	if delta < 0 && c.wrapAt > 0 {
+		if prev >= wrapThreshold*c.wrapAt {
+			delta = c.wrapAt - prev + total + 1
+		} else {
+			// too far from the max to have wrapped, the source was restarted
+			delta = total
 		}
 	}
-	atomic.StoreInt64(&c.value, amount)
+	if delta > 0 {
+		c.counter.AddFloat(delta)
+	}
 }
 
 func (c *MonotonicCounter) Count() int64 {
-	return atomic.LoadInt64(&c.value)
+	return int64(loadFloat64(&c.value))
 }
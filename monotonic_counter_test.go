@@ -1,6 +1,9 @@
 package spectator
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestNewMonotonicCounter(t *testing.T) {
 	r := NewRegistry(makeConfig("http://example.org"))
@@ -10,26 +13,87 @@ func TestNewMonotonicCounter(t *testing.T) {
 		t.Errorf("Counters should be initialized to 0, got %d", v)
 	}
 
-	if c.counter != nil {
-		t.Errorf("Underlying counter should be nil until we get a delta")
-	}
-
 	c.Set(42)
 	if v := c.Count(); v != 42 {
 		t.Errorf("Expected 42, got %d", v)
 	}
 
-	if c.counter != nil {
-		t.Errorf("Underlying counter should be nil until we get a delta")
+	if v := c.counter.Count(); v != 0 {
+		t.Errorf("Nothing should be reported until we get a delta, got %f", v)
 	}
 
 	// now we have a delta
 	c.Set(52)
-	if c.counter == nil {
-		t.Errorf("Underlying counter should not be nil")
-	}
 
 	if v := c.counter.Count(); v != 10 {
 		t.Errorf("Delta should be 10, got %f", v)
 	}
 }
+
+func TestMonotonicCounter_Deltas(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	c := r.MonotonicCounter("mono", nil)
+
+	totals := []float64{100, 150, 175.5, 20, 30, 30}
+	// first observation and the reset to 20 are reported as 0
+	expected := []float64{0, 50, 25.5, 0, 10, 0}
+	for i, total := range totals {
+		c.SetFloat(total)
+		delta := c.Measure()[0].value
+		if delta != expected[i] {
+			t.Errorf("Set(%f): expected delta %f, got %f", total, expected[i], delta)
+		}
+	}
+}
+
+func TestMonotonicCounter_FirstObservationZero(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	c := r.MonotonicCounter("mono", nil)
+
+	c.Set(0)
+	c.Set(5)
+	if v := c.counter.Count(); v != 5 {
+		t.Errorf("Delta should be 5, got %f", v)
+	}
+}
+
+func TestMonotonicCounter_Wraparound(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	c := r.MonotonicCounter("mono", nil).WithWraparound(math.MaxUint32)
+
+	c.Set(math.MaxUint32 - 10)
+	c.Set(math.MaxUint32 - 5)
+	c.Set(4)
+	// 5, then 5 up to the max, 1 to wrap to 0 and 4 more
+	if v := c.counter.Count(); v != 15 {
+		t.Errorf("Expected 15, got %f", v)
+	}
+}
+
+func TestMonotonicCounter_Registered(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	c := r.MonotonicCounter("mono", nil)
+	if r.MonotonicCounter("mono", nil) != c || NewMonotonicCounter(r, "mono", nil) != c {
+		t.Error("Expected the same monotonic counter to be returned")
+	}
+
+	c.Set(10)
+	c.Set(12)
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].Id().Name() != "mono" || ms[0].Value() != 2 {
+		t.Errorf("Expected the delta to be measured by the registry, got %v", ms)
+	}
+}
+
+func TestMonotonicCounter_WraparoundRestart(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	c := r.MonotonicCounter("mono", nil).WithWraparound(math.MaxUint32)
+
+	c.Set(1000)
+	c.Set(1500)
+	// far from the max, the source restarted and counted 20 since then
+	c.Set(20)
+	if v := c.counter.Count(); v != 520 {
+		t.Errorf("Expected 520, got %f", v)
+	}
+}
@@ -0,0 +1,254 @@
+package spectator
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// OTLP/HTTP encodings of the requests posted to Config.OtlpUri
+const (
+	OtlpProtobuf = "http/protobuf"
+	OtlpJson     = "http/json"
+)
+
+// Types for an OTLP ExportMetricsServiceRequest, as accepted by OpenTelemetry
+// collectors on /v1/metrics. They are marshaled with encoding/json for the
+// JSON encoding and with marshalProto for the protobuf one.
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name  string     `json:"name"`
+	Sum   *otlpSum   `json:"sum,omitempty"`
+	Gauge *otlpGauge `json:"gauge,omitempty"`
+}
+
+// aggregation temporality of the deltas sent by the registry
+const otlpDeltaTemporality = 1
+
+type otlpSum struct {
+	DataPoints             []otlpDataPoint `json:"dataPoints"`
+	AggregationTemporality int             `json:"aggregationTemporality"`
+	IsMonotonic            bool            `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes        []otlpAttribute `json:"attributes"`
+	StartTimeUnixNano uint64          `json:"startTimeUnixNano,string,omitempty"`
+	TimeUnixNano      uint64          `json:"timeUnixNano,string"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpAttribute struct {
+	Key   string          `json:"key"`
+	Value otlpStringValue `json:"value"`
+}
+
+type otlpStringValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func otlpAttributes(tags map[string]string) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(tags))
+	for _, k := range sortedTagKeys(tags) {
+		attributes = append(attributes, otlpAttribute{k, otlpStringValue{tags[k]}})
+	}
+	return attributes
+}
+
+// OTLP expects a single type per metric name, so the statistic is moved from
+// the attributes to the name unless it's the primary statistic of a counter
+// or gauge: a timer becomes latency (the count), latency.totalTime,
+// latency.totalOfSquares and latency.max.
+func otlpMetricName(id *Id) string {
+	switch stat := id.tags["statistic"]; stat {
+	case "", "count", "gauge":
+		return id.name
+	default:
+		return id.name + "." + stat
+	}
+}
+
+// converts the measurements to an OTLP request. Measurements using the add op
+// are sent as monotonic sums with delta temporality covering their window in
+// windows, the others as gauges. Common tags become resource attributes.
+func measurementsToOtlp(measurements []Measurement, commonTags map[string]string, windows deltaWindows, nowNanos int64) otlpRequest {
+	now := uint64(nowNanos)
+
+	metrics := map[string]*otlpMetric{}
+	for _, m := range measurements {
+		attrs := make(map[string]string, len(m.id.tags))
+		for k, v := range m.id.tags {
+			if k != "statistic" {
+				attrs[k] = v
+			}
+		}
+		name := otlpMetricName(m.id)
+		isSum := opFromTags(m.id.tags) == addOp
+		key := name + "|sum"
+		if !isSum {
+			key = name + "|gauge"
+		}
+		metric, exists := metrics[key]
+		if !exists {
+			metric = &otlpMetric{Name: name}
+			if isSum {
+				metric.Sum = &otlpSum{AggregationTemporality: otlpDeltaTemporality, IsMonotonic: true}
+			} else {
+				metric.Gauge = &otlpGauge{}
+			}
+			metrics[key] = metric
+		}
+		if isSum {
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpDataPoint{otlpAttributes(attrs), uint64(windows.startOf(m)), now, m.value})
+		} else {
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpDataPoint{otlpAttributes(attrs), 0, now, m.value})
+		}
+	}
+
+	keys := make([]string, 0, len(metrics))
+	for k := range metrics {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	scope := otlpScopeMetrics{Scope: otlpScope{"spectator-go"}, Metrics: make([]otlpMetric, 0, len(keys))}
+	for _, k := range keys {
+		scope.Metrics = append(scope.Metrics, *metrics[k])
+	}
+	return otlpRequest{[]otlpResourceMetrics{{
+		Resource:     otlpResource{otlpAttributes(commonTags)},
+		ScopeMetrics: []otlpScopeMetrics{scope},
+	}}}
+}
+
+// Protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendProtoTag(b []byte, field int, wireType int) []byte {
+	return appendUvarint(b, uint64(field<<3|wireType))
+}
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	return appendUvarint(appendProtoTag(b, field, protoVarint), v)
+}
+
+func appendProtoFixed64(b []byte, field int, v uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return append(appendProtoTag(b, field, protoFixed64), buf[:]...)
+}
+
+func appendProtoBytes(b []byte, field int, data []byte) []byte {
+	b = appendUvarint(appendProtoTag(b, field, protoBytes), uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendProtoString(b []byte, field int, s string) []byte {
+	b = appendUvarint(appendProtoTag(b, field, protoBytes), uint64(len(s)))
+	return append(b, s...)
+}
+
+// marshalProto encodes the request as an
+// opentelemetry.proto.collector.metrics.v1.ExportMetricsServiceRequest
+func (req otlpRequest) marshalProto() []byte {
+	var b []byte
+	for _, rm := range req.ResourceMetrics {
+		b = appendProtoBytes(b, 1, rm.marshalProto())
+	}
+	return b
+}
+
+func (rm otlpResourceMetrics) marshalProto() []byte {
+	var resource []byte
+	for _, a := range rm.Resource.Attributes {
+		resource = appendProtoBytes(resource, 1, a.marshalProto())
+	}
+	b := appendProtoBytes(nil, 1, resource)
+	for _, sm := range rm.ScopeMetrics {
+		b = appendProtoBytes(b, 2, sm.marshalProto())
+	}
+	return b
+}
+
+func (sm otlpScopeMetrics) marshalProto() []byte {
+	b := appendProtoBytes(nil, 1, appendProtoString(nil, 1, sm.Scope.Name))
+	for _, m := range sm.Metrics {
+		b = appendProtoBytes(b, 2, m.marshalProto())
+	}
+	return b
+}
+
+func (m otlpMetric) marshalProto() []byte {
+	b := appendProtoString(nil, 1, m.Name)
+	if m.Gauge != nil {
+		var gauge []byte
+		for _, dp := range m.Gauge.DataPoints {
+			gauge = appendProtoBytes(gauge, 1, dp.marshalProto())
+		}
+		b = appendProtoBytes(b, 5, gauge)
+	}
+	if m.Sum != nil {
+		var sum []byte
+		for _, dp := range m.Sum.DataPoints {
+			sum = appendProtoBytes(sum, 1, dp.marshalProto())
+		}
+		sum = appendProtoVarint(sum, 2, uint64(m.Sum.AggregationTemporality))
+		if m.Sum.IsMonotonic {
+			sum = appendProtoVarint(sum, 3, 1)
+		}
+		b = appendProtoBytes(b, 7, sum)
+	}
+	return b
+}
+
+func (dp otlpDataPoint) marshalProto() []byte {
+	var b []byte
+	if dp.StartTimeUnixNano != 0 {
+		b = appendProtoFixed64(b, 2, dp.StartTimeUnixNano)
+	}
+	b = appendProtoFixed64(b, 3, dp.TimeUnixNano)
+	b = appendProtoFixed64(b, 4, math.Float64bits(dp.AsDouble))
+	for _, a := range dp.Attributes {
+		b = appendProtoBytes(b, 7, a.marshalProto())
+	}
+	return b
+}
+
+func (a otlpAttribute) marshalProto() []byte {
+	b := appendProtoString(nil, 1, a.Key)
+	return appendProtoBytes(b, 2, appendProtoString(nil, 1, a.Value.StringValue))
+}
@@ -0,0 +1,226 @@
+package spectator
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func readOtlpBody(t *testing.T, r *http.Request) []byte {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, _ = gzip.NewReader(r.Body)
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Error("Unable to read the OTLP request", err)
+	}
+	return body
+}
+
+func otlpMetricsByName(request otlpRequest) map[string]otlpMetric {
+	metrics := map[string]otlpMetric{}
+	for _, rm := range request.ResourceMetrics {
+		for _, m := range rm.ScopeMetrics[0].Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func TestRegistry_publishOtlp(t *testing.T) {
+	var request otlpRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, r.Header.Get("Content-Type"), "application/json", "unexpected content type")
+		if err := json.Unmarshal(readOtlpBody(t, r), &request); err != nil {
+			t.Error("Unable to decode the OTLP request", err)
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.OtlpUri = server.URL + "/v1/metrics"
+	cfg.OtlpProtocol = OtlpJson
+	cfg.Frequency = 10 * time.Second
+	r := NewRegistry(cfg)
+	clock := &ManualClock{}
+	r.clock = clock
+	clock.SetFromDuration(45 * time.Second)
+	// the delta window starts with the previous publish
+	r.publish()
+	clock.SetFromDuration(time.Minute)
+	r.Counter("requests", map[string]string{"status": "200"}).Add(3)
+	r.Timer("latency", nil).Record(2 * time.Second)
+	r.publish()
+
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatalf("Expected 1 resource, got %v", request)
+	}
+	rm := request.ResourceMetrics[0]
+	assertEqual(t, len(rm.Resource.Attributes), 1, "expected the common tags as resource attributes")
+	assertEqual(t, rm.Resource.Attributes[0].Value.StringValue, "test", "unexpected resource attribute")
+
+	metrics := otlpMetricsByName(request)
+	assertEqual(t, len(metrics), 5, "unexpected number of metrics")
+
+	requests := metrics["requests"]
+	if requests.Sum == nil || len(requests.Sum.DataPoints) != 1 {
+		t.Fatalf("Expected requests to be a sum with 1 data point, got %v", requests)
+	}
+	dp := requests.Sum.DataPoints[0]
+	assertEqual(t, dp.AsDouble, 3.0, "unexpected value")
+	assertEqual(t, dp.TimeUnixNano, uint64(60000000000), "unexpected time")
+	assertEqual(t, dp.StartTimeUnixNano, uint64(45000000000), "expected the time of the previous publish")
+	assertEqual(t, len(dp.Attributes), 1, "expected the statistic to be dropped from the attributes")
+	assertEqual(t, requests.Sum.AggregationTemporality, otlpDeltaTemporality, "expected delta temporality")
+
+	if max := metrics["latency.max"]; max.Gauge == nil || max.Gauge.DataPoints[0].AsDouble != 2 {
+		t.Errorf("Expected latency.max to be a gauge, got %v", max)
+	}
+	if total := metrics["latency.totalTime"]; total.Sum == nil || total.Sum.DataPoints[0].AsDouble != 2 {
+		t.Errorf("Expected latency.totalTime to be a sum, got %v", total)
+	}
+}
+
+func TestRegistry_publishOtlpRetainedStart(t *testing.T) {
+	var requests []otlpRequest
+	fail := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request otlpRequest
+		if err := json.Unmarshal(readOtlpBody(t, r), &request); err != nil {
+			t.Error("Unable to decode the OTLP request", err)
+		}
+		requests = append(requests, request)
+		if fail {
+			w.WriteHeader(503)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.OtlpUri = server.URL + "/v1/metrics"
+	cfg.OtlpProtocol = OtlpJson
+	r := NewRegistry(cfg)
+	clock := &ManualClock{}
+	r.clock = clock
+	clock.SetFromDuration(10 * time.Second)
+	r.publish()
+	clock.SetFromDuration(20 * time.Second)
+	r.Counter("retained", nil).Add(3)
+	r.publish()
+
+	fail = false
+	clock.SetFromDuration(30 * time.Second)
+	r.Counter("retained", nil).Add(2)
+	r.Counter("fresh", nil).Increment()
+	r.publish()
+
+	metrics := otlpMetricsByName(requests[len(requests)-1])
+	retained := metrics["retained"].Sum.DataPoints[0]
+	assertEqual(t, retained.AsDouble, 5.0, "expected the retained delta to be added")
+	assertEqual(t, retained.StartTimeUnixNano, uint64(10000000000), "expected the start of the failed window")
+	fresh := metrics["fresh"].Sum.DataPoints[0]
+	assertEqual(t, fresh.StartTimeUnixNano, uint64(20000000000), "expected the start of the current window")
+	assertEqual(t, fresh.TimeUnixNano, uint64(30000000000), "unexpected time")
+}
+
+// a decoded protobuf field: varint and fixed64 values are in value, length
+// delimited ones in data
+type protoField struct {
+	num   int
+	value uint64
+	data  []byte
+}
+
+func decodeProto(t *testing.T, b []byte) map[int][]protoField {
+	fields := map[int][]protoField{}
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("Invalid tag in %v", b)
+		}
+		b = b[n:]
+		f := protoField{num: int(tag >> 3)}
+		switch tag & 7 {
+		case protoVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case protoFixed64:
+			f.value = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case protoBytes:
+			length, n := binary.Uvarint(b)
+			f.data = b[n : n+int(length)]
+			b = b[n+int(length):]
+		default:
+			t.Fatalf("Unexpected wire type %d", tag&7)
+		}
+		fields[f.num] = append(fields[f.num], f)
+	}
+	return fields
+}
+
+func TestRegistry_publishOtlpProtobuf(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertEqual(t, r.Header.Get("Content-Type"), "application/x-protobuf", "unexpected content type")
+		body = readOtlpBody(t, r)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.OtlpUri = server.URL + "/v1/metrics"
+	r := NewRegistry(cfg)
+	clock := &ManualClock{}
+	r.clock = clock
+	clock.SetFromDuration(50 * time.Second)
+	r.publish()
+	clock.SetFromDuration(time.Minute)
+	r.Counter("requests", map[string]string{"status": "200"}).Add(3)
+	r.Gauge("queue", nil).Set(7)
+	r.publish()
+
+	resourceMetrics := decodeProto(t, body)[1]
+	if len(resourceMetrics) != 1 {
+		t.Fatalf("Expected 1 resource, got %v", resourceMetrics)
+	}
+	rm := decodeProto(t, resourceMetrics[0].data)
+	attr := decodeProto(t, decodeProto(t, rm[1][0].data)[1][0].data)
+	assertEqual(t, string(attr[1][0].data), "nf.app", "unexpected resource attribute")
+	assertEqual(t, string(decodeProto(t, attr[2][0].data)[1][0].data), "test", "unexpected resource attribute value")
+
+	scope := decodeProto(t, rm[2][0].data)
+	assertEqual(t, string(decodeProto(t, scope[1][0].data)[1][0].data), "spectator-go", "unexpected scope")
+	metrics := map[string]map[int][]protoField{}
+	for _, m := range scope[2] {
+		fields := decodeProto(t, m.data)
+		metrics[string(fields[1][0].data)] = fields
+	}
+	assertEqual(t, len(metrics), 2, "unexpected number of metrics")
+
+	sum := decodeProto(t, metrics["requests"][7][0].data)
+	assertEqual(t, sum[2][0].value, uint64(otlpDeltaTemporality), "expected delta temporality")
+	assertEqual(t, sum[3][0].value, uint64(1), "expected a monotonic sum")
+	dp := decodeProto(t, sum[1][0].data)
+	assertEqual(t, dp[2][0].value, uint64(50000000000), "expected the start of the window")
+	assertEqual(t, dp[3][0].value, uint64(60000000000), "unexpected time")
+	assertEqual(t, math.Float64frombits(dp[4][0].value), 3.0, "unexpected value")
+	assertEqual(t, len(dp[7]), 1, "expected the statistic to be dropped from the attributes")
+
+	gauge := decodeProto(t, metrics["queue"][5][0].data)
+	dp = decodeProto(t, gauge[1][0].data)
+	assertEqual(t, len(dp[2]), 0, "expected no start time for gauges")
+	assertEqual(t, math.Float64frombits(dp[4][0].value), 7.0, "unexpected gauge value")
+}
@@ -0,0 +1,70 @@
+package spectator
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// PolledSize is the handle for a gauge reporting the size of a collection,
+// sampled at publish time.
+type PolledSize struct {
+	registry *Registry
+	gauge    *FuncGauge
+}
+
+// Stop removes the gauge from the registry
+func (p *PolledSize) Stop() {
+	p.registry.UnregisterMeter(p.gauge)
+}
+
+func pollSize(registry *Registry, name string, tags map[string]string, f func() float64) *PolledSize {
+	return &PolledSize{registry: registry, gauge: registry.GaugeFunc(name, tags, f)}
+}
+
+// PollCollectionSize registers a gauge that reports the value returned by
+// lenFunc for target each time the registry is published. The target is a
+// map, a channel or a pointer, and is kept alive until Stop is called; a
+// nil one reports 0. With Go 1.24, PollWeakSize only keeps a weak reference
+// to its target and removes the gauge once it's garbage collected.
+func PollCollectionSize(registry *Registry, name string, tags map[string]string, target interface{}, lenFunc func(target interface{}) int) (*PolledSize, error) {
+	v := reflect.ValueOf(target)
+	switch kind := v.Kind(); kind {
+	case reflect.Map, reflect.Chan, reflect.Ptr:
+	case reflect.Invalid:
+		return nil, errors.New("PollCollectionSize: the target is nil, use a typed nil")
+	default:
+		return nil, errors.Errorf("PollCollectionSize: unable to reference a %v, use a pointer", kind)
+	}
+	if v.IsNil() {
+		return pollSize(registry, name, tags, func() float64 { return 0 }), nil
+	}
+	return pollSize(registry, name, tags, func() float64 {
+		return float64(lenFunc(target))
+	}), nil
+}
+
+// PollMapSize registers a gauge that reports the number of elements in the
+// given map or channel, or the slice or array pointed to by m, each time the
+// registry is published. A nil map, channel or pointer reports 0. Maps are
+// not safe for concurrent use, so callers modifying the map from other
+// goroutines should use PollCollectionSize with their own locking instead.
+func PollMapSize(registry *Registry, name string, tags map[string]string, m interface{}) (*PolledSize, error) {
+	v := reflect.ValueOf(m)
+	kind := v.Kind()
+	if kind == reflect.Ptr {
+		kind = v.Type().Elem().Kind()
+	}
+	switch kind {
+	case reflect.Map, reflect.Slice, reflect.Chan, reflect.Array:
+	default:
+		return nil, errors.Errorf("PollMapSize: unable to get the size of a %v", kind)
+	}
+	return PollCollectionSize(registry, name, tags, m, func(target interface{}) int {
+		v := reflect.ValueOf(target)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		return v.Len()
+	})
+}
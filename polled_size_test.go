@@ -0,0 +1,92 @@
+package spectator
+
+import (
+	"testing"
+)
+
+func TestPollCollectionSize(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	queue := make(chan int, 10)
+	queue <- 1
+	queue <- 2
+	p, err := PollCollectionSize(r, "queue.size", nil, queue, func(q interface{}) int {
+		return len(q.(chan int))
+	})
+	if err != nil {
+		t.Fatal("Unable to poll the queue", err)
+	}
+
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 2 {
+		t.Errorf("Expected the queue size, got %v", ms)
+	}
+
+	p.Stop()
+	if ms := r.Measurements(); len(ms) != 0 {
+		t.Errorf("Expected no measurements after Stop, got %v", ms)
+	}
+}
+
+func TestPollMapSize(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	m := map[string]int{"a": 1}
+	p, _ := PollMapSize(r, "map.size", nil, m)
+	m["b"] = 2
+
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 2 {
+		t.Errorf("Expected the map size, got %v", ms)
+	}
+	p.Stop()
+
+	s := []int{1, 2, 3}
+	p, _ = PollMapSize(r, "slice.size", nil, &s)
+	s = append(s, 4)
+	ms = r.Measurements()
+	if len(ms) != 1 || ms[0].value != 4 {
+		t.Errorf("Expected the slice size, got %v", ms)
+	}
+	p.Stop()
+}
+
+func TestPollCollectionSize_View(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	view := r.WithTags(map[string]string{"component": "cache"})
+	m := map[string]int{"a": 1}
+	p, _ := PollMapSize(view, "map.size", nil, m)
+	assertEqual(t, len(r.Meters()), 1, "expected the gauge to be registered")
+	p.Stop()
+	assertEqual(t, len(r.Meters()), 0, "expected Stop to remove the gauge with the view tags")
+}
+
+func TestPollMapSize_Nil(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	var m map[string]int
+	p, err := PollMapSize(r, "map.size", nil, m)
+	if err != nil {
+		t.Fatal("Expected a nil map to be polled", err)
+	}
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 0 {
+		t.Errorf("Expected a nil map to be empty, got %v", ms)
+	}
+	p.Stop()
+
+	var s *[]int
+	p, err = PollMapSize(r, "slice.size", nil, s)
+	if err != nil {
+		t.Fatal("Expected a nil pointer to be polled", err)
+	}
+	p.Stop()
+}
+
+func TestPollMapSize_Unsupported(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	if _, err := PollMapSize(r, "int.size", nil, 42); err == nil {
+		t.Error("Expected an int to be rejected")
+	}
+	if _, err := PollCollectionSize(r, "size", nil, nil, func(interface{}) int { return 0 }); err == nil {
+		t.Error("Expected an untyped nil to be rejected")
+	}
+	assertEqual(t, len(r.Meters()), 0, "expected no gauge to be registered")
+}
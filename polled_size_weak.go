@@ -0,0 +1,32 @@
+//go:build go1.24
+// +build go1.24
+
+package spectator
+
+import (
+	"math"
+	"runtime"
+	"weak"
+)
+
+// PollWeakSize registers a gauge that reports the value returned by lenFunc
+// for target each time the registry is published, only keeping a weak
+// reference to target: once it's garbage collected the gauge is removed
+// from the registry. For that to work lenFunc must use its argument instead
+// of referencing target. A nil target reports 0, and pointers to zero-sized
+// values may never be seen as collected.
+func PollWeakSize[T any](registry *Registry, name string, tags map[string]string, target *T, lenFunc func(target *T) int) *PolledSize {
+	if target == nil {
+		return pollSize(registry, name, tags, func() float64 { return 0 })
+	}
+	ref := weak.Make(target)
+	p := pollSize(registry, name, tags, func() float64 {
+		t := ref.Value()
+		if t == nil {
+			return math.NaN()
+		}
+		return float64(lenFunc(t))
+	})
+	runtime.AddCleanup(target, func(p *PolledSize) { p.Stop() }, p)
+	return p
+}
@@ -0,0 +1,60 @@
+//go:build go1.24
+// +build go1.24
+
+package spectator
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+type sizeOwner struct {
+	items  map[string]int
+	polled *PolledSize
+}
+
+func TestPolledSize_RemovedWhenCollected(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	var polled *PolledSize
+	func() {
+		owner := &sizeOwner{items: map[string]int{"a": 1}}
+		owner.polled = PollWeakSize(r, "owner.size", nil, owner, func(o *sizeOwner) int {
+			return len(o.items)
+		})
+		// the handle outliving the collection doesn't keep the gauge
+		polled = owner.polled
+	}()
+
+	for i := 0; i < 50 && len(r.Meters()) > 0; i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(r.Meters()); n != 0 {
+		t.Errorf("Expected the gauge to be removed once the owner is collected, got %d meters", n)
+	}
+	polled.Stop()
+}
+
+func TestPollWeakSize(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	owner := &sizeOwner{items: map[string]int{"a": 1, "b": 2}}
+	p := PollWeakSize(r, "owner.size", nil, owner, func(o *sizeOwner) int {
+		return len(o.items)
+	})
+	ms := r.Measurements()
+	if len(ms) != 1 || ms[0].value != 2 {
+		t.Errorf("Expected the size of the owner, got %v", ms)
+	}
+	p.Stop()
+	runtime.KeepAlive(owner)
+
+	p = PollWeakSize(r, "nil.size", nil, (*sizeOwner)(nil), func(o *sizeOwner) int {
+		return len(o.items)
+	})
+	ms = r.Measurements()
+	if len(ms) != 1 || ms[0].value != 0 {
+		t.Errorf("Expected a nil target to be empty, got %v", ms)
+	}
+	p.Stop()
+}
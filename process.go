@@ -0,0 +1,112 @@
+package spectator
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// approximately when the process started, for process.uptime
+var processStart = time.Now()
+
+// the CPU time and memory of the process
+type processStats struct {
+	userSeconds   float64
+	systemSeconds float64
+	rssBytes      int64
+}
+
+type processStatsCollector struct {
+	registry   *Registry
+	userTime   *MonotonicCounter
+	systemTime *MonotonicCounter
+	rss        *Gauge
+	uptime     *Gauge
+	fds        sysStatsCollector
+}
+
+func initializeProcessStatsCollector(registry *Registry, s *processStatsCollector) {
+	s.registry = registry
+	s.userTime = NewMonotonicCounter(registry, "process.cpuTime", map[string]string{"mode": "user"})
+	s.systemTime = NewMonotonicCounter(registry, "process.cpuTime", map[string]string{"mode": "system"})
+	s.rss = registry.Gauge("process.rss", nil)
+	s.uptime = registry.Gauge("process.uptime", nil)
+	s.fds.registry = registry
+	s.fds.curOpen = registry.Gauge("fh.allocated", nil)
+	s.fds.maxOpen = registry.Gauge("fh.max", nil)
+}
+
+func updateProcessStats(s *processStatsCollector, stats *processStats, uptime time.Duration) {
+	s.uptime.Set(uptime.Seconds())
+	if stats == nil {
+		return
+	}
+	s.userTime.SetFloat(stats.userSeconds)
+	s.systemTime.SetFloat(stats.systemSeconds)
+	s.rss.Set(float64(stats.rssBytes))
+}
+
+func processStatsOnce(s *processStatsCollector) {
+	stats, err := readProcessStats()
+	if err != nil && err != errProcessStatsUnsupported {
+		s.registry.config.Log.Error("Unable to get the process stats", "error", err)
+	}
+	updateProcessStats(s, stats, time.Since(processStart))
+	fdStats(&s.fds)
+}
+
+// Collects process stats, so OS dashboards work without a node exporter:
+// the CPU time in seconds by mode (user or system), the resident set size
+// in bytes, the uptime in seconds, and the current/max file handles. Only
+// the uptime is available outside of Linux, where the others are read from
+// /proc.
+func CollectProcessMetrics(registry *Registry) {
+	var s processStatsCollector
+	initializeProcessStatsCollector(registry, &s)
+
+	ticker := time.NewTicker(collectionInterval(registry))
+	go func() {
+		log := registry.config.Log
+		for {
+			log.Debug("Collecting process stats")
+			processStatsOnce(&s)
+			<-ticker.C
+		}
+	}()
+}
+
+var errProcessStatsUnsupported = errors.New("process stats are only available on Linux")
+
+// the clock ticks per second used by /proc, USER_HZ, which is 100 on all the
+// architectures supported by Go
+const clockTicks = 100
+
+// parses the contents of /proc/self/stat, see proc(5)
+func parseProcStat(stat string, pageSize int) (*processStats, error) {
+	// the command name, in parentheses, can contain spaces and parentheses
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return nil, errors.Errorf("Invalid process stat %q", stat)
+	}
+	// the fields after the command name, starting with the state, field 3
+	fields := strings.Fields(stat[end+1:])
+	const utime, stime, rss = 14 - 3, 15 - 3, 24 - 3
+	if len(fields) <= rss {
+		return nil, errors.Errorf("Invalid process stat %q", stat)
+	}
+	values := make(map[int]int64, 3)
+	for _, i := range []int{utime, stime, rss} {
+		v, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid process stat %q", stat)
+		}
+		values[i] = v
+	}
+	return &processStats{
+		userSeconds:   float64(values[utime]) / clockTicks,
+		systemSeconds: float64(values[stime]) / clockTicks,
+		rssBytes:      values[rss] * int64(pageSize),
+	}, nil
+}
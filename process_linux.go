@@ -0,0 +1,14 @@
+package spectator
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+func readProcessStats() (*processStats, error) {
+	stat, err := ioutil.ReadFile("/proc/self/stat")
+	if err != nil {
+		return nil, err
+	}
+	return parseProcStat(string(stat), os.Getpagesize())
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package spectator
+
+func readProcessStats() (*processStats, error) {
+	return nil, errProcessStatsUnsupported
+}
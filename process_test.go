@@ -0,0 +1,50 @@
+package spectator
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseProcStat(t *testing.T) {
+	stat := "1234 (my (weird) cmd) S 1 1234 1234 0 -1 4194560 2000 0 0 0 250 75 0 0 20 0 8 0 100 800000000 300 " +
+		"18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 3 0 0 0 0 0"
+	stats, err := parseProcStat(stat, 4096)
+	if err != nil {
+		t.Fatal("Unable to parse the process stat", err)
+	}
+	assertEqual(t, stats.userSeconds, 2.5, "unexpected user time")
+	assertEqual(t, stats.systemSeconds, .75, "unexpected system time")
+	assertEqual(t, stats.rssBytes, int64(300*4096), "unexpected resident set size")
+
+	if _, err := parseProcStat("1234 (cmd) S 1", 4096); err == nil {
+		t.Error("Expected a truncated stat to be rejected")
+	}
+}
+
+func TestUpdateProcessStats(t *testing.T) {
+	registry := NewRegistry(makeConfig(""))
+	var s processStatsCollector
+	initializeProcessStatsCollector(registry, &s)
+	updateProcessStats(&s, &processStats{userSeconds: 1, systemSeconds: 2, rssBytes: 1000}, time.Minute)
+	updateProcessStats(&s, &processStats{userSeconds: 1.5, systemSeconds: 2.25, rssBytes: 2000}, 2*time.Minute)
+
+	assertEqual(t, s.userTime.Measure()[0].Value(), .5, "expected the user time since the first update")
+	assertEqual(t, s.systemTime.Measure()[0].Value(), .25, "expected the system time since the first update")
+	assertEqual(t, registry.Gauge("process.rss", nil).Get(), 2000.0, "unexpected resident set size")
+	assertEqual(t, registry.Gauge("process.uptime", nil).Get(), 120.0, "unexpected uptime")
+}
+
+func TestReadProcessStats(t *testing.T) {
+	stats, err := readProcessStats()
+	if runtime.GOOS != "linux" {
+		assertEqual(t, err, errProcessStatsUnsupported, "expected the process stats to be unsupported")
+		return
+	}
+	if err != nil {
+		t.Fatal("Unable to read the process stats", err)
+	}
+	if stats.rssBytes <= 0 {
+		t.Errorf("Expected the resident set size, got %d", stats.rssBytes)
+	}
+}
@@ -0,0 +1,392 @@
+package spectator
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+const openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+type promSample struct {
+	suffix   string
+	labels   map[string]string
+	value    float64
+	exemplar *Exemplar
+}
+
+type promFamily struct {
+	kind    string
+	samples []promSample
+}
+
+// a series kept by the prometheus state, one per measurement id
+type promSeries struct {
+	meterKey string
+	id       *Id
+	value    float64
+	exemplar *Exemplar
+}
+
+// prometheusState keeps the values exposed by the PrometheusHandler. The
+// registry publishes deltas, but Prometheus expects counters to only go up,
+// so measurements using the add op are accumulated since the registry was
+// created. Gauges keep the last value measured, and are dropped when they
+// measure NaN.
+type prometheusState struct {
+	mutex      sync.Mutex
+	series     map[string]*promSeries
+	commonTags map[string]string
+}
+
+func newPrometheusState() *prometheusState {
+	return &prometheusState{series: map[string]*promSeries{}, commonTags: map[string]string{}}
+}
+
+// adds the measurements taken in a publish. Series for meters no longer in
+// the registry are dropped, as are gauges that measured NaN.
+func (p *prometheusState) update(meters []meterMeasurements, commonTags map[string]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	registered := make(map[string]bool, len(meters))
+	series := make(map[string]*promSeries, len(p.series))
+	for _, mm := range meters {
+		meterKey := mm.meter.MeterId().mapKey()
+		registered[meterKey] = true
+		for _, m := range mm.measurements {
+			key := m.id.mapKey()
+			value := m.value
+			if opFromTags(m.id.tags) == addOp {
+				prev, exists := p.series[key]
+				switch {
+				case !exists && value == 0:
+					// counters show up once they're incremented, like in the export
+					continue
+				case exists && math.IsNaN(value):
+					value = prev.value
+				case exists:
+					value += prev.value
+				}
+			}
+			if math.IsNaN(value) {
+				continue
+			}
+			var exemplar *Exemplar
+			if c, ok := mm.meter.(*Counter); ok {
+				exemplar = c.Exemplar()
+			}
+			series[key] = &promSeries{meterKey, m.id, value, exemplar}
+		}
+	}
+	// totals for meters that didn't report a measurement this time are kept
+	for key, s := range p.series {
+		if _, exists := series[key]; !exists && registered[s.meterKey] && opFromTags(s.id.tags) == addOp {
+			series[key] = s
+		}
+	}
+	p.series = series
+	p.commonTags = commonTags
+}
+
+// returns a copy of the series and the common tags last published
+func (p *prometheusState) snapshot() ([]promSeries, map[string]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	series := make([]promSeries, 0, len(p.series))
+	for _, s := range p.series {
+		series = append(series, *s)
+	}
+	return series, p.commonTags
+}
+
+// PrometheusHandler renders the meters of the registry using the Prometheus
+// text exposition format, or OpenMetrics 1.0 if the client prefers it in the
+// Accept header. The values are updated on each publish; counters and the
+// count and sum of timers and distribution summaries are cumulative, and
+// timers are reported in seconds. Counter exemplars are only included in the
+// OpenMetrics output.
+func PrometheusHandler(registry *Registry) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writePrometheus(w, registry, acceptsOpenMetrics(r))
+	}
+}
+
+// returns true if OpenMetrics is acceptable and preferred over the other media
+// types listed in the Accept header, using their quality values
+func acceptsOpenMetrics(r *http.Request) bool {
+	openMetrics, others := 0.0, 0.0
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(strings.TrimSpace(kv[0])) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if mediaType == "application/openmetrics-text" {
+			openMetrics = math.Max(openMetrics, q)
+		} else {
+			others = math.Max(others, q)
+		}
+	}
+	return openMetrics > 0 && openMetrics >= others
+}
+
+func writePrometheus(w http.ResponseWriter, registry *Registry, openMetrics bool) {
+	if registry.root != nil {
+		registry = registry.root
+	}
+	if openMetrics {
+		w.Header().Set("Content-Type", openMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", prometheusContentType)
+	}
+	w.WriteHeader(http.StatusOK)
+	series, commonTags := registry.prometheus.snapshot()
+	w.Write(renderPrometheus(series, commonTags, openMetrics, registry.config.Log))
+}
+
+func isPromNameChar(c byte, first bool, allowColon bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		return true
+	case c == ':':
+		return allowColon
+	case c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+func sanitizePrometheus(s string, allowColon bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isPromNameChar(c, i == 0, allowColon) {
+			if c >= '0' && c <= '9' {
+				buf.WriteByte('_')
+				buf.WriteByte(c)
+				continue
+			}
+			c = '_'
+		}
+		buf.WriteByte(c)
+	}
+	if buf.Len() == 0 {
+		return "_"
+	}
+	return buf.String()
+}
+
+func promMetricName(name string) string {
+	return sanitizePrometheus(name, true)
+}
+
+func promLabelName(key string) string {
+	return sanitizePrometheus(key, false)
+}
+
+// returns the labels for a series from its tags, with the common tags added
+// unless the meter sets them itself
+func promLabels(tags map[string]string, commonTags map[string]string) map[string]string {
+	byKey := make(map[string]string, len(tags)+len(commonTags))
+	for k, v := range commonTags {
+		byKey[k] = v
+	}
+	for k, v := range tags {
+		byKey[k] = v
+	}
+	delete(byKey, "statistic")
+	keys := make([]string, 0, len(byKey))
+	for k := range byKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// when two keys collide after sanitization the first one (in sorted order) wins
+	labels := make(map[string]string, len(keys))
+	for _, k := range keys {
+		label := promLabelName(k)
+		if _, exists := labels[label]; !exists {
+			labels[label] = byKey[k]
+		}
+	}
+	return labels
+}
+
+// maps a statistic to a prometheus family, type and sample suffix. The
+// family depends on the other statistics reported by the same meter: the
+// count, sum and quantiles of a meter reporting a total time or amount make a
+// summary, a meter with a single statistic keeps its name, and any other
+// statistic gets a family of its own, e.g. latency_max or ltt_activeTasks.
+// Statistics using the add op are exposed as counters and the rest as gauges.
+func promFamilyFor(name string, statistic string, statistics map[string]bool) (family string, promType string, suffix string) {
+	summary := statistics["totalTime"] || statistics["totalAmount"]
+	switch {
+	case summary && (statistic == "totalTime" || statistic == "totalAmount"):
+		return name, "summary", "_sum"
+	case summary && statistic == "count":
+		return name, "summary", "_count"
+	case summary && statistic == "quantile":
+		// the quantile tag is kept as a label
+		return name, "summary", ""
+	case statistic == "percentile":
+		// the percentile buckets of a PercentileTimer share the name of its timer
+		family = name + "_percentile"
+	case statistic == "count", statistic == "gauge", statistic == "", len(statistics) == 1:
+		family = name
+	default:
+		family = name + "_" + promMetricName(statistic)
+	}
+	if opFromTags(map[string]string{"statistic": statistic}) == addOp {
+		return family, "counter", "_total"
+	}
+	return family, "gauge", ""
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, "\n", `\n`, -1)
+	return strings.Replace(v, `"`, `\"`, -1)
+}
+
+// OpenMetrics limits the combined length of the names and values of the
+// labels of an exemplar
+const maxExemplarLabelsLength = 128
+
+func writePromLabels(buf *bytes.Buffer, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(k)
+		buf.WriteString(`="`)
+		buf.WriteString(escapeLabelValue(labels[k]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+}
+
+// returns the labels of the exemplar, or false if they are too long
+func exemplarLabels(e *Exemplar) (map[string]string, bool) {
+	labels := make(map[string]string, len(e.Labels))
+	length := 0
+	for k, v := range e.Labels {
+		label := promLabelName(k)
+		labels[label] = v
+		length += utf8.RuneCountInString(label) + utf8.RuneCountInString(v)
+	}
+	return labels, length <= maxExemplarLabelsLength
+}
+
+func formatPromSample(name string, s promSample) string {
+	var buf bytes.Buffer
+	buf.WriteString(name)
+	buf.WriteString(s.suffix)
+	if len(s.labels) > 0 {
+		writePromLabels(&buf, s.labels)
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+	if s.exemplar != nil {
+		if labels, ok := exemplarLabels(s.exemplar); ok {
+			buf.WriteString(" # ")
+			writePromLabels(&buf, labels)
+			buf.WriteByte(' ')
+			buf.WriteString(strconv.FormatFloat(s.exemplar.Value, 'g', -1, 64))
+		}
+	}
+	return buf.String()
+}
+
+// renders the series in the Prometheus text format. In OpenMetrics the type
+// of a counter family is declared without the _total suffix and the output is
+// terminated by an EOF marker.
+func renderPrometheus(series []promSeries, commonTags map[string]string, openMetrics bool, log Logger) []byte {
+	statistics := make(map[string]map[string]bool)
+	for _, s := range series {
+		stats, exists := statistics[s.meterKey]
+		if !exists {
+			stats = map[string]bool{}
+			statistics[s.meterKey] = stats
+		}
+		stats[s.id.tags["statistic"]] = true
+	}
+
+	// sorted so names are assigned the same way on each scrape when they conflict
+	sort.Slice(series, func(i, j int) bool { return series[i].id.mapKey() < series[j].id.mapKey() })
+	families := make(map[string]*promFamily)
+	for _, s := range series {
+		statistic := s.id.tags["statistic"]
+		familyName, promType, suffix := promFamilyFor(promMetricName(s.id.name), statistic, statistics[s.meterKey])
+		// two spectator names can collapse into the same prometheus name with
+		// different types, in which case the type is added to the name
+		family, exists := families[familyName]
+		if exists && family.kind != promType {
+			familyName += "_" + promType
+			family, exists = families[familyName]
+		}
+		if !exists {
+			family = &promFamily{kind: promType}
+			families[familyName] = family
+		} else if family.kind != promType {
+			log.Error("Unable to expose a meter to Prometheus, its name is already used by another type", "id", s.id.mapKey(), "name", familyName, "type", family.kind)
+			continue
+		}
+		sample := promSample{suffix, promLabels(s.id.tags, commonTags), s.value, nil}
+		if openMetrics && promType == "counter" {
+			// exemplars are only part of the OpenMetrics format
+			sample.exemplar = s.exemplar
+		}
+		family.samples = append(family.samples, sample)
+	}
+
+	names := make([]string, 0, len(families))
+	for n := range families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for _, n := range names {
+		family := families[n]
+		typeName := n
+		if family.kind == "counter" && !openMetrics {
+			typeName += "_total"
+		}
+		buf.WriteString("# TYPE " + typeName + " " + family.kind + "\n")
+		lines := make([]string, 0, len(family.samples))
+		for _, s := range family.samples {
+			lines = append(lines, formatPromSample(n, s))
+		}
+		sort.Strings(lines)
+		for _, l := range lines {
+			buf.WriteString(l + "\n")
+		}
+	}
+	if openMetrics {
+		buf.WriteString("# EOF\n")
+	}
+	return buf.Bytes()
+}
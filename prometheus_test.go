@@ -0,0 +1,344 @@
+package spectator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var promSampleLine = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\]|\\.)*",?)*\})? -?[0-9]+(\.[0-9]+)?(e[-+][0-9]+)?( # \{([a-zA-Z_][a-zA-Z0-9_]*="([^"\\]|\\.)*",?)*\} -?[0-9]+(\.[0-9]+)?(e[-+][0-9]+)?)?$`)
+var promTypeLine = regexp.MustCompile(`^# TYPE ([a-zA-Z_:][a-zA-Z0-9_:]*) (counter|gauge|summary)$`)
+
+// checks the output follows the exposition format: each family is declared
+// once, before its samples, and the samples use the names allowed for its type
+func validatePrometheus(t *testing.T, body string, openMetrics bool) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if openMetrics {
+		if lines[len(lines)-1] != "# EOF" {
+			t.Errorf("Expected the output to end with an EOF marker, got:\n%s", body)
+		}
+		lines = lines[:len(lines)-1]
+	}
+
+	declared := map[string]bool{}
+	seen := map[string]bool{}
+	family, kind := "", ""
+	for _, line := range lines {
+		if m := promTypeLine.FindStringSubmatch(line); m != nil {
+			family, kind = m[1], m[2]
+			if kind == "counter" && !openMetrics {
+				if !strings.HasSuffix(family, "_total") {
+					t.Errorf("Counter family without the _total suffix: %q", line)
+				}
+				family = strings.TrimSuffix(family, "_total")
+			}
+			if declared[family] {
+				t.Errorf("Family declared more than once: %q", line)
+			}
+			declared[family] = true
+			continue
+		}
+		m := promSampleLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("Invalid line: %q", line)
+			continue
+		}
+		if family == "" {
+			t.Errorf("Sample without a family: %q", line)
+			continue
+		}
+		var allowed []string
+		switch kind {
+		case "counter":
+			allowed = []string{family + "_total"}
+		case "gauge":
+			allowed = []string{family}
+		case "summary":
+			allowed = []string{family, family + "_sum", family + "_count"}
+		}
+		ok := false
+		for _, name := range allowed {
+			ok = ok || m[1] == name
+		}
+		if !ok {
+			t.Errorf("Sample %q doesn't belong to the %s family %s", line, kind, family)
+		}
+		series := strings.SplitN(line, " ", 2)[0]
+		if seen[series] {
+			t.Errorf("Duplicate series: %q", line)
+		}
+		seen[series] = true
+	}
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	r := NewRegistry(config)
+	r.Counter("server.requestCount", map[string]string{"status.code": "200"}).Add(3)
+	r.Timer("server.requestLatency", nil).Record(2 * time.Second)
+	r.publish()
+
+	w := httptest.NewRecorder()
+	PrometheusHandler(r)(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != prometheusContentType {
+		t.Errorf("Unexpected content-type: %s", ct)
+	}
+
+	body := w.Body.String()
+	validatePrometheus(t, body, false)
+
+	expected := []string{
+		"# TYPE server_requestCount_total counter\n",
+		`server_requestCount_total{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1",status_code="200"} 3` + "\n",
+		"# TYPE server_requestLatency summary\n",
+		`server_requestLatency_count{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1"} 1` + "\n",
+		`server_requestLatency_sum{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1"} 2` + "\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func promOutput(r *Registry) string {
+	w := httptest.NewRecorder()
+	PrometheusHandler(r)(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
+
+func TestPrometheusHandler_Cumulative(t *testing.T) {
+	r := NewRegistry(config)
+	counter := r.Counter("requests", nil)
+	timer := r.Timer("latency", nil)
+	gauge := r.Gauge("connections", nil)
+
+	counter.Add(3)
+	timer.Record(2 * time.Second)
+	gauge.Set(5)
+	r.publish()
+
+	counter.Add(2)
+	timer.Record(500 * time.Millisecond)
+	gauge.Set(1)
+	r.publish()
+
+	// nothing recorded in this interval, the totals are kept
+	gauge.Set(1)
+	r.publish()
+
+	body := promOutput(r)
+	validatePrometheus(t, body, false)
+	tags := `{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1"}`
+	expected := []string{
+		"requests_total" + tags + " 5\n",
+		"latency_count" + tags + " 2\n",
+		"latency_sum" + tags + " 2.5\n",
+		"connections" + tags + " 1\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+
+	// a gauge that wasn't set has no value, like in the export
+	r.RemoveWithId(counter.MeterId())
+	r.publish()
+	body = promOutput(r)
+	if strings.Contains(body, "requests_total") {
+		t.Errorf("Expected removed counters to be dropped, got:\n%s", body)
+	}
+	if strings.Contains(body, "connections") {
+		t.Errorf("Expected gauges without a value to be dropped, got:\n%s", body)
+	}
+}
+
+func TestPrometheusSanitize(t *testing.T) {
+	cases := map[string]string{
+		"foo.bar":     "foo_bar",
+		"foo..bar":    "foo__bar",
+		"foo-_bar":    "foo__bar",
+		"foo__bar":    "foo__bar",
+		"1xx":         "_1xx",
+		"ns:foo.bar":  "ns:foo_bar",
+		"already_ok9": "already_ok9",
+	}
+	for in, expected := range cases {
+		if got := promMetricName(in); got != expected {
+			t.Errorf("promMetricName(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+
+	if got := promLabelName("ns:key"); got != "ns_key" {
+		t.Errorf("Colons are not allowed in label names, got %q", got)
+	}
+
+	labels := promLabels(map[string]string{"a.b": "1", "a_b": "2", "statistic": "count"}, nil)
+	if len(labels) != 1 || labels["a_b"] != "1" {
+		t.Errorf("Expected colliding labels to be deduped, got %v", labels)
+	}
+
+	labels = promLabels(map[string]string{"app": "local"}, map[string]string{"app": "common", "region": "us-east-1"})
+	if labels["app"] != "local" || labels["region"] != "us-east-1" {
+		t.Errorf("Expected meter tags to take precedence over common tags, got %v", labels)
+	}
+}
+
+func TestPrometheusHandler_OtherMeters(t *testing.T) {
+	r := NewRegistry(config)
+	r.BucketCounter("sizes", nil, PowerOfTwoBuckets).Record(100)
+	id := NewId("cache.hitRatio", nil)
+	h := &hitRatio{id, NewCounter(id), NewCounter(id)}
+	h.hits.Increment()
+	r.Register(h)
+	r.publish()
+
+	body := promOutput(r)
+	validatePrometheus(t, body, false)
+	expected := []string{
+		"# TYPE sizes_total counter\n",
+		"# TYPE cache_hitRatio gauge\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusHandler_OpenMetrics(t *testing.T) {
+	r := NewRegistry(config)
+	r.Counter("server.requestCount", nil).Add(3)
+	r.Gauge("server.connections", nil).Set(5)
+	r.publish()
+
+	for _, handler := range []func(*Registry) http.HandlerFunc{PrometheusHandler, HttpHandler} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0,text/plain;q=0.5")
+		handler(r)(w, req)
+
+		if ct := w.Header().Get("Content-Type"); ct != openMetricsContentType {
+			t.Errorf("Unexpected content-type: %s", ct)
+		}
+		body := w.Body.String()
+		validatePrometheus(t, body, true)
+		expected := []string{
+			"# TYPE server_requestCount counter\n",
+			"server_requestCount_total{",
+			"# TYPE server_connections gauge\n",
+		}
+		for _, e := range expected {
+			if !strings.Contains(body, e) {
+				t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+			}
+		}
+		if !strings.HasSuffix(body, "# EOF\n") {
+			t.Errorf("Expected the output to end with an EOF marker, got:\n%s", body)
+		}
+	}
+}
+
+func TestPrometheusHandler_SplitFamilies(t *testing.T) {
+	r := NewRegistry(config)
+	r.clock = &ManualClock{1000}
+	r.IntervalCounter("ic", nil).Increment()
+	r.Counter("name.clash", nil).Increment()
+	r.Gauge("name_clash", nil).Set(2)
+	r.publish()
+
+	body := promOutput(r)
+	validatePrometheus(t, body, false)
+	expected := []string{
+		"# TYPE ic_total counter\n",
+		"ic_total{",
+		"# TYPE ic_duration gauge\n",
+		"ic_duration{",
+		"# TYPE name_clash_total counter\n",
+		"# TYPE name_clash_gauge gauge\n",
+		"name_clash_gauge{",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+}
+
+func TestPrometheusHandler_LongTaskTimer(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{1000}
+	r.clock = clock
+	ltt := r.LongTaskTimer("ltt", nil)
+	ltt.Start()
+	clock.SetFromDuration(3 * time.Second)
+	r.publish()
+
+	body := promOutput(r)
+	validatePrometheus(t, body, false)
+	tags := `{nf_app="test",nf_asg="test-main-v001",nf_cluster="test-main",nf_region="us-west-1"}`
+	expected := []string{
+		"# TYPE ltt_activeTasks gauge\n",
+		"ltt_activeTasks" + tags + " 1\n",
+		"# TYPE ltt_duration gauge\n",
+		"ltt_duration" + tags + " ",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected output to contain %q, got:\n%s", e, body)
+		}
+	}
+	if strings.Contains(body, "# TYPE ltt ") {
+		t.Errorf("Expected no ltt family, got:\n%s", body)
+	}
+}
+
+func TestPrometheusHandler_Accept(t *testing.T) {
+	cases := map[string]bool{
+		"":                                  false,
+		"text/plain":                        false,
+		"application/openmetrics-text":      true,
+		"application/openmetrics-text;q=0":  false,
+		"application/openmetrics-text; q=0": false,
+		"application/openmetrics-text;q=0.5,text/plain":                         false,
+		"application/openmetrics-text;version=1.0.0,text/plain;q=0.5":           true,
+		"text/plain;q=0.9, application/openmetrics-text;version=0.0.1;q=0.9":    true,
+		"application/json;q=0.2,Application/OpenMetrics-Text;version=1.0.0;q=1": true,
+	}
+	for accept, expected := range cases {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.Header.Set("Accept", accept)
+		if got := acceptsOpenMetrics(req); got != expected {
+			t.Errorf("acceptsOpenMetrics(%q) = %v, expected %v", accept, got, expected)
+		}
+	}
+}
+
+func TestPrometheusHandler_Exemplars(t *testing.T) {
+	r := NewRegistry(config)
+	counter := r.Counter("requests", nil)
+	counter.Increment()
+	counter.AddWithExemplar(2, map[string]string{"trace.id": "abc"})
+	r.publish()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text")
+	PrometheusHandler(r)(w, req)
+	body := w.Body.String()
+	validatePrometheus(t, body, true)
+	if !strings.Contains(body, `} 3 # {trace_id="abc"} 2`+"\n") {
+		t.Errorf("Expected the counter to have an exemplar, got:\n%s", body)
+	}
+
+	body = promOutput(r)
+	validatePrometheus(t, body, false)
+	if strings.Contains(body, "trace_id") {
+		t.Errorf("Expected no exemplars in the text format, got:\n%s", body)
+	}
+}
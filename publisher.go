@@ -0,0 +1,179 @@
+package spectator
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Publisher sends measurements to a backend. Set Config.Publisher to use a
+// custom transport: on each publish it's called with batches of at most
+// Config.BatchSize measurements, with the common tags already added to their
+// ids (tags set on the meters win) and the ids normalized unless StrictTags
+// is set. If Publish returns an error, the counter deltas in the batch are
+// kept and added to the next publish.
+type Publisher interface {
+	Publish(measurements []Measurement) error
+}
+
+// atlasPublisher is the default Publisher, posting measurements to the Atlas
+// aggregator at Config.Uri
+type atlasPublisher struct {
+	registry *Registry
+}
+
+// NewAtlasPublisher returns the default publisher of the registry, which
+// posts measurements to Config.Uri. It's meant to be wrapped by custom
+// publishers that only need to add some behavior.
+func NewAtlasPublisher(registry *Registry) Publisher {
+	if registry.root != nil {
+		registry = registry.root
+	}
+	return &atlasPublisher{registry}
+}
+
+func (p *atlasPublisher) payload(measurements []Measurement) []interface{} {
+	return p.registry.measurementsToPayload(measurements)
+}
+
+func (p *atlasPublisher) post(payload []interface{}, numMeasurements int) error {
+	r := p.registry
+	contentType := jsonContentType
+	var body []byte
+	var err error
+	if r.config.PayloadEncoding == EncodingSmile {
+		contentType = smileContentType
+		body, err = smileEncode(payload)
+	} else {
+		body, err = json.Marshal(payload)
+	}
+	if err != nil {
+		r.logPublishError("Unable to encode measurements", "error", err)
+		return &payloadError{err}
+	}
+	return p.send(contentType, body, numMeasurements)
+}
+
+// the buffers JSON payloads are encoded into, reused so each publish doesn't
+// allocate a new multi-megabyte buffer for large registries
+var payloadBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// encodes the measurements as JSON without building the payload first, which
+// keeps the memory used by large registries down, and posts them
+func (p *atlasPublisher) postJson(measurements []Measurement, numMeasurements int) error {
+	r := p.registry
+	buf := payloadBuffers.Get().(*[]byte)
+	body, err := r.measurementsToJson((*buf)[:0], measurements)
+	if err == nil {
+		err = p.send(jsonContentType, body, numMeasurements)
+	} else {
+		r.logPublishError("Unable to encode measurements", "error", err)
+		err = &payloadError{err}
+	}
+	// uncompressed bodies are read by the requests directly, which the http
+	// transport might still do after the response was received
+	if r.http.compresses(body) {
+		*buf = body[:0]
+		payloadBuffers.Put(buf)
+	}
+	return err
+}
+
+// posts the encoded measurements to the aggregators
+func (p *atlasPublisher) send(contentType string, body []byte, numMeasurements int) error {
+	r := p.registry
+	var err error
+	uris := r.config.Uris
+	if len(uris) == 0 {
+		uris = []string{r.config.Uri}
+	}
+	if r.config.FanOut {
+		return p.fanOut(uris, contentType, body, numMeasurements)
+	}
+	for _, uri := range uris {
+		var respBody []byte
+		respBody, err = r.postBody(uri, contentType, body, numMeasurements)
+		p.handleValidationErrors(respBody)
+		// the next aggregator would reject the payload too
+		if !shouldRetry(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// posts the body to all the aggregators. The batch counts as published if
+// any of them accepted it, so the ones that did don't get its deltas twice.
+func (p *atlasPublisher) fanOut(uris []string, contentType string, body []byte, numMeasurements int) error {
+	errs := make(chan error, len(uris))
+	for _, uri := range uris {
+		go func(uri string) {
+			respBody, err := p.registry.postBody(uri, contentType, body, numMeasurements)
+			p.handleValidationErrors(respBody)
+			errs <- err
+		}(uri)
+	}
+	var firstErr error
+	published := false
+	for range uris {
+		if err := <-errs; err == nil {
+			published = true
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if published {
+		return nil
+	}
+	return firstErr
+}
+
+// the response of the aggregator when some measurements are invalid, with a
+// 202 if others were accepted or a 400 if all of them were rejected
+type atlasValidationResponse struct {
+	Type       string   `json:"type"`
+	ErrorCount int      `json:"errorCount"`
+	Message    []string `json:"message"`
+}
+
+// logs the reasons measurements were rejected by the aggregator and counts
+// them in spectator.measurements with id=dropped and error=validation
+func (p *atlasPublisher) handleValidationErrors(respBody []byte) {
+	var resp atlasValidationResponse
+	if len(respBody) == 0 || json.Unmarshal(respBody, &resp) != nil || resp.ErrorCount <= 0 {
+		return
+	}
+	r := p.registry
+	r.logPublishError("Measurements were rejected by the aggregator",
+		"count", resp.ErrorCount, "messages", strings.Join(resp.Message, "; "))
+	r.Counter("spectator.measurements", map[string]string{
+		"id":    "dropped",
+		"error": "validation",
+	}).Add(int64(resp.ErrorCount))
+}
+
+func (p *atlasPublisher) Publish(measurements []Measurement) error {
+	if p.registry.config.PayloadEncoding == EncodingSmile {
+		return p.post(p.payload(measurements), len(measurements))
+	}
+	return p.postJson(measurements, len(measurements))
+}
+
+// returns copies of the measurements with the common tags added to their ids
+func withCommonTags(measurements []Measurement, commonTags map[string]string) []Measurement {
+	if len(commonTags) == 0 {
+		return measurements
+	}
+	tagged := make([]Measurement, len(measurements))
+	for i, m := range measurements {
+		tags := make(map[string]string, len(commonTags)+len(m.id.tags))
+		for k, v := range commonTags {
+			tags[k] = v
+		}
+		for k, v := range m.id.tags {
+			tags[k] = v
+		}
+		tagged[i] = Measurement{NewId(m.id.name, tags), m.value}
+	}
+	return tagged
+}
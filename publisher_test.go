@@ -0,0 +1,207 @@
+package spectator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingPublisher struct {
+	batches [][]Measurement
+	err     error
+}
+
+func (p *recordingPublisher) Publish(measurements []Measurement) error {
+	p.batches = append(p.batches, measurements)
+	return p.err
+}
+
+func TestRegistry_customPublisher(t *testing.T) {
+	publisher := &recordingPublisher{err: errors.New("unavailable")}
+	cfg := makeConfig("http://example.org")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.BatchSize = 1
+	cfg.Publisher = publisher
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Add(3)
+	r.Gauge("temperature", nil).Set(21.5)
+	r.publish()
+
+	if len(publisher.batches) != 2 {
+		t.Fatalf("Expected 2 batches of 1 measurement, got %v", publisher.batches)
+	}
+	for _, batch := range publisher.batches {
+		assertEqual(t, len(batch), 1, "unexpected batch size")
+		assertEqual(t, batch[0].Id().Tags()["nf.app"], "test", "expected the common tags")
+	}
+
+	// the failed counter delta is published again
+	publisher.err = nil
+	publisher.batches = nil
+	r.publish()
+	if len(publisher.batches) != 1 || publisher.batches[0][0].Value() != 3 {
+		t.Errorf("Expected the retained delta, got %v", publisher.batches)
+	}
+}
+
+type countingPublisher struct {
+	Publisher
+	calls int
+}
+
+func (p *countingPublisher) Publish(measurements []Measurement) error {
+	p.calls++
+	return p.Publisher.Publish(measurements)
+}
+
+func TestNewAtlasPublisher(t *testing.T) {
+	var entries []payloadEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries = append(entries, payloadToEntries(t, readPayload(t, r))...)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	r := NewRegistry(cfg)
+	publisher := &countingPublisher{Publisher: NewAtlasPublisher(r)}
+	cfg.Publisher = publisher
+	r.Counter("requests", nil).Add(3)
+	r.publish()
+
+	assertEqual(t, publisher.calls, 1, "expected the wrapper to be called")
+	assertEqual(t, len(entries), 1, "expected the measurement to be posted")
+	assertEqual(t, entries[0].tags["nf.app"], "test", "expected the common tags")
+}
+
+type errorLogger struct {
+	errors []string
+}
+
+func (l *errorLogger) Debug(msg string, keysAndValues ...interface{}) {}
+func (l *errorLogger) Info(msg string, keysAndValues ...interface{})  {}
+func (l *errorLogger) Warn(msg string, keysAndValues ...interface{})  {}
+func (l *errorLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.errors = append(l.errors, withFields(msg, keysAndValues))
+}
+
+func TestAtlasPublisher_ValidationErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(202)
+		w.Write([]byte(`{"type":"partial","errorCount":2,"message":["invalid key: a b","value too long: c"]}`))
+	}))
+	defer server.Close()
+
+	logger := &errorLogger{}
+	cfg := makeConfig(server.URL)
+	cfg.Log = logger
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+	r.publish()
+
+	if publishErr != nil {
+		t.Errorf("Expected a partial success not to be an error, got %v", publishErr)
+	}
+	dropped := r.Counter("spectator.measurements", map[string]string{"id": "dropped", "error": "validation"})
+	assertEqual(t, dropped.Count(), 2.0, "expected the rejected measurements to be counted")
+	if len(logger.errors) != 1 || !strings.Contains(logger.errors[0], "value too long: c") {
+		t.Errorf("Expected the validation messages to be logged, got %v", logger.errors)
+	}
+}
+
+func countingServer(status int, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		w.WriteHeader(status)
+		w.Write(okMsg)
+	}))
+}
+
+func TestAtlasPublisher_Failover(t *testing.T) {
+	var down, up int
+	downServer := countingServer(503, &down)
+	defer downServer.Close()
+	upServer := countingServer(200, &up)
+	defer upServer.Close()
+
+	cfg := makeConfig("")
+	cfg.Uris = []string{downServer.URL, upServer.URL}
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+	r.publish()
+
+	assertEqual(t, down, 1, "expected the first aggregator to be tried")
+	assertEqual(t, up, 1, "expected a failover to the second aggregator")
+	if publishErr != nil {
+		t.Errorf("Expected the failover to succeed, got %v", publishErr)
+	}
+}
+
+func TestAtlasPublisher_FanOut(t *testing.T) {
+	var regional, global, down int
+	regionalServer := countingServer(200, &regional)
+	defer regionalServer.Close()
+	globalServer := countingServer(200, &global)
+	defer globalServer.Close()
+	downServer := countingServer(503, &down)
+	defer downServer.Close()
+
+	cfg := makeConfig("")
+	cfg.Uris = []string{regionalServer.URL, globalServer.URL, downServer.URL}
+	cfg.FanOut = true
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+	r.publish()
+
+	assertEqual(t, regional, 1, "expected the batch to be posted to every aggregator")
+	assertEqual(t, global, 1, "expected the batch to be posted to every aggregator")
+	assertEqual(t, down, 1, "expected the batch to be posted to every aggregator")
+	if publishErr != nil {
+		t.Errorf("Expected the batch to count as published, got %v", publishErr)
+	}
+}
+
+func TestAtlasPublisher_ReusesBuffers(t *testing.T) {
+	var values []map[string]float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		byName := map[string]float64{}
+		for _, e := range payloadToEntries(t, readPayload(t, r)) {
+			byName[e.tags["name"]] = e.value
+		}
+		values = append(values, byName)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	for publish := 1; publish <= 3; publish++ {
+		// large enough to be compressed, so the buffers are pooled
+		for i := 0; i < 50; i++ {
+			r.Counter(fmt.Sprintf("counter.%d", i), nil).Add(int64(publish * i))
+		}
+		r.publish()
+	}
+
+	assertEqual(t, len(values), 3, "expected a request per publish")
+	for publish, byName := range values {
+		for i := 1; i < 50; i++ {
+			name := fmt.Sprintf("counter.%d", i)
+			assertEqual(t, byName[name], float64((publish+1)*i), "unexpected value for "+name)
+		}
+	}
+}
@@ -1,14 +1,18 @@
 package spectator
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"math"
-	"path/filepath"
+	"math/rand"
+	"net/http"
+	"os"
 	"reflect"
-	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,45 +22,329 @@ type Meter interface {
 }
 
 type Config struct {
-	Frequency  time.Duration     `json:"frequency"`
-	Timeout    time.Duration     `json:"timeout"`
-	Uri        string            `json:"uri"`
+	Frequency time.Duration `json:"frequency"`
+	// PublishJitter delays the publishes scheduled by Start by a random
+	// offset of up to that long, chosen when starting, so instances don't all
+	// post at the same time. Publishes otherwise happen on the step
+	// boundaries Atlas expects: multiples of Frequency since the epoch.
+	PublishJitter time.Duration `json:"publish_jitter"`
+	// Timeout limits each publish request, and ConnectTimeout establishing
+	// its connection, 30s by default. PublishTimeout limits a whole publish,
+	// including all its batches and retries: requests still running when it
+	// expires are cancelled and their deltas kept for the next publish. It
+	// defaults to Frequency for the publishes scheduled by Start, so a hung
+	// aggregator can't delay the next one, and for the last one done by Stop.
+	Timeout        time.Duration `json:"timeout"`
+	ConnectTimeout time.Duration `json:"connect_timeout"`
+	PublishTimeout time.Duration `json:"publish_timeout"`
+	// Uri is the endpoint measurements are posted to. It can be a Unix domain
+	// socket, e.g. unix:///run/agent.sock?path=/api/v1/publish, posting to
+	// the request path in the path parameter, / by default.
+	Uri string `json:"uri"`
+	// Uris, if set, replaces Uri with several aggregators. Batches are posted
+	// to the first one, failing over to the next ones after network errors,
+	// throttling or server errors. With FanOut set each batch is posted to all
+	// of them instead, and only counts as failed if none accepted it.
+	Uris   []string `json:"uris"`
+	FanOut bool     `json:"fan_out"`
+	// TLS options for publish requests: TLSCAFile is a PEM bundle of the CAs
+	// to trust instead of the system ones, TLSCertFile and TLSKeyFile a client
+	// certificate for aggregators requiring mutual TLS. TLSConfig, if set, is
+	// used as the base configuration the other options are applied to.
+	TLSCAFile             string      `json:"tls_ca_file"`
+	TLSCertFile           string      `json:"tls_cert_file"`
+	TLSKeyFile            string      `json:"tls_key_file"`
+	TLSInsecureSkipVerify bool        `json:"tls_insecure_skip_verify"`
+	TLSConfig             *tls.Config `json:"-"`
+	// AuthProvider, if set, is called before each publish request for a
+	// header to add to it, e.g. Authorization with a refreshed bearer token
+	// or an API key header. If it fails the request is not sent.
+	AuthProvider func() (headerName string, headerValue string, err error) `json:"-"`
+	// Headers are added to every publish request, e.g. tenant routing
+	// headers. They can't replace the User-Agent, Accept, Content-Type and
+	// Content-Encoding headers set by the client.
+	Headers map[string]string `json:"headers"`
+	// ProxyURL, if set, is the proxy used for publish requests, e.g.
+	// http://proxy.example.org:3128. Otherwise the proxy is taken from the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+	ProxyURL string `json:"proxy_url"`
+	// HTTPClient, if set, sends the publish requests to http and https uris,
+	// e.g. to add tracing. Its timeout is used if set, Timeout otherwise.
+	// Transport instead only replaces the transport of the built-in client.
+	// Either way the TLS and proxy options above are ignored for those uris.
+	HTTPClient *http.Client      `json:"-"`
+	Transport  http.RoundTripper `json:"-"`
+	// BatchSize is the maximum number of measurements sent in each request,
+	// 10,000 by default like the other Spectator clients
 	BatchSize  int               `json:"batch_size"`
 	CommonTags map[string]string `json:"common_tags"`
-	Log        Logger
-	IsEnabled  func() bool
+	// PayloadEncoding is the encoding of the payload posted to Uri,
+	// EncodingJson by default or EncodingSmile, which is smaller and cheaper
+	// to produce for registries with many meters
+	PayloadEncoding string `json:"payload_encoding"`
+	// CompressionEnabled controls whether POST bodies are gzipped, with
+	// Content-Encoding: gzip. Bodies are compressed when it's nil or true,
+	// unless they are under 512 bytes; set it to false for endpoints that
+	// don't accept compressed requests.
+	CompressionEnabled *bool `json:"compression_enabled"`
+	// PublishRetries is the number of times a POST failing with a network
+	// error, a 429 or a 5xx is retried during a publish, none by default.
+	// Retries wait RetryBackoff, 100ms by default, doubling it after each
+	// attempt up to RetryMaxBackoff, 2s by default, with a random jitter of up
+	// to half the wait.
+	PublishRetries  int           `json:"publish_retries"`
+	RetryBackoff    time.Duration `json:"retry_backoff"`
+	RetryMaxBackoff time.Duration `json:"retry_max_backoff"`
+	// SpoolDir, if set, is a directory where the counter deltas that couldn't
+	// be published are saved after each publish, so they survive a restart
+	// during an outage and are sent once the endpoint recovers. Deltas are
+	// merged by id, so the spool only grows with the number of meters; it's
+	// capped at SpoolMaxBytes, 1MiB by default, keeping the largest deltas.
+	SpoolDir      string `json:"spool_dir"`
+	SpoolMaxBytes int64  `json:"spool_max_bytes"`
+	// GaugeFuncTimeout limits how long the function of a gauge registered
+	// with GaugeFunc can take each time it's sampled, 1s by default
+	GaugeFuncTimeout time.Duration `json:"gauge_func_timeout"`
+	// MaxMeters caps the number of distinct meters held by the registry. Zero means no limit.
+	MaxMeters int `json:"max_meters"`
+	// MaxMetersPerName caps the number of tag combinations for a single meter
+	// name. New combinations past the limit are recorded in a single series
+	// tagged spectator.overflow=true. Zero means no limit.
+	MaxMetersPerName int `json:"max_meters_per_name"`
+	// StrictTags rejects meters whose name or tags break the aggregator naming
+	// rules instead of replacing invalid characters and truncating long values.
+	// It's equivalent to setting TagPolicy to TagPolicyReject.
+	StrictTags bool `json:"strict_tags"`
+	// TagPolicy is how meters whose name or tags break the aggregator naming
+	// rules are handled, see TagPolicySanitize, TagPolicyReject and
+	// TagPolicyLogOnce. By default they are sanitized when published.
+	TagPolicy string `json:"tag_policy"`
+	// Filters drop meters and tags before publishing, see Filters. They can
+	// be replaced at runtime by the DynamicConfig.
+	Filters *Filters `json:"filters"`
+	// MeasurementTransformer, if set, is called with each batch of
+	// measurements just before it's encoded, e.g. to rename legacy meters or
+	// convert units. It can modify the measurements in place; the ids it
+	// returns are then sanitized like the others. Sending failures keep the
+	// original deltas, which are transformed again on the next publish.
+	MeasurementTransformer func([]Measurement) []Measurement `json:"-"`
+	// SelfMetrics enables the meters instrumenting the publishing itself, see
+	// self_metrics.go. They are published along with the other meters.
+	SelfMetrics bool `json:"self_metrics"`
+	// MeterTTL, if positive, removes meters that haven't reported any
+	// activity for that long, e.g. 15 * Frequency. Holding on to a meter that
+	// expired is safe, but its updates are not published until it's looked up
+	// again through the registry.
+	MeterTTL time.Duration `json:"meter_ttl"`
+	// StatsdAddress, if set, publishes measurements over UDP to a StatsD
+	// agent at host:port instead of posting them to Uri. StatsdFlavor is
+	// either StatsdFlavor (the default) or DogStatsdFlavor.
+	StatsdAddress string `json:"statsd_address"`
+	StatsdFlavor  string `json:"statsd_flavor"`
+	// SpectatordAddress, if set, publishes measurements to a local spectatord
+	// sidecar, either udp://host:port or unix:///path/to/socket. It takes
+	// precedence over StatsdAddress.
+	SpectatordAddress string `json:"spectatord_address"`
+	// GraphiteAddress, if set, publishes measurements to a Graphite/Carbon
+	// plaintext listener at host:port over TCP. GraphiteNaming maps ids to
+	// metric paths, GraphiteHierarchicalNaming by default. Timeout limits
+	// connecting and each write.
+	GraphiteAddress string           `json:"graphite_address"`
+	GraphiteNaming  func(*Id) string `json:"-"`
+	// OtlpUri, if set, posts measurements to an OpenTelemetry collector using
+	// OTLP/HTTP, e.g. http://localhost:4318/v1/metrics, instead of posting them
+	// to Uri. OtlpProtocol selects the encoding: OtlpProtobuf, the default, or
+	// OtlpJson.
+	OtlpUri      string `json:"otlp_uri"`
+	OtlpProtocol string `json:"otlp_protocol"`
+	// InfluxUri, if set, posts measurements in the InfluxDB line protocol to a
+	// write endpoint in batches of BatchSize, e.g.
+	// http://localhost:8086/write?db=metrics or
+	// http://localhost:8086/api/v2/write?org=o&bucket=b. InfluxFile instead
+	// appends the lines to a file. InfluxPrecision is the precision of the
+	// timestamps, InfluxNanoseconds by default, and is added to the uri unless
+	// it already has a precision parameter.
+	InfluxUri       string `json:"influx_uri"`
+	InfluxFile      string `json:"influx_file"`
+	InfluxPrecision string `json:"influx_precision"`
+	// CloudWatchNamespace, if set, writes measurements to CloudWatchOutput,
+	// stdout by default, using the CloudWatch embedded metric format, for
+	// Lambda and ECS services that can't reach Atlas. All tags become
+	// dimensions unless CloudWatchDimensions lists the tag keys to use; the
+	// others are only kept as properties of the log events.
+	CloudWatchNamespace  string    `json:"cloudwatch_namespace"`
+	CloudWatchDimensions []string  `json:"cloudwatch_dimensions"`
+	CloudWatchOutput     io.Writer `json:"-"`
+	// JsonLinesFile, if set, appends one JSON object per measurement to the
+	// file on each publish, or writes them to stdout if it's -, to debug what
+	// would be published. It works alongside the other destinations and even
+	// if IsEnabled returns false; with no other destination set nothing else
+	// is published.
+	JsonLinesFile string `json:"json_lines_file"`
+	// Disabled turns the registry into a no-op: meters accept all operations
+	// but are never registered, and no publishing goroutine or HTTP client is
+	// created. Useful for CLI tools and tests.
+	Disabled bool `json:"disabled"`
+	// Log receives the messages of the registry, printed to stdout by
+	// default. Publish errors repeated within PublishErrorLogInterval, a
+	// minute by default, are only logged once, along with the number of
+	// repeats suppressed since the last time; a negative interval logs them
+	// all.
+	Log                     Logger        `json:"-"`
+	PublishErrorLogInterval time.Duration `json:"publish_error_log_interval"`
+	IsEnabled               func() bool
+	// Enabled, if set to false, stops publishing like IsEnabled returning
+	// false. Unlike IsEnabled it can be set in a config file and reloaded.
+	Enabled *bool `json:"enabled"`
+	// ReloadInterval, for registries created by NewRegistryConfiguredBy, is
+	// how often the config file is checked for changes while the registry is
+	// started, never by default. The common tags, frequency and enabled flag
+	// of a changed file are applied without restarting.
+	ReloadInterval time.Duration `json:"reload_interval"`
+	// DynamicConfigUri, if set, is polled every DynamicConfigInterval, 60s
+	// by default, for a DynamicConfig document while the registry is
+	// started, so publishing can be stopped or slowed down cluster-wide.
+	// DynamicConfigFunc, if set, is called instead.
+	DynamicConfigUri      string                         `json:"dynamic_config_uri"`
+	DynamicConfigInterval time.Duration                  `json:"dynamic_config_interval"`
+	DynamicConfigFunc     func() (*DynamicConfig, error) `json:"-"`
+	// Publisher, if set, replaces all the other destinations, see Publisher.
+	// The payload passed to OnPublish is then the published measurements.
+	Publisher Publisher `json:"-"`
+	// MaxMeasurementsPerPublish and MaxBytesPerPublish, if positive, limit
+	// the number of measurements sent by each publish, and their estimated
+	// size in an uncompressed Atlas payload. Measurements over the budget
+	// are dropped and counted in spectator.measurements with id=dropped and
+	// error=budget, keeping the current ones over the deltas retained from
+	// failed publishes. The series dropped rotate from one publish to the
+	// next, so none is starved. Nothing is dropped while publishing is
+	// disabled.
+	MaxMeasurementsPerPublish int `json:"max_measurements_per_publish"`
+	MaxBytesPerPublish        int `json:"max_bytes_per_publish"`
+	// CircuitBreakerThreshold, if positive, is the number of consecutive
+	// publishes failing with network errors, throttling or server errors
+	// after which the scheduled publishes are skipped for
+	// CircuitBreakerInterval, a minute by default. The next publish probes
+	// the aggregator, resuming the schedule if it succeeds or pausing it for
+	// another interval if not. Skipped publishes don't measure the meters,
+	// so their deltas are sent once the aggregator recovers.
+	CircuitBreakerThreshold int           `json:"circuit_breaker_threshold"`
+	CircuitBreakerInterval  time.Duration `json:"circuit_breaker_interval"`
+	// OnPublish, if set, is called after each batch is published with the
+	// payload and the result of the POST. It is also called when publishing
+	// is disabled (with a nil error) to show what would have been sent.
+	// Without an external destination, it's called after each interval with
+	// the measurements exposed locally, including their common tags, and a
+	// nil error.
+	OnPublish func(payload []interface{}, err error)
+	// OnPublishComplete, if set, is called after each publish to an external
+	// destination with its result, e.g. to alert on failures or stop
+	// recording while the backend is down.
+	OnPublishComplete func(result PublishResult) `json:"-"`
 }
 
 type Registry struct {
 	clock   Clock
 	config  *Config
-	meters  map[string]Meter
+	meters  *meterMap
 	started bool
-	mutex   *sync.Mutex
-	http    *HttpClient
-	quit    chan struct{}
-	export  map[string]Metric
+	// guards export
+	mutex *sync.RWMutex
+	http  *HttpClient
+	quit  chan struct{}
+	// closed once the publishing goroutine has returned
+	done chan struct{}
+	// the publish frequency in nanoseconds, see SetFrequency
+	frequency int64
+	// wakes the publishing goroutine up when the frequency changes
+	reschedule     chan struct{}
+	lifecycleMutex sync.Mutex
+	// serializes publishes, e.g. by Stop and the publishing goroutine
+	publishMutex sync.Mutex
+	export       map[string]Metric
+	// 1 once the MaxMeters overflow has been logged
+	overflowLogged int32
+	startNanos     int64
+	commonTags     map[string]string
+	tagsMutex      *sync.RWMutex
+	noop           bool
+	pending        map[string]Measurement
+	pendingStarts  map[string]int64
+	pendingMutex   *sync.Mutex
+	// start of the current delta window, the time of the last publish
+	windowStart   int64
+	lastActive    map[string]int64
+	activityMutex *sync.Mutex
+	// the *compiledFilters applied when publishing
+	filters atomic.Value
+	// names of the meters with invalid ids already logged by TagPolicyLogOnce
+	invalidNames *sync.Map
+	// limits how often the same publish error is logged
+	logThrottle *logThrottle
+	// set for views returned by WithTags
+	root      *Registry
+	extraTags map[string]string
+	agent     *linePublisher
+	// the string table of the last Atlas payload
+	stringTable *stringTable
+	// serializes writes to CloudWatchOutput
+	emfMutex sync.Mutex
+	// cumulative values exposed by the PrometheusHandler
+	prometheus *prometheusState
+	// measurements of the last publish, exposed by PublishExpvar
+	published atomic.Value
+	// waits between retries, replaced in tests
+	sleep func(time.Duration)
+	// 1 unless disabled by Config.Enabled or the DynamicConfig
+	enabled        int32
+	dynamicEnabled int32
+	// the file the config was read from and its last applied version, used
+	// by the publishing goroutine to reload it
+	configFile    string
+	configModTime time.Time
+	fileConfig    *Config
+	// the context, retries and first error of the current publish, guarded
+	// by publishMutex
+	publishCtx     context.Context
+	publishRetries int
+	publishErr     error
+	// the measurements sent, bytes posted and last HTTP status of the
+	// current publish, updated atomically since fan out posts concurrently
+	publishSent   int64
+	publishBytes  int64
+	publishStatus int32
+	breaker       circuitBreaker
+	// the id of the first measurement dropped by the last publish over the
+	// budget, where the next one starts, guarded by publishMutex
+	budgetCursor string
 }
 
+// NewRegistryConfiguredBy creates a registry with the Config in filePath, a
+// JSON file, or a YAML or TOML one with the .yaml, .yml or .toml extension.
+// Durations are in seconds, and may be fractional, e.g. 1.5. It returns the
+// error of Config.Validate if the config is invalid.
 func NewRegistryConfiguredBy(filePath string) (*Registry, error) {
-	path := filepath.Clean(filePath)
-	/* #nosec G304 */
-	bytes, err := ioutil.ReadFile(path)
+	info, err := os.Stat(filePath)
 	if err != nil {
 		return nil, err
 	}
-
-	var config Config
-	err = json.Unmarshal(bytes, &config)
+	config, err := readConfigFile(filePath)
 	if err != nil {
 		return nil, err
 	}
-
-	config.Timeout *= time.Second
-	config.Frequency *= time.Second
-	return NewRegistry(&config), nil
+	if !config.Disabled {
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	r := NewRegistry(config)
+	r.configFile, r.configModTime, r.fileConfig = filePath, info.ModTime(), config
+	return r, nil
 }
 
+// NewRegistry creates a registry with the given config. Since it can't return
+// an error, an invalid config, as reported by Config.Validate, is only logged,
+// and the registry is created anyway.
 func NewRegistry(config *Config) *Registry {
 	if config.IsEnabled == nil {
 		config.IsEnabled = func() bool { return true }
@@ -65,21 +353,75 @@ func NewRegistry(config *Config) *Registry {
 		config.Log = defaultLogger()
 	}
 
-	r := &Registry{&SystemClock{}, config, map[string]Meter{}, false,
-		&sync.Mutex{}, nil, make(chan struct{}), map[string]Metric{}}
+	clock := &SystemClock{}
+	now := clock.Nanos()
+	r := &Registry{
+		clock:          clock,
+		config:         config,
+		meters:         newMeterMap(),
+		mutex:          &sync.RWMutex{},
+		quit:           make(chan struct{}),
+		frequency:      int64(config.Frequency),
+		reschedule:     make(chan struct{}, 1),
+		export:         map[string]Metric{},
+		startNanos:     now,
+		windowStart:    now,
+		commonTags:     map[string]string{},
+		tagsMutex:      &sync.RWMutex{},
+		pending:        map[string]Measurement{},
+		pendingStarts:  map[string]int64{},
+		pendingMutex:   &sync.Mutex{},
+		lastActive:     map[string]int64{},
+		activityMutex:  &sync.Mutex{},
+		invalidNames:   &sync.Map{},
+		logThrottle:    newLogThrottle(),
+		prometheus:     newPrometheusState(),
+		stringTable:    newStringTable(),
+		sleep:          time.Sleep,
+		enabled:        1,
+		dynamicEnabled: 1,
+	}
+	for k, v := range config.CommonTags {
+		r.commonTags[k] = v
+	}
+	if config.Enabled != nil && !*config.Enabled {
+		r.enabled = 0
+	}
+	if config.Disabled {
+		r.noop = true
+		return r
+	}
+	if err := config.Validate(); err != nil {
+		config.Log.Error("Invalid configuration", "error", err)
+	}
+	// invalid filters were reported by Validate
+	_ = r.setFilters(config.Filters)
 	r.http = NewHttpClient(r, r.config.Timeout)
+	agent, err := newLinePublisher(config, r.clock)
+	if err != nil {
+		config.Log.Error("Invalid local agent configuration", "error", err)
+	}
+	r.agent = agent
+	if config.SpoolDir != "" {
+		r.loadSpool()
+	}
+	if err := validateInfluxPrecision(config.InfluxPrecision); err != nil {
+		config.Log.Error("Invalid InfluxDB configuration", "error", err)
+	}
 	return r
 }
 
-func (r *Registry) Meters() []Meter {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
+// NewNoopRegistry returns a registry whose meters accept all operations but
+// are never registered or published. Start, Stop and publishing do nothing.
+// It's equivalent to a registry created with Config.Disabled set.
+func NewNoopRegistry() *Registry {
+	return NewRegistry(&Config{Disabled: true})
+}
 
-	meters := make([]Meter, 0, len(r.meters))
-	for _, m := range r.meters {
-		meters = append(meters, m)
-	}
-	return meters
+// Meters returns a snapshot of the registered meters. Meters created or
+// removed concurrently may or may not be included.
+func (r *Registry) Meters() []Meter {
+	return r.meters.values()
 }
 
 func (r *Registry) Clock() Clock {
@@ -90,41 +432,124 @@ func (r *Registry) SetLogger(logger Logger) {
 	r.config.Log = logger
 }
 
+// SetCommonTag adds or updates a tag applied to all measurements on
+// subsequent publishes. Tags set on a meter take precedence over common tags
+// with the same key.
+func (r *Registry) SetCommonTag(key string, value string) {
+	r.tagsMutex.Lock()
+	defer r.tagsMutex.Unlock()
+	r.commonTags[key] = value
+}
+
+// RemoveCommonTag removes a tag from the common tags applied on subsequent publishes
+func (r *Registry) RemoveCommonTag(key string) {
+	r.tagsMutex.Lock()
+	defer r.tagsMutex.Unlock()
+	delete(r.commonTags, key)
+}
+
+// CommonTags returns a copy of the tags currently applied to all measurements
+func (r *Registry) CommonTags() map[string]string {
+	r.tagsMutex.RLock()
+	defer r.tagsMutex.RUnlock()
+	tags := make(map[string]string, len(r.commonTags))
+	for k, v := range r.commonTags {
+		tags[k] = v
+	}
+	return tags
+}
+
 func (r *Registry) GetExport() map[string]Metric {
+	if r.root != nil {
+		return r.root.GetExport()
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
 	return r.export
 }
 
 func (r *Registry) SetExport(e map[string]Metric) {
+	if r.root != nil {
+		r.root.SetExport(e)
+		return
+	}
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 	r.export = e
 }
 
 func (r *Registry) Start() error {
+	return r.StartWithContext(context.Background())
+}
+
+// StartWithContext starts publishing like Start, and stops the registry once
+// ctx is done, publishing the measurements recorded since the last publish.
+// That last publish happens in the background: to wait for it call Stop,
+// which returns once it's done.
+func (r *Registry) StartWithContext(ctx context.Context) error {
+	if r.root != nil {
+		return r.root.StartWithContext(ctx)
+	}
+	if r.noop {
+		return nil
+	}
 	if r.config == nil {
-		err := fmt.Sprintf("registry config does not exist. Ignoring Start request")
-		r.config.Log.Infof(err)
-		return fmt.Errorf(err)
+		return fmt.Errorf("registry config does not exist. Ignoring Start request")
+	}
+	if frequency := r.Frequency(); frequency <= 0 {
+		r.config.Log.Error("Invalid frequency, it must be positive. Ignoring Start request", "frequency", frequency)
+		return fmt.Errorf("invalid frequency %v, it must be positive. Ignoring Start request", frequency)
 	}
+	r.lifecycleMutex.Lock()
+	defer r.lifecycleMutex.Unlock()
 	if r.started {
-		err := fmt.Sprintf("registry has already started. Ignoring Start request")
-		r.config.Log.Infof(err)
-		return fmt.Errorf(err)
+		r.config.Log.Info("Registry has already started. Ignoring Start request")
+		return fmt.Errorf("registry has already started. Ignoring Start request")
 	}
 
 	r.started = true
-	r.quit = make(chan struct{})
-	ticker := time.NewTicker(r.config.Frequency)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	r.quit, r.done = quit, done
+	offset := r.publishOffset()
+	timer := time.NewTimer(untilNextPublish(time.Now().UnixNano(), r.Frequency(), offset))
+	if r.config.DynamicConfigUri != "" || r.config.DynamicConfigFunc != nil {
+		go r.pollDynamicConfig(quit)
+	}
 	go func() {
+		defer close(done)
+		var reload <-chan time.Time
+		if r.configFile != "" && r.config.ReloadInterval > 0 {
+			reloadTicker := time.NewTicker(r.config.ReloadInterval)
+			defer reloadTicker.Stop()
+			reload = reloadTicker.C
+		}
+		ctxDone := ctx.Done()
 		for {
 			select {
-			case <-ticker.C:
+			case <-reload:
+				r.reloadConfig()
+			case <-timer.C:
 				// send measurements
-				r.config.Log.Debugf("Sending measurements")
-				r.publish()
-			case <-r.quit:
-				ticker.Stop()
-				r.config.Log.Infof("Send last updates and quit")
+				r.scheduledPublish()
+				timer.Reset(untilNextPublish(time.Now().UnixNano(), r.Frequency(), offset))
+			case <-r.reschedule:
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				offset = r.publishOffset()
+				timer.Reset(untilNextPublish(time.Now().UnixNano(), r.Frequency(), offset))
+			case <-ctxDone:
+				ctxDone = nil
+				r.config.Log.Info("Context done, stopping the registry")
+				// Stop waits for this goroutine to return
+				go r.Stop()
+			case <-quit:
+				timer.Stop()
+				r.config.Log.Info("Send last updates and quit")
 				return
 			}
 		}
@@ -133,11 +558,115 @@ func (r *Registry) Start() error {
 	return nil
 }
 
+// returns a random offset of up to PublishJitter, less than Frequency, for
+// the publishes of this instance
+func (r *Registry) publishOffset() time.Duration {
+	jitter := r.config.PublishJitter
+	if frequency := r.Frequency(); jitter >= frequency {
+		jitter = frequency - 1
+	}
+	if jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(jitter) + 1))
+}
+
+// Frequency returns how often the measurements are published, Config.Frequency
+// unless changed with SetFrequency
+func (r *Registry) Frequency() time.Duration {
+	if r.root != nil {
+		return r.root.Frequency()
+	}
+	return time.Duration(atomic.LoadInt64(&r.frequency))
+}
+
+// SetFrequency changes how often the measurements are published without
+// restarting the registry, e.g. to publish less often during an aggregator
+// incident. The next publish is rescheduled to the next step boundary of
+// the new frequency.
+func (r *Registry) SetFrequency(frequency time.Duration) error {
+	if r.root != nil {
+		return r.root.SetFrequency(frequency)
+	}
+	if frequency <= 0 {
+		return fmt.Errorf("invalid frequency %v, it must be positive", frequency)
+	}
+	atomic.StoreInt64(&r.frequency, int64(frequency))
+	select {
+	case r.reschedule <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// returns the time left until the next step boundary, a multiple of
+// frequency since the epoch, shifted by offset
+func untilNextPublish(nowNanos int64, frequency time.Duration, offset time.Duration) time.Duration {
+	step := int64(frequency)
+	next := (nowNanos-int64(offset))/step*step + step + int64(offset)
+	return time.Duration(next - nowNanos)
+}
+
+// Stop stops the publishing goroutine and publishes the measurements recorded
+// since the last publish, returning once that's done or PublishTimeout, by
+// default Frequency, has elapsed.
 func (r *Registry) Stop() {
-	close(r.quit)
-	r.started = false
+	if r.root != nil {
+		r.root.Stop()
+		return
+	}
+	if r.noop {
+		return
+	}
+	r.stopPublishing()
 	// flush metrics
-	r.publish()
+	r.publishWithin(r.publishTimeout())
+}
+
+// stops the publishing goroutine, if any, and waits for it to return
+func (r *Registry) stopPublishing() {
+	r.lifecycleMutex.Lock()
+	if r.started {
+		close(r.quit)
+		r.started = false
+	}
+	done := r.done
+	r.lifecycleMutex.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// retries of the publish done by PublishAndClose if PublishRetries is not set
+const defaultCloseRetries = 3
+
+// PublishAndClose is meant for short-lived processes like CLI tools, which
+// record measurements without calling Start, so no goroutine publishes in
+// the background, and call it once before exiting. It stops the publishing
+// goroutine if there's one, publishes all the measurements recorded,
+// retrying failed requests PublishRetries times, 3 by default, and closes
+// the idle connections. It returns the first error found, like Flush.
+func (r *Registry) PublishAndClose() error {
+	if r.root != nil {
+		return r.root.PublishAndClose()
+	}
+	if r.noop {
+		return nil
+	}
+	r.stopPublishing()
+	retries := r.config.PublishRetries
+	if retries <= 0 {
+		retries = defaultCloseRetries
+	}
+	ctx := context.Background()
+	if r.config.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.PublishTimeout)
+		defer cancel()
+	}
+	err := r.publishWithRetries(ctx, retries)
+	r.http.closeIdleConnections()
+	return err
 }
 
 func shouldSendMeasurement(measurement Measurement) bool {
@@ -149,87 +678,609 @@ func shouldSendMeasurement(measurement Measurement) bool {
 	return isGauge || v > 0
 }
 
+// drops the infinite values, e.g. of a gauge set to math.Inf(1), which no
+// external backend accepts and would make the whole batch fail to encode.
+// They are counted in spectator.measurements with id=dropped and
+// error=nonFinite. NaN values never get here: gauges use them to mean that
+// no value was set, and they're skipped like unchanged counters.
+func (r *Registry) withoutNonFinite(measurements []Measurement) []Measurement {
+	filtered := measurements[:0]
+	dropped := 0
+	for _, m := range measurements {
+		if math.IsInf(m.value, 0) {
+			r.config.Log.Debug("Dropping an infinite value", "id", m.id)
+			dropped++
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+	if dropped > 0 {
+		r.Counter("spectator.measurements", map[string]string{
+			"id":    "dropped",
+			"error": "nonFinite",
+		}).Add(int64(dropped))
+	}
+	return filtered
+}
+
+// counts a negative value dropped by a counter, timer or distribution summary
+func (r *Registry) droppedNegative() {
+	r.Counter("spectator.measurements", map[string]string{
+		"id":    "dropped",
+		"error": "negativeValue",
+	}).Increment()
+}
+
+// Measurements returns the measurements of all registered meters that should
+// be published. The meters are measured without holding the registry lock.
 func (r *Registry) Measurements() []Measurement {
 	var measurements []Measurement
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	for _, meter := range r.meters {
+	for _, meter := range r.Meters() {
+		active := false
 		for _, measure := range meter.Measure() {
 			if shouldSendMeasurement(measure) {
 				measurements = append(measurements, measure)
+				active = true
 			}
 		}
+		if active {
+			r.markActive(meter.MeterId().mapKey())
+		}
 	}
 	return measurements
 }
 
-func (r *Registry) sendBatch(measurements []Measurement) {
-	r.config.Log.Debugf("Sending %d measurements to %s", len(measurements), r.config.Uri)
-	jsonBytes, err := r.measurementsToJson(measurements)
-	if err != nil {
-		r.config.Log.Errorf("Unable to convert measurements to json: %v", err)
+// records that the meter with the given key was updated since the last publish
+func (r *Registry) markActive(key string) {
+	if r.config.MeterTTL <= 0 {
+		return
+	}
+	r.activityMutex.Lock()
+	r.lastActive[key] = r.clock.Nanos()
+	r.activityMutex.Unlock()
+}
+
+// removes the meters that have been inactive for longer than MeterTTL
+func (r *Registry) expireMeters() {
+	if r.config.MeterTTL <= 0 {
+		return
+	}
+	cutoff := r.clock.Nanos() - r.config.MeterTTL.Nanoseconds()
+	var expired []string
+	r.activityMutex.Lock()
+	for key, last := range r.lastActive {
+		if last < cutoff {
+			expired = append(expired, key)
+		}
+	}
+	r.activityMutex.Unlock()
+	if len(expired) == 0 {
+		return
+	}
+
+	var removed []Meter
+	for _, key := range expired {
+		if meter, exists := r.removeMeter(key, nil); exists {
+			r.config.Log.Debug("Expiring inactive meter", "id", meter.MeterId())
+			removed = append(removed, meter)
+		}
+	}
+	r.retainRemoved(removed)
+}
+
+func (r *Registry) sendBatch(measurements []Measurement, windows deltaWindows, enabled bool) {
+	normalized, release := r.pooledNormalized(measurements)
+	defer release()
+	var payload []interface{}
+	var err error
+	switch {
+	case r.config.Publisher != nil:
+		published := withCommonTags(normalized, r.CommonTags())
+		payload = make([]interface{}, len(published))
+		for i, m := range published {
+			payload[i] = m
+		}
+		if enabled {
+			err = r.config.Publisher.Publish(published)
+		}
+	case r.config.OtlpUri != "":
+		request := measurementsToOtlp(normalized, r.CommonTags(), windows, r.clock.Nanos())
+		payload = []interface{}{request}
+		if enabled {
+			err = r.postOtlp(request, len(measurements))
+		}
+	case r.config.CloudWatchNamespace != "":
+		payload = measurementsToEmf(normalized, r.CommonTags(), r.config.CloudWatchNamespace,
+			r.config.CloudWatchDimensions, r.clock.Nanos()/int64(time.Millisecond))
+		if enabled {
+			err = r.writeEmf(payload, len(measurements))
+		}
+	case r.publishesToInflux():
+		payload = r.influxPayload(normalized)
+		if enabled {
+			err = r.writeInflux(payload, len(measurements))
+		}
+	default:
+		atlas := &atlasPublisher{r}
+		if r.config.OnPublish == nil && r.config.PayloadEncoding != EncodingSmile {
+			// nothing needs the payload, encode the measurements directly
+			if enabled {
+				err = atlas.postJson(normalized, len(measurements))
+			}
+			break
+		}
+		payload = atlas.payload(normalized)
+		if enabled {
+			err = atlas.post(payload, len(measurements))
+		}
+	}
+	if shouldRetry(err) {
+		r.retainDeltas(measurements, windows)
+	}
+	if enabled && err == nil {
+		r.recordSent(len(measurements))
+	}
+	r.recordPublishError(err)
+	r.notifyPublish(payload, err)
+}
+
+func (r *Registry) postOtlp(request otlpRequest, numMeasurements int) error {
+	var err error
+	if r.config.OtlpProtocol == OtlpJson {
+		_, err = r.postPayload(r.config.OtlpUri, request, numMeasurements)
 	} else {
-		var status int
-		status, err = r.http.PostJson(r.config.Uri, jsonBytes)
-		if status != 200 || err != nil {
-			r.config.Log.Errorf("Could not POST measurements: HTTP %d %v", status, err)
+		_, err = r.postBody(r.config.OtlpUri, "application/x-protobuf", request.marshalProto(), numMeasurements)
+	}
+	return err
+}
+
+// the copies of the measurements made by pooledNormalized
+var measurementSlices = sync.Pool{New: func() interface{} { return new([]Measurement) }}
+
+// like normalized, but copies the measurements into a pooled slice when no
+// user code can keep a reference to it. The returned function puts the slice
+// back once the batch has been sent.
+func (r *Registry) pooledNormalized(measurements []Measurement) ([]Measurement, func()) {
+	if r.config.Publisher != nil || r.config.MeasurementTransformer != nil || r.tagPolicy() == TagPolicyReject {
+		return r.normalized(measurements), func() {}
+	}
+	pooled := measurementSlices.Get().(*[]Measurement)
+	normalized := normalizeMeasurements(append((*pooled)[:0], measurements...))
+	return normalized, func() {
+		*pooled = normalized[:0]
+		measurementSlices.Put(pooled)
+	}
+}
+
+// returns the measurements to send, transformed by the
+// MeasurementTransformer and with their ids normalized unless invalid ids are
+// rejected. The measurements passed in are not modified, so their ids can
+// still be used to retain the deltas if sending fails.
+func (r *Registry) normalized(measurements []Measurement) []Measurement {
+	transform := r.config.MeasurementTransformer
+	reject := r.tagPolicy() == TagPolicyReject
+	if reject && transform == nil {
+		return measurements
+	}
+	normalized := make([]Measurement, len(measurements))
+	copy(normalized, measurements)
+	if transform != nil {
+		normalized = transform(normalized)
+	}
+	if reject {
+		return normalized
+	}
+	return normalizeMeasurements(normalized)
+}
+
+// whether measurements are sent to an agent (statsd, spectatord or graphite)
+func (r *Registry) publishesExternally() bool {
+	return r.publishesToBackend() || r.config.JsonLinesFile != ""
+}
+
+func (r *Registry) publishesToBackend() bool {
+	return r.config.Publisher != nil || r.config.Uri != "" || len(r.config.Uris) > 0 || r.config.OtlpUri != "" || r.publishesToInflux() ||
+		r.config.CloudWatchNamespace != "" || r.publishesToAgent()
+}
+
+func (r *Registry) publishesToInflux() bool {
+	return r.config.InfluxUri != "" || r.config.InfluxFile != ""
+}
+
+func (r *Registry) publishesToAgent() bool {
+	if r.config.Publisher != nil {
+		return false
+	}
+	return r.config.StatsdAddress != "" || r.config.SpectatordAddress != "" || r.config.GraphiteAddress != ""
+}
+
+func (r *Registry) sendToAgent(measurements []Measurement, windows deltaWindows, enabled bool) {
+	if r.agent == nil {
+		// the agent configuration is invalid, which was logged when creating the registry
+		return
+	}
+	payload := r.agent.payload(r.normalized(measurements), r.CommonTags())
+	var err error
+	if enabled {
+		var sent int
+		sent, err = r.agent.send(payload)
+		r.recordSent(sent)
+		if err != nil {
+			r.logPublishError("Could not send measurements to the local agent", "error", err)
+			r.retainDeltas(measurements[sent:], windows)
 		}
 	}
+	r.recordPublishError(err)
+	r.notifyPublish(payload, err)
 }
 
-func (r *Registry) publish() {
-	if r.config.Uri == "" {
-		// internal publish
-		r.SetExport(Convert(r))
+// the start of the delta window of each measurement in a publish: the time of
+// the previous publish, or an earlier time for deltas retained from a failed
+// one
+type deltaWindows struct {
+	start int64
+	// starts of the retained deltas by id
+	starts map[string]int64
+}
+
+func (w deltaWindows) startOf(m Measurement) int64 {
+	if start, exists := w.starts[m.id.mapKey()]; exists {
+		return start
+	}
+	return w.start
+}
+
+// keeps the deltas from a batch we failed to send so they're included in the
+// next publish, along with the start of their window. Measurements using the
+// max op are not retained since a newer value will be available next time.
+func (r *Registry) retainDeltas(measurements []Measurement, windows deltaWindows) {
+	if r.root != nil {
+		r.root.retainDeltas(measurements, windows)
 		return
 	}
-	// external publish
-	measurements := r.Measurements()
-	r.config.Log.Debugf("Got %d measurements", len(measurements))
-	if !r.config.IsEnabled() {
+	r.pendingMutex.Lock()
+	defer r.pendingMutex.Unlock()
+	for _, m := range measurements {
+		if opFromTags(m.id.tags) != addOp {
+			continue
+		}
+		key := m.id.mapKey()
+		start := windows.startOf(m)
+		if p, exists := r.pending[key]; exists {
+			m.value += p.value
+			if pendingStart := r.pendingStarts[key]; pendingStart < start {
+				start = pendingStart
+			}
+		}
+		r.pending[key] = m
+		r.pendingStarts[key] = start
+	}
+}
+
+// merges any deltas retained from a failed publish into the given measurements
+func (r *Registry) withPendingDeltas(measurements []Measurement) ([]Measurement, map[string]int64) {
+	r.pendingMutex.Lock()
+	pending, starts := r.pending, r.pendingStarts
+	r.pending, r.pendingStarts = map[string]Measurement{}, map[string]int64{}
+	r.pendingMutex.Unlock()
+	if len(pending) == 0 {
+		return measurements, nil
+	}
+
+	for i, m := range measurements {
+		key := m.id.mapKey()
+		if p, exists := pending[key]; exists && opFromTags(m.id.tags) == addOp {
+			measurements[i].value += p.value
+			delete(pending, key)
+		}
+	}
+	for _, p := range pending {
+		measurements = append(measurements, p)
+	}
+	return measurements, starts
+}
+
+func (r *Registry) postPayload(uri string, payload interface{}, numMeasurements int) ([]byte, error) {
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		r.logPublishError("Unable to convert measurements to json", "error", err)
+		return nil, &payloadError{err}
+	}
+	return r.postBody(uri, jsonContentType, jsonBytes, numMeasurements)
+}
+
+const (
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 2 * time.Second
+)
+
+// posts the body, retrying transient failures as configured, and returns the
+// body of the last response
+func (r *Registry) postBody(uri string, contentType string, body []byte, numMeasurements int) ([]byte, error) {
+	backoff := r.config.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	maxBackoff := r.config.RetryMaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
+	}
+	ctx := r.publishContext()
+	deadline, _ := ctx.Deadline()
+	for attempt := 0; ; attempt++ {
+		respBody, err := r.postOnce(uri, contentType, body, numMeasurements)
+		if attempt >= r.publishRetries || !shouldRetry(err) || ctx.Err() != nil {
+			return respBody, err
+		}
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if !deadline.IsZero() && time.Now().Add(wait).After(deadline) {
+			r.config.Log.Info("Not retrying the POST past the publish deadline", "uri", uri)
+			return respBody, err
+		}
+		r.config.Log.Info("Retrying the POST", "uri", uri, "wait", wait)
+		r.sleep(wait)
+		backoff *= 2
+	}
+}
+
+func (r *Registry) postOnce(uri string, contentType string, body []byte, numMeasurements int) ([]byte, error) {
+	r.config.Log.Debug("Sending measurements", "count", numMeasurements, "uri", uri)
+	r.recordPayloadBytes(len(body))
+	status, respBody, err := r.http.post(r.publishContext(), uri, contentType, body)
+	if status > 0 {
+		atomic.StoreInt32(&r.publishStatus, int32(status))
+	}
+	if status/100 != 2 || err != nil {
+		r.logPublishError("Could not POST measurements", "uri", uri, "status", status, "error", err)
+		if err == nil {
+			err = &httpStatusError{status}
+		}
+	}
+	return respBody, err
+}
+
+// a payload that can't be encoded, which would fail again if retried
+type payloadError struct {
+	err error
+}
+
+func (e *payloadError) Error() string {
+	return e.err.Error()
+}
+
+// an unexpected HTTP status returned when posting measurements
+type httpStatusError struct {
+	status int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status %d", e.status)
+}
+
+// returns whether a failed post should be retried and its deltas sent again:
+// after network errors, timeouts, throttling and server errors. Other 4xx
+// statuses mean the payload was rejected and would be rejected again.
+func shouldRetry(err error) bool {
+	switch e := err.(type) {
+	case nil, *payloadError:
+		return false
+	case *httpStatusError:
+		return e.status == http.StatusTooManyRequests || e.status >= 500
+	default:
+		return true
+	}
+}
+
+// invokes the OnPublish callback, if any, making sure a panic in user code
+// does not kill the publishing goroutine
+func (r *Registry) notifyPublish(payload []interface{}, err error) {
+	if r.config.OnPublish == nil {
 		return
 	}
+	defer func() {
+		if p := recover(); p != nil {
+			r.config.Log.Error("OnPublish callback panicked", "panic", p)
+		}
+	}()
+	r.config.OnPublish(payload, err)
+}
 
-	for i := 0; i < len(measurements); i += r.config.BatchSize {
-		end := i + r.config.BatchSize
-		if end > len(measurements) {
-			end = len(measurements)
+// PublishResult describes a publish, see Config.OnPublishComplete
+type PublishResult struct {
+	// Measurements is the number of measurements sent, not counting the
+	// ones in failed batches
+	Measurements int
+	// Bytes is the size of the bodies posted, including retries
+	Bytes    int64
+	Duration time.Duration
+	// Status is the HTTP status of the last response, 0 if the destination
+	// isn't HTTP or no response was received
+	Status int
+	// Err is the first error of the publish, nil if it succeeded
+	Err error
+}
+
+// records the latency of the publish started at start and invokes the
+// OnPublishComplete callback, if any, making sure a panic in user code does
+// not kill the publishing goroutine
+func (r *Registry) publishComplete(start time.Time) {
+	r.recordPublishLatency(start)
+	if r.config.OnPublishComplete == nil {
+		return
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			r.config.Log.Error("OnPublishComplete callback panicked", "panic", p)
 		}
-		r.sendBatch(measurements[i:end])
+	}()
+	r.config.OnPublishComplete(PublishResult{
+		Measurements: int(atomic.LoadInt64(&r.publishSent)),
+		Bytes:        atomic.LoadInt64(&r.publishBytes),
+		Duration:     time.Since(start),
+		Status:       int(atomic.LoadInt32(&r.publishStatus)),
+		Err:          r.publishErr,
+	})
+}
+
+// logs a publish error, unless the same message was already logged less than
+// PublishErrorLogInterval ago
+func (r *Registry) logPublishError(msg string, keysAndValues ...interface{}) {
+	interval := r.config.PublishErrorLogInterval
+	if interval == 0 {
+		interval = defaultPublishErrorLogInterval
+	}
+	logged, suppressed := r.logThrottle.allow(msg, r.clock.Nanos(), interval)
+	if !logged {
+		return
+	}
+	if suppressed > 0 {
+		keysAndValues = append(keysAndValues, "suppressed", suppressed)
+	}
+	r.config.Log.Error(msg, keysAndValues...)
+}
+
+// keeps the first error of the current publish, returned by Flush
+func (r *Registry) recordPublishError(err error) {
+	if err == nil {
+		return
+	}
+	r.countPublishError(err)
+	if r.publishErr == nil {
+		r.publishErr = err
+	}
+}
+
+func (r *Registry) publishTimeout() time.Duration {
+	if r.config.PublishTimeout > 0 {
+		return r.config.PublishTimeout
+	}
+	return r.Frequency()
+}
+
+// returns the context of the current publish, cancelling its requests once
+// it's done
+func (r *Registry) publishContext() context.Context {
+	if r.publishCtx == nil {
+		return context.Background()
+	}
+	return r.publishCtx
+}
+
+func (r *Registry) publish() {
+	r.publishWithin(r.config.PublishTimeout)
+}
+
+// publishes, cancelling the requests still running once timeout has elapsed,
+// or without a deadline if it's 0
+func (r *Registry) publishWithin(timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	r.publishWithContext(ctx)
+}
+
+// Flush publishes the measurements recorded since the last publish right
+// away, e.g. before a short-lived job or a Lambda function returns, waiting
+// for the publish to finish or ctx to be done. It returns the first error
+// found, in which case the counter deltas are kept for the next publish.
+func (r *Registry) Flush(ctx context.Context) error {
+	return r.publishWithContext(ctx)
 }
 
-func (r *Registry) buildStringTable(payload *[]interface{}, measurements []Measurement) map[string]int {
-	var strings = make(map[string]int)
-	commonTags := r.config.CommonTags
-	for k, v := range commonTags {
-		strings[k] = 0
-		strings[v] = 0
+func (r *Registry) publishWithContext(ctx context.Context) error {
+	if r.root != nil {
+		return r.root.publishWithContext(ctx)
 	}
+	if r.noop {
+		return nil
+	}
+	return r.publishWithRetries(ctx, r.config.PublishRetries)
+}
+
+func (r *Registry) publishWithRetries(ctx context.Context, retries int) error {
+	r.publishMutex.Lock()
+	defer r.publishMutex.Unlock()
+	r.publishCtx, r.publishRetries, r.publishErr = ctx, retries, nil
+	atomic.StoreInt64(&r.publishSent, 0)
+	atomic.StoreInt64(&r.publishBytes, 0)
+	atomic.StoreInt32(&r.publishStatus, 0)
+	r.publishMeasurements()
+	r.recordPublishOutcome(r.publishErr)
+	r.publishCtx = nil
+	return r.publishErr
+}
 
-	strings["name"] = 0
-	for _, measure := range measurements {
-		strings[measure.id.name] = 0
-		for k, v := range measure.id.tags {
-			strings[k] = 0
-			strings[v] = 0
+func (r *Registry) publishMeasurements() {
+	defer r.syncSpool()
+	defer r.expireMeters()
+	if !r.publishesExternally() {
+		// internal publish
+		meters := r.measureMeters()
+		commonTags := r.CommonTags()
+		var measurements []Measurement
+		for _, m := range meters {
+			measurements = append(measurements, m.measurements...)
+		}
+		r.setLastPublished(measurements)
+		r.SetExport(convertMeasurements(meters, commonTags))
+		r.prometheus.update(meters, commonTags)
+		if r.config.OnPublish != nil {
+			published := withCommonTags(measurements, commonTags)
+			payload := make([]interface{}, len(published))
+			for i, m := range published {
+				payload[i] = m
+			}
+			r.notifyPublish(payload, nil)
 		}
+		return
+	}
+	// external publish
+	defer r.publishComplete(time.Now())
+	measurements := r.Measurements()
+	r.setLastPublished(measurements)
+	measurements = r.currentFilters().apply(r.withoutNonFinite(measurements))
+	windows := deltaWindows{start: atomic.SwapInt64(&r.windowStart, r.clock.Nanos())}
+	r.config.Log.Debug("Got measurements", "count", len(measurements))
+	if r.config.JsonLinesFile != "" {
+		r.writeJsonLines(r.normalized(measurements))
+		if !r.publishesToBackend() {
+			return
+		}
+	}
+	enabled := r.config.IsEnabled() && atomic.LoadInt32(&r.enabled) == 1 && atomic.LoadInt32(&r.dynamicEnabled) == 1
+	if !enabled && r.config.OnPublish == nil {
+		return
 	}
-	sortedStrings := make([]string, 0, len(strings))
-	for s := range strings {
-		sortedStrings = append(sortedStrings, s)
+	if enabled {
+		measurements, windows.starts = r.withPendingDeltas(measurements)
+		measurements = r.withinBudget(measurements, windows)
 	}
-	sort.Strings(sortedStrings)
-	for i, s := range sortedStrings {
-		strings[s] = i
+	if r.publishesToAgent() {
+		r.sendToAgent(measurements, windows, enabled)
+		return
 	}
-	*payload = append(*payload, len(strings))
-	// can't append the strings in one call since we can't convert []string to []interface{}
-	for _, s := range sortedStrings {
-		*payload = append(*payload, s)
+
+	batchSize := r.batchSize()
+	for i := 0; i < len(measurements); i += batchSize {
+		end := i + batchSize
+		if end > len(measurements) {
+			end = len(measurements)
+		}
+		r.sendBatch(measurements[i:end], windows, enabled)
 	}
+}
 
-	return strings
+func (r *Registry) batchSize() int {
+	if r.config.BatchSize > 0 {
+		return r.config.BatchSize
+	}
+	return defaultBatchSize
 }
 
 const (
@@ -246,54 +1297,296 @@ func opFromTags(tags map[string]string) int {
 	}
 }
 
-func (r *Registry) appendMeasurement(payload *[]interface{}, strings map[string]int, m Measurement) {
-	op := opFromTags(m.id.tags)
-	commonTags := r.config.CommonTags
-	*payload = append(*payload, len(m.id.tags)+1+len(commonTags))
-	for k, v := range commonTags {
-		*payload = append(*payload, strings[k])
-		*payload = append(*payload, strings[v])
+func (r *Registry) measurementsToPayload(measurements []Measurement) []interface{} {
+	table := r.stringTable
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.update(measurements, r.CommonTags())
+
+	size := len(table.header)
+	encoded := make([][]int, len(measurements))
+	for i, m := range measurements {
+		encoded[i] = table.encodedTags(m)
+		size += len(encoded[i]) + 1
 	}
-	for k, v := range m.id.tags {
-		*payload = append(*payload, strings[k])
-		*payload = append(*payload, strings[v])
+	payload := make([]interface{}, 0, size)
+	payload = append(payload, table.header...)
+	for i, m := range measurements {
+		for _, index := range encoded[i] {
+			payload = append(payload, index)
+		}
+		payload = append(payload, m.value)
 	}
-	*payload = append(*payload, strings["name"])
-	*payload = append(*payload, strings[m.id.name])
-	*payload = append(*payload, op)
-	*payload = append(*payload, m.value)
+	return payload
 }
 
-func (r *Registry) measurementsToJson(measurements []Measurement) ([]byte, error) {
-	var payload []interface{}
-	strings := r.buildStringTable(&payload, measurements)
-	for _, m := range measurements {
-		r.appendMeasurement(&payload, strings, m)
+// appends the measurements encoded as an Atlas JSON payload to b, like
+// json.Marshal(measurementsToPayload(measurements)) but without building the
+// intermediate payload
+func (r *Registry) measurementsToJson(b []byte, measurements []Measurement) ([]byte, error) {
+	table := r.stringTable
+	table.mutex.Lock()
+	defer table.mutex.Unlock()
+	table.update(measurements, r.CommonTags())
+	return table.appendJson(b, measurements)
+}
+
+type MeterFactoryFun func() Meter
+
+const registryOverflowName = "spectator.registryOverflow"
+
+// records an attempt to create a meter past the MaxMeters limit
+func (r *Registry) overflow(id *Id) {
+	overflowId := NewId(registryOverflowName, nil)
+	// the overflow counter itself is registered regardless of the limit
+	meter, _, _ := r.meters.getOrAdd(overflowId, 0, func() Meter {
+		return NewCounter(overflowId)
+	})
+	if c, ok := meter.(*Counter); ok {
+		c.Increment()
 	}
 
-	return json.Marshal(payload)
+	owner := r
+	if r.root != nil {
+		owner = r.root
+	}
+	if atomic.CompareAndSwapInt32(&owner.overflowLogged, 0, 1) {
+		r.config.Log.Warn("Registry has reached the limit of meters. Dropping new meters",
+			"maxMeters", r.config.MaxMeters, "id", id)
+	}
 }
 
-type MeterFactoryFun func() Meter
+// WithTags returns a view of the registry that adds the given tags to every
+// meter created through it. Tags set on the meter itself take precedence.
+// The view shares its meters and configuration with the parent registry, and
+// starting or stopping it starts or stops the parent.
+func (r *Registry) WithTags(tags map[string]string) *Registry {
+	root := r
+	if r.root != nil {
+		root = r.root
+	}
+	view := &Registry{
+		clock:         r.clock,
+		config:        root.config,
+		meters:        root.meters,
+		mutex:         root.mutex,
+		http:          root.http,
+		startNanos:    root.startNanos,
+		commonTags:    root.commonTags,
+		tagsMutex:     root.tagsMutex,
+		noop:          root.noop,
+		lastActive:    root.lastActive,
+		activityMutex: root.activityMutex,
+		invalidNames:  root.invalidNames,
+		logThrottle:   root.logThrottle,
+		root:          root,
+		extraTags:     make(map[string]string, len(r.extraTags)+len(tags)),
+		agent:         root.agent,
+		prometheus:    root.prometheus,
+		stringTable:   root.stringTable,
+	}
+	for k, v := range r.extraTags {
+		view.extraTags[k] = v
+	}
+	for k, v := range tags {
+		view.extraTags[k] = v
+	}
+	return view
+}
+
+func (r *Registry) withExtraTags(id *Id) *Id {
+	if len(r.extraTags) == 0 {
+		return id
+	}
+	tags := make(map[string]string, len(r.extraTags)+len(id.tags))
+	for k, v := range r.extraTags {
+		tags[k] = v
+	}
+	for k, v := range id.tags {
+		tags[k] = v
+	}
+	return NewId(id.name, tags)
+}
+
+// returns whether the id has all the tags added by the view
+func (r *Registry) hasExtraTags(id *Id) bool {
+	for k, v := range r.extraTags {
+		if id.tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the id to use for a new meter created through the registry helpers
+func (r *Registry) resolveId(id *Id) *Id {
+	id = r.withExtraTags(id)
+	if r.tagPolicy() == TagPolicySanitize {
+		id = normalizeId(id)
+	}
+	return r.limitCardinality(id)
+}
+
+const overflowTagKey = "spectator.overflow"
+
+// limitCardinality returns the id to use for a new meter, replacing it with
+// the overflow series for its name once MaxMetersPerName is reached
+func (r *Registry) limitCardinality(id *Id) *Id {
+	if r.config.MaxMetersPerName <= 0 {
+		return id
+	}
+	// the count can be exceeded by a few meters created concurrently
+	if _, exists := r.meters.get(id); exists || r.meters.nameCount(id.name) < r.config.MaxMetersPerName {
+		return id
+	}
+	r.config.Log.Debug("Meter has reached the limit of tag combinations, using the overflow series",
+		"name", id.name, "maxMetersPerName", r.config.MaxMetersPerName, "id", id)
+	return NewId(id.name, map[string]string{overflowTagKey: "true"})
+}
 
+// NewMeter returns the meter registered with the given id, creating it with
+// meterFactory if needed. It is safe for concurrent use, including while the
+// registry is publishing: callers racing to create the same meter all get
+// the same instance, and meterFactory is called at most once for it.
 func (r *Registry) NewMeter(id *Id, meterFactory MeterFactoryFun) Meter {
-	r.mutex.Lock()
-	defer r.mutex.Unlock()
-	meter, exists := r.meters[id.mapKey()]
-	if !exists {
-		meter = meterFactory()
-		r.meters[id.mapKey()] = meter
+	key := id.mapKey()
+	if meter, exists := r.meters.get(id); exists {
+		return meter
+	}
+
+	if r.noop {
+		return meterFactory()
+	}
+	if r.tagPolicy() == TagPolicyReject && !isValidId(id) {
+		r.config.Log.Debug("Dropping meter with invalid name or tags", "id", id)
+		r.Counter(invalidTagsName, nil).Increment()
+		return meterFactory()
+	}
+
+	meter, added, full := r.meters.getOrAdd(id, r.config.MaxMeters, meterFactory)
+	if full {
+		// the meter is still usable by the caller, but since it's not
+		// registered it will never be published
+		r.overflow(id)
+		return meter
+	}
+	if added {
+		r.markActive(key)
+		if r.tagPolicy() == TagPolicyLogOnce && !isValidId(id) {
+			if _, logged := r.invalidNames.LoadOrStore(id.name, true); !logged {
+				r.config.Log.Error("Meter breaks the naming rules, its name and tags will be sanitized when published", "id", id)
+			}
+		}
 	}
 	return meter
 }
 
+// removes the meter registered with the key, if it's the given meter or the
+// given meter is nil. Must be followed by retainRemoved for the removed meter.
+func (r *Registry) removeMeter(key string, meter Meter) (Meter, bool) {
+	removed, exists := r.meters.remove(key, meter)
+	if exists {
+		r.forgetActivity(key)
+	}
+	return removed, exists
+}
+
+func (r *Registry) forgetActivity(key string) {
+	r.activityMutex.Lock()
+	delete(r.lastActive, key)
+	r.activityMutex.Unlock()
+}
+
+// keeps any unpublished deltas of removed meters so they're sent on the next
+// publish. Meters are measured without holding the lock since gauge functions
+// can take a while.
+func (r *Registry) retainRemoved(meters []Meter) {
+	var final []Measurement
+	for _, meter := range meters {
+		for _, m := range meter.Measure() {
+			if shouldSendMeasurement(m) {
+				final = append(final, m)
+			}
+		}
+	}
+	// removed meters hold deltas of the current window
+	root := r
+	if r.root != nil {
+		root = r.root
+	}
+	r.retainDeltas(final, deltaWindows{start: atomic.LoadInt64(&root.windowStart)})
+}
+
+// RemoveWithId removes the meter with the given id from the registry so it's
+// no longer published. Any delta recorded since the last publish is still
+// sent on the next one. Returns whether a meter was removed.
+func (r *Registry) RemoveWithId(id *Id) bool {
+	key := r.withExtraTags(id).mapKey()
+	meter, exists := r.removeMeter(key, nil)
+	if exists {
+		r.retainRemoved([]Meter{meter})
+	}
+	return exists
+}
+
+func (r *Registry) Remove(name string, tags map[string]string) bool {
+	return r.RemoveWithId(NewId(name, tags))
+}
+
+// UnregisterMeter removes the given meter from the registry, for meters
+// created for ephemeral entities that should stop being published once the
+// entity goes away. Unlike RemoveWithId, it does nothing if a different meter
+// is registered with the same id. Returns whether the meter was removed.
+//
+// Meters don't reference the registries they are registered with, so there's
+// no Delete method on the meters themselves: use UnregisterMeter, or Remove
+// with the name and tags.
+func (r *Registry) UnregisterMeter(meter Meter) bool {
+	registered, exists := r.removeMeter(meter.MeterId().mapKey(), meter)
+	if !exists {
+		return false
+	}
+	r.retainRemoved([]Meter{registered})
+	return true
+}
+
+// RemoveAll removes all meters with the given name, regardless of their tags.
+// On a view returned by WithTags only the meters with the tags of the view are
+// removed. Returns the number of meters removed.
+func (r *Registry) RemoveAll(name string) int {
+	removed := r.meters.removeIf(func(meter Meter) bool {
+		return meter.MeterId().name == name && r.hasExtraTags(meter.MeterId())
+	})
+	for _, meter := range removed {
+		r.forgetActivity(meter.MeterId().mapKey())
+	}
+	r.retainRemoved(removed)
+	return len(removed)
+}
+
+// Register adds a custom meter to the registry so its measurements are
+// published and exported along with the built-in meters. It returns an error
+// if a different meter is already registered with the same id.
+func (r *Registry) Register(meter Meter) error {
+	m := r.NewMeter(meter.MeterId(), func() Meter {
+		return meter
+	})
+	if m != meter {
+		return fmt.Errorf("a meter %v is already registered with id=%v", m, meter.MeterId())
+	}
+	return nil
+}
+
 func (r *Registry) NewId(name string, tags map[string]string) *Id {
-	return NewId(name, tags)
+	return r.withExtraTags(NewId(name, tags))
 }
 
 func (r *Registry) CounterWithId(id *Id) *Counter {
+	id = r.resolveId(id)
 	m := r.NewMeter(id, func() Meter {
-		return NewCounter(id)
+		c := NewCounter(id)
+		c.onNegative = r.droppedNegative
+		return c
 	})
 
 	c, ok := m.(*Counter)
@@ -301,7 +1594,7 @@ func (r *Registry) CounterWithId(id *Id) *Counter {
 		return c
 	}
 
-	r.config.Log.Errorf("Unable to register a counter with id=%v - a meter %v exists", id, c)
+	r.config.Log.Error("Unable to register a counter, another meter has the same id", "id", id, "meter", c)
 
 	// should throw in strict mode
 	return NewCounter(id)
@@ -311,9 +1604,62 @@ func (r *Registry) Counter(name string, tags map[string]string) *Counter {
 	return r.CounterWithId(NewId(name, tags))
 }
 
+func (r *Registry) IntervalCounterWithId(id *Id) *IntervalCounter {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewIntervalCounter(id, r.clock, r.startNanos)
+	})
+
+	c, ok := m.(*IntervalCounter)
+	if ok {
+		return c
+	}
+
+	r.config.Log.Error("Unable to register an interval counter, another meter has the same id", "id", id, "meter", c)
+
+	// throw in strict mode
+	return NewIntervalCounter(id, r.clock, r.startNanos)
+}
+
+func (r *Registry) IntervalCounter(name string, tags map[string]string) *IntervalCounter {
+	return r.IntervalCounterWithId(NewId(name, tags))
+}
+
+func (r *Registry) MonotonicCounterWithId(id *Id) *MonotonicCounter {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return newMonotonicCounter(id)
+	})
+
+	c, ok := m.(*MonotonicCounter)
+	if ok {
+		return c
+	}
+
+	r.config.Log.Error("Unable to register a monotonic counter, another meter has the same id", "id", id, "meter", c)
+
+	// throw in strict mode
+	return newMonotonicCounter(id)
+}
+
+func (r *Registry) MonotonicCounter(name string, tags map[string]string) *MonotonicCounter {
+	return r.MonotonicCounterWithId(NewId(name, tags))
+}
+
+func (r *Registry) BucketCounterWithId(id *Id, bucketFunc BucketFunction) *BucketCounter {
+	return NewBucketCounterWithId(r, id, bucketFunc)
+}
+
+func (r *Registry) BucketCounter(name string, tags map[string]string, bucketFunc BucketFunction) *BucketCounter {
+	return r.BucketCounterWithId(NewId(name, tags), bucketFunc)
+}
+
 func (r *Registry) TimerWithId(id *Id) *Timer {
+	id = r.resolveId(id)
 	m := r.NewMeter(id, func() Meter {
-		return NewTimer(id)
+		t := newTimerWithClock(id, r.clock)
+		t.onNegative = r.droppedNegative
+		return t
 	})
 
 	t, ok := m.(*Timer)
@@ -321,7 +1667,7 @@ func (r *Registry) TimerWithId(id *Id) *Timer {
 		return t
 	}
 
-	r.config.Log.Errorf("Unable to register a timer with %v - a meter %v exists", id, t)
+	r.config.Log.Error("Unable to register a timer, another meter has the same id", "id", id, "meter", t)
 
 	// throw in strict mode
 	return NewTimer(id)
@@ -331,7 +1677,37 @@ func (r *Registry) Timer(name string, tags map[string]string) *Timer {
 	return r.TimerWithId(NewId(name, tags))
 }
 
+func (r *Registry) LongTaskTimerWithId(id *Id) *LongTaskTimer {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewLongTaskTimer(id, r.clock)
+	})
+
+	t, ok := m.(*LongTaskTimer)
+	if ok {
+		return t
+	}
+
+	r.config.Log.Error("Unable to register a long task timer, another meter has the same id", "id", id, "meter", t)
+
+	// throw in strict mode
+	return NewLongTaskTimer(id, r.clock)
+}
+
+func (r *Registry) LongTaskTimer(name string, tags map[string]string) *LongTaskTimer {
+	return r.LongTaskTimerWithId(NewId(name, tags))
+}
+
+func (r *Registry) BucketTimerWithId(id *Id, bucketFunc BucketFunction) *BucketTimer {
+	return NewBucketTimerWithId(r, id, bucketFunc)
+}
+
+func (r *Registry) BucketTimer(name string, tags map[string]string, bucketFunc BucketFunction) *BucketTimer {
+	return r.BucketTimerWithId(NewId(name, tags), bucketFunc)
+}
+
 func (r *Registry) GaugeWithId(id *Id) *Gauge {
+	id = r.resolveId(id)
 	m := r.NewMeter(id, func() Meter {
 		return NewGauge(id)
 	})
@@ -341,7 +1717,7 @@ func (r *Registry) GaugeWithId(id *Id) *Gauge {
 		return g
 	}
 
-	r.config.Log.Errorf("Unable to register a gauge with id=%v - a meter %v exists", id, g)
+	r.config.Log.Error("Unable to register a gauge, another meter has the same id", "id", id, "meter", g)
 
 	// throw in strict mode
 	return NewGauge(id)
@@ -351,9 +1727,100 @@ func (r *Registry) Gauge(name string, tags map[string]string) *Gauge {
 	return r.GaugeWithId(NewId(name, tags))
 }
 
+func (r *Registry) GaugeWithIdAndTTL(id *Id, ttl time.Duration) *Gauge {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewGaugeWithTTL(id, r.clock, ttl)
+	})
+
+	g, ok := m.(*Gauge)
+	if ok {
+		return g
+	}
+
+	r.config.Log.Error("Unable to register a gauge, another meter has the same id", "id", id, "meter", g)
+
+	// throw in strict mode
+	return NewGaugeWithTTL(id, r.clock, ttl)
+}
+
+// GaugeWithTTL returns a gauge that reports its last value on every publish
+// until it hasn't been updated for ttl
+func (r *Registry) GaugeWithTTL(name string, tags map[string]string, ttl time.Duration) *Gauge {
+	return r.GaugeWithIdAndTTL(NewId(name, tags), ttl)
+}
+
+func (r *Registry) MaxGaugeWithId(id *Id) *MaxGauge {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewMaxGauge(id)
+	})
+
+	g, ok := m.(*MaxGauge)
+	if ok {
+		return g
+	}
+
+	r.config.Log.Error("Unable to register a max gauge, another meter has the same id", "id", id, "meter", g)
+
+	// throw in strict mode
+	return NewMaxGauge(id)
+}
+
+func (r *Registry) MaxGauge(name string, tags map[string]string) *MaxGauge {
+	return r.MaxGaugeWithId(NewId(name, tags))
+}
+
+func (r *Registry) GaugeFuncWithId(id *Id, valueFn func() float64) *FuncGauge {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewFuncGauge(r, id, valueFn)
+	})
+
+	g, ok := m.(*FuncGauge)
+	if ok {
+		return g
+	}
+
+	r.config.Log.Error("Unable to register a function gauge, another meter has the same id", "id", id, "meter", g)
+
+	// throw in strict mode
+	return NewFuncGauge(r, id, valueFn)
+}
+
+// GaugeFunc registers a gauge whose value is computed by calling valueFn
+// each time the registry is published
+func (r *Registry) GaugeFunc(name string, tags map[string]string, valueFn func() float64) *FuncGauge {
+	return r.GaugeFuncWithId(NewId(name, tags), valueFn)
+}
+
+func (r *Registry) AgeGaugeWithId(id *Id) *AgeGauge {
+	id = r.resolveId(id)
+	m := r.NewMeter(id, func() Meter {
+		return NewAgeGauge(id, r.clock, r.startNanos)
+	})
+
+	g, ok := m.(*AgeGauge)
+	if ok {
+		return g
+	}
+
+	r.config.Log.Error("Unable to register an age gauge, another meter has the same id", "id", id, "meter", g)
+
+	// throw in strict mode
+	return NewAgeGauge(id, r.clock, r.startNanos)
+}
+
+func (r *Registry) AgeGauge(name string, tags map[string]string) *AgeGauge {
+	return r.AgeGaugeWithId(NewId(name, tags))
+}
+
 func (r *Registry) DistributionSummaryWithId(id *Id) *DistributionSummary {
+	id = r.resolveId(id)
 	m := r.NewMeter(id, func() Meter {
-		return NewDistributionSummary(id)
+		d := NewDistributionSummary(id)
+		d.onNegative = r.droppedNegative
+		return d
 	})
 
 	d, ok := m.(*DistributionSummary)
@@ -361,7 +1828,7 @@ func (r *Registry) DistributionSummaryWithId(id *Id) *DistributionSummary {
 		return d
 	}
 
-	r.config.Log.Errorf("Unable to register a distribution summary with id=%v - a meter %v exists", id, d)
+	r.config.Log.Error("Unable to register a distribution summary, another meter has the same id", "id", id, "meter", d)
 
 	// throw in strict mode
 	return NewDistributionSummary(id)
@@ -371,31 +1838,64 @@ func (r *Registry) DistributionSummary(name string, tags map[string]string) *Dis
 	return r.DistributionSummaryWithId(NewId(name, tags))
 }
 
+// the measurements taken from a meter in one publish, including the ones
+// that are not sent because they're zero or NaN
+type meterMeasurements struct {
+	meter        Meter
+	kind         string
+	measurements []Measurement
+}
+
+// measures all registered meters, recording which ones were active
+func (r *Registry) measureMeters() []meterMeasurements {
+	meters := r.Meters()
+	result := make([]meterMeasurements, 0, len(meters))
+	for _, meter := range meters {
+		ms := meter.Measure()
+		for _, m := range ms {
+			if shouldSendMeasurement(m) {
+				r.markActive(meter.MeterId().mapKey())
+				break
+			}
+		}
+		kind := reflect.TypeOf(meter).Elem().Name()
+		result = append(result, meterMeasurements{meter, kind, ms})
+	}
+	return result
+}
+
 func Convert(r *Registry) map[string]Metric {
 	// Take a Registry, convert and return all internal measurements in a format for export
+	return convertMeasurements(r.measureMeters(), r.CommonTags())
+}
 
+func convertMeasurements(meters []meterMeasurements, ctags map[string]string) map[string]Metric {
 	// modifier contains logic for value modification based on meter kind and statistic
-	modifier := func(kind string, statistic string, val int) int {
-		if kind == "Timer" && statistic != "count" {
-			// If its a timer and statistic of totalTime, totalOfSquares, or max
-			// then we need to convert from seconds to nanoseconds
-			return val * time.Now().Nanosecond()
+	modifier := func(kind string, statistic string, val float64) float64 {
+		if kind != "Timer" && kind != "QuantileTimer" {
+			return val
+		}
+		// timers record seconds, but the export uses nanoseconds
+		switch statistic {
+		case "count":
+			return val
+		case "totalOfSquares":
+			return val * 1e18
+		default:
+			return val * 1e9
 		}
-		return val
 	}
 
 	data := map[string]Metric{}
-	ctags := r.config.CommonTags
-
-	for _, meter := range r.meters {
-		kind := reflect.TypeOf(meter).Elem().Name()
+	for _, mm := range meters {
+		kind := mm.kind
 
-		for _, measurement := range meter.Measure() {
+		for _, measurement := range mm.measurements {
 			if shouldSendMeasurement(measurement) {
 				name := measurement.Id().Name()
 				ts := time.Now().UnixNano() / int64(time.Millisecond)
 				tags := measurement.Id().Tags()
-				value := modifier(kind, tags["statistic"], int(measurement.Value()))
+				value := modifier(kind, tags["statistic"], measurement.Value())
 
 				topval := TopValue{
 					Tags: []Tag{},
@@ -408,7 +1908,9 @@ func Convert(r *Registry) map[string]Metric {
 					topval.Tags = append(topval.Tags, Tag{Key: k, Value: v})
 				}
 				for k, v := range ctags {
-					topval.Tags = append(topval.Tags, Tag{Key: k, Value: v})
+					if _, local := tags[k]; !local {
+						topval.Tags = append(topval.Tags, Tag{Key: k, Value: v})
+					}
 				}
 
 				// Append the topval to either an existing metric or a new one
@@ -0,0 +1,222 @@
+package spectator
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Benchmarks of the hot paths: updating meters, looking them up in the
+// registry and encoding the publish payload. Compare runs with benchstat to
+// catch regressions, e.g.
+//
+//	go test -run XXX -bench . -benchmem -count 10 > new.txt
+//
+// TestHotPathAllocs fails the regular test run if a hot path starts
+// allocating.
+
+func BenchmarkCounter_Increment(b *testing.B) {
+	c := getCounter("bench")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Increment()
+		}
+	})
+}
+
+func BenchmarkCounter_AddFloat(b *testing.B) {
+	c := getCounter("bench")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.AddFloat(1)
+		}
+	})
+}
+
+func BenchmarkTimer_Record(b *testing.B) {
+	t := NewTimer(NewId("bench", nil))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			t.Record(42 * time.Millisecond)
+		}
+	})
+}
+
+func BenchmarkDistributionSummary_Record(b *testing.B) {
+	d := NewDistributionSummary(NewId("bench", nil))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			d.Record(1024)
+		}
+	})
+}
+
+func BenchmarkGauge_Set(b *testing.B) {
+	g := NewGauge(NewId("bench", nil))
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g.Set(42)
+		}
+	})
+}
+
+func BenchmarkRegistry_Counter(b *testing.B) {
+	r := NewRegistry(makeConfig(""))
+	tags := map[string]string{"status": "200", "method": "GET"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Counter("requests", tags).Increment()
+	}
+}
+
+func BenchmarkRegistry_CounterWithCachedId(b *testing.B) {
+	r := NewRegistry(makeConfig(""))
+	id := NewId("requests", map[string]string{"status": "200", "method": "GET"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.CounterWithId(id).Increment()
+	}
+}
+
+var benchmarkTags = []map[string]string{
+	{"status": "200", "method": "GET"},
+	{"status": "200", "method": "POST"},
+	{"status": "404", "method": "GET"},
+	{"status": "500", "method": "GET"},
+}
+
+// looks up existing counters from many goroutines, like per-request code
+// calling Counter(name, tags). Compare with the single shard variant to see
+// the effect of striping the meters.
+func benchmarkCounterLookup(b *testing.B, meters *meterMap) {
+	r := NewRegistry(makeConfig(""))
+	r.meters = meters
+	names := make([]string, 64)
+	for i := range names {
+		names[i] = fmt.Sprintf("requests.%d", i)
+		for _, tags := range benchmarkTags {
+			r.Counter(names[i], tags)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			r.Counter(names[i%len(names)], benchmarkTags[i%len(benchmarkTags)]).Increment()
+			i++
+		}
+	})
+}
+
+func BenchmarkRegistry_CounterLookup(b *testing.B) {
+	benchmarkCounterLookup(b, newMeterMap())
+}
+
+func BenchmarkRegistry_CounterLookupSingleShard(b *testing.B) {
+	benchmarkCounterLookup(b, newShardedMeterMap(1))
+}
+
+// creates new meters from many goroutines, which takes the write locks
+func benchmarkMeterCreation(b *testing.B, meters *meterMap) {
+	var n int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := NewId(fmt.Sprint(atomic.AddInt64(&n, 1)), nil)
+			meters.getOrAdd(id, 0, func() Meter { return NewCounter(id) })
+		}
+	})
+}
+
+func BenchmarkMeterMap_Creation(b *testing.B) {
+	benchmarkMeterCreation(b, newMeterMap())
+}
+
+func BenchmarkMeterMap_CreationSingleShard(b *testing.B) {
+	benchmarkMeterCreation(b, newShardedMeterMap(1))
+}
+
+// returns the measurements of a registry with the given number of meters
+func benchmarkMeasurements(n int) []Measurement {
+	ms := make([]Measurement, 0, n)
+	for i := 0; i < n; i++ {
+		tags := map[string]string{"statistic": "count", "instance": fmt.Sprint(i % 100)}
+		ms = append(ms, Measurement{NewId(fmt.Sprintf("meter.%d", i/100), tags), float64(i)})
+	}
+	return ms
+}
+
+// encodes the JSON payload the way publishes do when OnPublish isn't set
+func BenchmarkPayload_Json(b *testing.B) {
+	r := NewRegistry(makeConfig(""))
+	ms := benchmarkMeasurements(10000)
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = r.measurementsToJson(buf[:0], ms)
+	}
+}
+
+// builds the payload and encodes it, as publishes do when OnPublish is set
+func BenchmarkPayload_Marshal(b *testing.B) {
+	r := NewRegistry(makeConfig(""))
+	ms := benchmarkMeasurements(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(r.measurementsToPayload(ms)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPayload_Smile(b *testing.B) {
+	r := NewRegistry(makeConfig(""))
+	ms := benchmarkMeasurements(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := smileEncode(r.measurementsToPayload(ms)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestHotPathAllocs(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	id := NewId("requests", map[string]string{"status": "200"})
+	c := r.CounterWithId(id)
+	timerId := NewId("latency", map[string]string{"status": "200"})
+	timer := r.TimerWithId(timerId)
+	summary := r.DistributionSummary("size", nil)
+	gauge := r.Gauge("queue", nil)
+	ms := benchmarkMeasurements(100)
+	buf, _ := r.measurementsToJson(nil, ms)
+	checks := map[string]struct {
+		f         func()
+		maxAllocs float64
+	}{
+		"Counter.Increment":          {func() { c.Increment() }, 0},
+		"Timer.Record":               {func() { timer.Record(time.Millisecond) }, 0},
+		"DistributionSummary.Record": {func() { summary.Record(1024) }, 0},
+		"Gauge.Set":                  {func() { gauge.Set(42) }, 0},
+		"CounterWithId":              {func() { r.CounterWithId(id) }, 0},
+		"TimerWithId":                {func() { r.TimerWithId(timerId) }, 0},
+		"measurementsToJson":         {func() { r.measurementsToJson(buf[:0], ms) }, 2},
+	}
+	for name, check := range checks {
+		if allocs := testing.AllocsPerRun(100, check.f); allocs > check.maxAllocs {
+			t.Errorf("Expected %s to allocate at most %v times, got %v", name, check.maxAllocs, allocs)
+		}
+	}
+}
@@ -1,27 +1,36 @@
 package spectator
 
 import (
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func makeConfig(uri string) *Config {
-	return &Config{10 * time.Millisecond, 1 * time.Second, uri, 10000,
-		map[string]string{
+	return &Config{
+		Frequency: 10 * time.Millisecond,
+		Timeout:   1 * time.Second,
+		Uri:       uri,
+		BatchSize: 10000,
+		CommonTags: map[string]string{
 			"nf.app":     "test",
 			"nf.cluster": "test-main",
 			"nf.asg":     "test-main-v001",
 			"nf.region":  "us-west-1",
 		},
-		nil,
-		nil,
 	}
 }
 
@@ -34,13 +43,12 @@ func TestNewRegistryConfiguredBy(t *testing.T) {
 	}
 
 	expectedConfig := Config{
-		5 * time.Second,
-		1 * time.Second,
-		"http://example.org/api/v4/update",
-		10000,
-		map[string]string{"nf.app": "app", "nf.account": "1234"},
-		defaultLogger(),
-		nil,
+		Frequency:  5 * time.Second,
+		Timeout:    1 * time.Second,
+		Uri:        "http://example.org/api/v4/update",
+		BatchSize:  10000,
+		CommonTags: map[string]string{"nf.app": "app", "nf.account": "1234"},
+		Log:        defaultLogger(),
 	}
 	cfg := r.config
 	cfg.IsEnabled = nil
@@ -97,6 +105,313 @@ func TestRegistry_Start(t *testing.T) {
 	r.Stop()
 }
 
+func TestUntilNextPublish(t *testing.T) {
+	now := int64(61500 * time.Millisecond)
+	assertEqual(t, untilNextPublish(now, time.Minute, 0), 58500*time.Millisecond, "expected the next minute")
+	assertEqual(t, untilNextPublish(now, time.Minute, 2*time.Second), 500*time.Millisecond, "expected the offset")
+	assertEqual(t, untilNextPublish(int64(time.Minute), time.Minute, 0), time.Minute, "expected the following step")
+}
+
+func TestRegistry_publishOffset(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.Frequency = time.Second
+	r := NewRegistry(cfg)
+	assertEqual(t, r.publishOffset(), time.Duration(0), "expected no offset without jitter")
+
+	cfg.PublishJitter = time.Hour
+	for i := 0; i < 100; i++ {
+		if offset := r.publishOffset(); offset < 0 || offset >= time.Second {
+			t.Fatalf("Expected the offset to be capped at the frequency, got %v", offset)
+		}
+	}
+}
+
+func TestRegistry_SetFrequency(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.Frequency = time.Hour
+	r := NewRegistry(cfg)
+	if err := r.SetFrequency(0); err == nil {
+		t.Error("Expected an error for a zero frequency")
+	}
+	r.Start()
+	defer r.Stop()
+	r.Counter("foo", nil).Increment()
+	if err := r.SetFrequency(10 * time.Millisecond); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	assertEqual(t, r.Frequency(), 10*time.Millisecond, "expected the new frequency")
+	for i := 0; i < 100 && atomic.LoadInt32(&requests) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&requests) == 0 {
+		t.Error("Expected the publish to be rescheduled with the new frequency")
+	}
+}
+
+func TestRegistry_StartWithContext(t *testing.T) {
+	var mutex sync.Mutex
+	var payloads [][]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		payloads = append(payloads, readPayload(t, r))
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.Frequency = time.Hour
+	r := NewRegistry(cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := r.StartWithContext(ctx); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	r.Counter("foo", nil).Increment()
+	cancel()
+
+	for i := 0; i < 100; i++ {
+		r.lifecycleMutex.Lock()
+		started := r.started
+		r.lifecycleMutex.Unlock()
+		if !started {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// waits for the last publish
+	r.Stop()
+	mutex.Lock()
+	published := len(payloads)
+	mutex.Unlock()
+	if published == 0 {
+		t.Fatal("Expected the measurements to be published when the context is done")
+	}
+	if err := r.Start(); err != nil {
+		t.Error("Expected the registry to be restartable, got", err)
+	}
+	r.Stop()
+}
+
+func TestRegistry_Flush(t *testing.T) {
+	status := 200
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("foo", nil).Increment()
+	if err := r.Flush(context.Background()); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	assertEqual(t, requests, 1, "expected the measurements to be published")
+
+	status = 503
+	r.Counter("foo", nil).Increment()
+	if err := r.Flush(context.Background()); err == nil {
+		t.Error("Expected the failed publish to be reported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	requests = 0
+	if err := r.Flush(ctx); err == nil {
+		t.Error("Expected an error for a cancelled context")
+	}
+	assertEqual(t, requests, 0, "expected no request with a cancelled context")
+	var kept float64
+	for _, m := range r.pending {
+		if m.id.name == "foo" {
+			kept = m.value
+		}
+	}
+	assertEqual(t, kept, 1.0, "expected the delta to be kept for the next publish")
+}
+
+func TestRegistry_PublishAndClose(t *testing.T) {
+	statuses := []int{503, 503, 200}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[requests])
+		requests++
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.sleep = func(time.Duration) {}
+	r.Counter("foo", nil).Increment()
+	if err := r.PublishAndClose(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	assertEqual(t, requests, 3, "expected the failed requests to be retried")
+}
+
+func TestRegistry_ConcurrentMeterCreation(t *testing.T) {
+	r := NewRegistry(config)
+	const numGoroutines = 50
+	const numIncrements = 1000
+
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		go func(n int) {
+			defer wg.Done()
+			own := fmt.Sprintf("own.%d", n)
+			for j := 0; j < numIncrements; j++ {
+				r.Counter("shared", nil).Increment()
+				r.Counter(own, nil).Increment()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if v := r.Counter("shared", nil).Count(); v != numGoroutines*numIncrements {
+		t.Errorf("Expected %d, got %f", numGoroutines*numIncrements, v)
+	}
+	for i := 0; i < numGoroutines; i++ {
+		if v := r.Counter(fmt.Sprintf("own.%d", i), nil).Count(); v != numIncrements {
+			t.Errorf("Expected %d for own.%d, got %f", numIncrements, i, v)
+		}
+	}
+	if len(r.Meters()) != numGoroutines+1 {
+		t.Errorf("Expected %d meters, got %d", numGoroutines+1, len(r.Meters()))
+	}
+}
+
+// a custom meter reporting a hit ratio from two counters
+type hitRatio struct {
+	id     *Id
+	hits   *Counter
+	misses *Counter
+}
+
+func (h *hitRatio) MeterId() *Id {
+	return h.id
+}
+
+func (h *hitRatio) Measure() []Measurement {
+	hits := h.hits.Measure()[0].value
+	misses := h.misses.Measure()[0].value
+	return []Measurement{NewMeasurement(h.id.WithStat("gauge"), hits/(hits+misses))}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry(config)
+	id := NewId("cache.hitRatio", nil)
+	h := &hitRatio{id, NewCounter(id), NewCounter(id)}
+	if err := r.Register(h); err != nil {
+		t.Fatal("Unexpected error", err)
+	}
+	if err := r.Register(h); err != nil {
+		t.Error("Registering the same meter twice should succeed", err)
+	}
+	if err := r.Register(&hitRatio{id, NewCounter(id), NewCounter(id)}); err == nil {
+		t.Error("Expected an error registering a different meter with the same id")
+	}
+
+	h.hits.Add(3)
+	h.misses.Add(1)
+	r.publish()
+	metric, ok := r.GetExport()["cache.hitRatio"]
+	if !ok {
+		t.Fatalf("Expected the custom meter to be exported, got %v", r.GetExport())
+	}
+	assertEqual(t, metric.Kind, "hitRatio", "unexpected kind")
+	assertEqual(t, metric.Values[0].Values[0].V, 0.75, "unexpected value")
+}
+
+func TestNewNoopRegistry(t *testing.T) {
+	r := NewNoopRegistry()
+	if err := r.Start(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+
+	r.Counter("c", nil).Increment()
+	r.Counter("c", nil).AddFloat(1.5)
+	r.Timer("t", nil).Record(time.Second)
+	r.Gauge("g", nil).Set(42)
+	r.AgeGauge("age", nil).Now()
+	r.DistributionSummary("ds", nil).Record(100)
+	r.MonotonicCounter("mono", nil).Set(10)
+	r.MonotonicCounter("mono", nil).Set(20)
+
+	if v := r.Counter("c", nil).Count(); v != 0 {
+		t.Errorf("Noop meters should not be registered, got %f", v)
+	}
+	if len(r.Meters()) != 0 {
+		t.Errorf("Expected no meters, got %d", len(r.Meters()))
+	}
+
+	r.publish()
+	if len(r.GetExport()) != 0 {
+		t.Errorf("Expected an empty export, got %v", r.GetExport())
+	}
+	r.Stop()
+	r.Stop()
+}
+
+func TestRegistry_Disabled(t *testing.T) {
+	cfg := makeConfig("http://localhost:1/api/v4/publish")
+	cfg.Disabled = true
+	r := NewRegistry(cfg)
+	if r.http != nil {
+		t.Error("Expected no HTTP client for a disabled registry")
+	}
+	if err := r.Start(); err != nil {
+		t.Error("Unexpected error", err)
+	}
+	if r.started {
+		t.Error("Expected no publishing goroutine for a disabled registry")
+	}
+	r.Counter("c", nil).Increment()
+	assertEqual(t, len(r.Meters()), 0, "expected no meters")
+	r.Stop()
+}
+
+func TestRegistry_MaxMeters(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.MaxMeters = 2
+	r := NewRegistry(cfg)
+
+	r.Counter("c1", nil).Increment()
+	r.Timer("t1", nil).Record(time.Second)
+
+	dropped := r.Counter("c2", nil)
+	dropped.Increment()
+	r.Counter("c3", nil).Increment()
+	if len(r.Meters()) != 3 {
+		t.Fatalf("Expected 2 meters plus the overflow counter, got %d", len(r.Meters()))
+	}
+	if v := r.Counter("c2", nil).Count(); v != 0 {
+		t.Errorf("Meters past the limit should not be registered, got %f", v)
+	}
+
+	r.Counter("c1", nil).Increment()
+	if v := r.Counter("c1", nil).Count(); v != 2 {
+		t.Errorf("Existing meters should keep recording. Expected 2, got %f", v)
+	}
+	if v := r.Timer("t1", nil).Count(); v != 1 {
+		t.Errorf("Existing meters should keep recording. Expected 1, got %d", v)
+	}
+
+	overflow := r.Counter(registryOverflowName, nil)
+	// c2 twice and c3 once
+	if v := overflow.Count(); v != 3 {
+		t.Errorf("Expected 3 overflows, got %f", v)
+	}
+}
+
 type payloadEntry struct {
 	tags  map[string]string
 	op    int
@@ -242,6 +557,532 @@ func TestRegistry_enabled(t *testing.T) {
 	assertEqual(t, called, 3, "expected 3 publish calls")
 }
 
+// reads a possibly compressed publish request
+func readPayload(t *testing.T, r *http.Request) []interface{} {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Fatal("Unable to decompress body", err)
+		}
+		reader = gz
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal("Unable to read body", err)
+	}
+	var payload []interface{}
+	if err = json.Unmarshal(body, &payload); err != nil {
+		t.Fatal("Unable to unmarshal payload", err)
+	}
+	return payload
+}
+
+func TestRegistry_publishRetainsDeltasOnFailure(t *testing.T) {
+	requests := 0
+	received := 0.0
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		payload := readPayload(t, r)
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		for _, e := range payloadToEntries(t, payload) {
+			if e.tags["name"] == "foo" {
+				received += e.value
+			}
+		}
+		w.Write(okMsg)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+	r.Counter("foo", nil).Add(5)
+	r.publish()
+	r.publish()
+
+	assertEqual(t, requests, 3, "expected 3 publish calls")
+	assertEqual(t, received, 15.0, "expected the full delta to be received exactly once")
+	assertEqual(t, r.Counter("foo", nil).Count(), 15.0, "expected the lifetime count")
+}
+
+func TestRegistry_publishDropsRejectedDeltas(t *testing.T) {
+	requests := 0
+	received := 0.0
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		payload := readPayload(t, r)
+		if requests == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, e := range payloadToEntries(t, payload) {
+			if e.tags["name"] == "foo" {
+				received += e.value
+			}
+		}
+		w.Write(okMsg)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+	r.Counter("foo", nil).Add(5)
+	r.publish()
+
+	assertEqual(t, requests, 2, "expected 2 publish calls")
+	assertEqual(t, received, 5.0, "expected the rejected delta to not be sent again")
+}
+
+func TestRegistry_publishRetainsDeltasByRawId(t *testing.T) {
+	requests := 0
+	var entries []payloadEntry
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		payload := readPayload(t, r)
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for _, e := range payloadToEntries(t, payload) {
+			if name := e.tags["name"]; name == "foo bar" || name == "foo_bar" {
+				entries = append(entries, e)
+			}
+		}
+		w.Write(okMsg)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	// the invalid character is replaced before sending
+	counter := r.Counter("foo bar", nil)
+	counter.Add(10)
+	r.publish()
+	counter.Add(5)
+	r.publish()
+
+	assertEqual(t, len(entries), 1, "expected the retained delta to be merged with the new one")
+	assertEqual(t, entries[0].tags["name"], "foo_bar", "expected the normalized name")
+	assertEqual(t, entries[0].value, 15.0, "expected the full delta")
+}
+
+func TestRegistry_publishFractionalCounter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("bytes", nil).AddFloat(1.5)
+	r.Counter("bytes", nil).AddFloat(0.25)
+	entries := publishEntries(t, r, "bytes")
+	assertEqual(t, len(entries), 1, "expected 1 entry")
+	assertEqual(t, entries[0].value, 1.75, "expected the fractional delta")
+}
+
+func TestRegistry_Remove(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	tags := map[string]string{"conn": "1"}
+	r.Counter("foo", tags).Add(3)
+	r.Counter("foo", map[string]string{"conn": "2"}).Add(1)
+	r.Counter("bar", nil).Add(1)
+
+	if !r.Remove("foo", tags) {
+		t.Error("Expected the counter to be removed")
+	}
+	if r.Remove("foo", tags) {
+		t.Error("Removing a missing meter should return false")
+	}
+
+	// the pending delta is flushed on the next publish
+	entries := publishEntries(t, r, "foo")
+	assertEqual(t, len(entries), 2, "expected the removed counter and conn=2")
+	for _, e := range entries {
+		if e.tags["conn"] == "1" {
+			assertEqual(t, e.value, 3.0, "expected the final delta")
+		}
+	}
+
+	r.Counter("bar", nil).Add(1)
+	assertEqual(t, r.RemoveAll("foo"), 1, "expected 1 meter removed")
+	r.publish()
+	entries = publishEntries(t, r, "foo")
+	assertEqual(t, len(entries), 0, "removed meters should not be published")
+	for _, m := range r.Meters() {
+		if m.MeterId().name == "foo" {
+			t.Errorf("Unexpected meter %v", m.MeterId())
+		}
+	}
+}
+
+func TestRegistry_UnregisterMeter(t *testing.T) {
+	r := NewRegistry(config)
+	tags := map[string]string{"pipeline": "deploy-1"}
+	c := r.Counter("pipeline.runs", tags)
+	c.Increment()
+	if !r.UnregisterMeter(c) {
+		t.Error("Expected the counter to be unregistered")
+	}
+	if r.UnregisterMeter(c) {
+		t.Error("Unregistering a missing meter should return false")
+	}
+
+	// a stale reference must not remove the meter that replaced it
+	replacement := r.Counter("pipeline.runs", tags)
+	if r.UnregisterMeter(c) {
+		t.Error("Expected a stale meter not to be unregistered")
+	}
+	if !r.UnregisterMeter(replacement) {
+		t.Error("Expected the replacement to be unregistered")
+	}
+	assertEqual(t, len(r.Meters()), 0, "expected no meters")
+}
+
+func TestRegistry_MeterTTL(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.MeterTTL = time.Minute
+	r := NewRegistry(cfg)
+	clock := &ManualClock{1}
+	r.clock = clock
+
+	r.Counter("stale", nil).Increment()
+	r.Counter("busy", nil).Increment()
+	r.publish()
+
+	clock.SetFromDuration(90 * time.Second)
+	r.Counter("busy", nil).Increment()
+	r.publish()
+
+	meters := r.Meters()
+	assertEqual(t, len(meters), 1, "expected the inactive meter to expire")
+	assertEqual(t, meters[0].MeterId().Name(), "busy", "unexpected meter")
+
+	// an expired meter is created again when looked up
+	r.Counter("stale", nil).Increment()
+	r.publish()
+	assertEqual(t, len(r.Meters()), 2, "expected the meter to be registered again")
+}
+
+func TestRegistry_MaxMetersPerName(t *testing.T) {
+	cfg := makeConfig("")
+	cfg.MaxMetersPerName = 2
+	r := NewRegistry(cfg)
+
+	for _, account := range []string{"a", "b", "c", "d"} {
+		r.Counter("requests", map[string]string{"account": account}).Increment()
+	}
+	r.Counter("requests", map[string]string{"account": "a"}).Increment()
+	r.Counter("other", nil).Increment()
+
+	counts := map[string]float64{}
+	for _, m := range r.Meters() {
+		if c, ok := m.(*Counter); ok && m.MeterId().Name() == "requests" {
+			tags := m.MeterId().Tags()
+			counts[tags["account"]+tags[overflowTagKey]] = c.Count()
+		}
+	}
+	expected := map[string]float64{"a": 2, "b": 1, "true": 2}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("Expected %v, got %v", expected, counts)
+	}
+
+	// removing a series makes room for a new one
+	r.Remove("requests", map[string]string{"account": "b"})
+	r.Remove("requests", map[string]string{overflowTagKey: "true"})
+	r.Counter("requests", map[string]string{"account": "e"}).Increment()
+	if _, ok := r.meters.get(NewId("requests", map[string]string{"account": "e"})); !ok {
+		t.Error("Expected a new series to be allowed after removing one")
+	}
+}
+
+func TestRegistry_WithTags(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	lib := r.WithTags(map[string]string{"component": "cache", "tier": "1"})
+	lib.Counter("hits", map[string]string{"tier": "2"}).Increment()
+	lib.WithTags(map[string]string{"shard": "a"}).Timer("latency", nil).Record(time.Second)
+
+	hits := r.Counter("hits", map[string]string{"component": "cache", "tier": "2"})
+	assertEqual(t, hits.Count(), 1.0, "expected the view to share meters with the parent")
+
+	expected := map[string]string{"component": "cache", "tier": "1", "shard": "a"}
+	latency := r.TimerWithId(NewId("latency", expected))
+	assertEqual(t, latency.Count(), int64(1), "expected the nested view to apply all tags")
+
+	if !reflect.DeepEqual(lib.NewId("foo", nil).Tags(), map[string]string{"component": "cache", "tier": "1"}) {
+		t.Errorf("Expected NewId to include the view tags, got %v", lib.NewId("foo", nil).Tags())
+	}
+
+	lib.publish()
+	if _, ok := r.GetExport()["hits"]; !ok {
+		t.Error("Expected publishing through a view to publish the parent")
+	}
+	if _, ok := lib.GetExport()["hits"]; !ok {
+		t.Error("Expected the view to expose the parent export")
+	}
+
+	lib.SetExport(map[string]Metric{})
+	assertEqual(t, len(r.GetExport()), 0, "expected SetExport on a view to update the parent")
+}
+
+func TestRegistry_WithTagsRemove(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	lib := r.WithTags(map[string]string{"component": "cache"})
+	lib.Counter("hits", nil).Increment()
+	lib.Counter("misses", nil).Increment()
+	lib.Counter("evictions", map[string]string{"reason": "size"}).Increment()
+	lib.Counter("evictions", map[string]string{"reason": "ttl"}).Increment()
+	r.Counter("evictions", nil).Increment()
+
+	if !lib.Remove("hits", nil) {
+		t.Error("Expected Remove to apply the view tags")
+	}
+	if !lib.RemoveWithId(NewId("misses", nil)) {
+		t.Error("Expected RemoveWithId to apply the view tags")
+	}
+	assertEqual(t, lib.RemoveAll("evictions"), 2, "expected RemoveAll to only remove the meters of the view")
+	assertEqual(t, len(r.Meters()), 1, "expected only the parent meter to be left")
+
+	// deltas of removed meters are published by the parent
+	ms, _ := r.withPendingDeltas(nil)
+	assertEqual(t, len(ms), 4, "expected the deltas of the removed meters to be retained")
+}
+
+func TestRegistry_WithTagsStarted(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	r.Start()
+	defer r.Stop()
+	lib := r.WithTags(map[string]string{"component": "cache"})
+	if lib.started {
+		t.Error("Expected the view to not copy the state of the parent")
+	}
+	if lib.Start() == nil {
+		t.Error("Expected starting the view to start the parent, which is already started")
+	}
+}
+
+func TestRegistry_OnPublish(t *testing.T) {
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	var payloads [][]interface{}
+	var errs []error
+	cfg := makeConfig(server.URL)
+	enabled := true
+	cfg.IsEnabled = func() bool {
+		return enabled
+	}
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		payloads = append(payloads, payload)
+		errs = append(errs, err)
+	}
+	r := NewRegistry(cfg)
+
+	r.Counter("foo", nil).Add(10)
+	r.Counter("bar", nil).Add(5)
+	r.publish()
+
+	assertEqual(t, len(payloads), 1, "expected 1 callback")
+	if errs[0] != nil {
+		t.Error("Expected a nil error, got", errs[0])
+	}
+	// round trip through json to match what the aggregator sees
+	b, _ := json.Marshal(payloads[0])
+	var payload []interface{}
+	json.Unmarshal(b, &payload)
+	assertEqual(t, len(payloadToEntries(t, payload)), 2, "expected 2 entries")
+
+	// still invoked when disabled
+	enabled = false
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+	assertEqual(t, len(payloads), 2, "expected a callback when disabled")
+	if errs[1] != nil {
+		t.Error("Expected a nil error, got", errs[1])
+	}
+}
+
+func TestRegistry_OnPublishInternal(t *testing.T) {
+	var payloads [][]interface{}
+	cfg := makeConfig("")
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		if err != nil {
+			t.Error("Expected a nil error, got", err)
+		}
+		payloads = append(payloads, payload)
+	}
+	r := NewRegistry(cfg)
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+
+	assertEqual(t, len(payloads), 1, "expected a callback without an external destination")
+	found := false
+	for _, p := range payloads[0] {
+		if m := p.(Measurement); m.id.name == "foo" {
+			found = true
+			assertEqual(t, m.value, 10.0, "unexpected value")
+			assertEqual(t, m.id.tags["nf.app"], "test", "expected the common tags")
+		}
+	}
+	if !found {
+		t.Error("Expected the counter in the payload")
+	}
+}
+
+func TestRegistry_OnPublishPanic(t *testing.T) {
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	var publishErr error
+	cfg := makeConfig(server.URL)
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+		panic("oops")
+	}
+	r := NewRegistry(cfg)
+
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+	if publishErr == nil {
+		t.Error("Expected the failed POST to be reported")
+	}
+}
+
+func TestRegistry_OnPublishComplete(t *testing.T) {
+	status := http.StatusOK
+	publishHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write(okMsg)
+	})
+	server := httptest.NewServer(publishHandler)
+	defer server.Close()
+
+	var results []PublishResult
+	cfg := makeConfig(server.URL)
+	cfg.OnPublishComplete = func(result PublishResult) {
+		results = append(results, result)
+		panic("oops")
+	}
+	r := NewRegistry(cfg)
+
+	r.Counter("foo", nil).Add(10)
+	r.Counter("bar", nil).Add(5)
+	r.publish()
+	assertEqual(t, len(results), 1, "expected 1 callback")
+	assertEqual(t, results[0].Measurements, 2, "expected the measurements sent")
+	assertEqual(t, results[0].Status, http.StatusOK, "expected the HTTP status")
+	if results[0].Bytes <= 0 || results[0].Duration <= 0 || results[0].Err != nil {
+		t.Errorf("Expected a successful publish, got %+v", results[0])
+	}
+
+	status = http.StatusBadRequest
+	r.Counter("foo", nil).Add(10)
+	r.publish()
+	assertEqual(t, len(results), 2, "expected a callback for the failed publish")
+	assertEqual(t, results[1].Measurements, 0, "expected no measurements to be sent")
+	assertEqual(t, results[1].Status, http.StatusBadRequest, "expected the HTTP status")
+	if _, ok := results[1].Err.(*httpStatusError); !ok {
+		t.Errorf("Expected the failed POST to be reported, got %v", results[1].Err)
+	}
+}
+
+// publishes the registry and returns the decoded entries for the given meter name
+func publishEntries(t *testing.T, r *Registry, name string) []payloadEntry {
+	var entries []payloadEntry
+	r.config.OnPublish = func(payload []interface{}, err error) {
+		b, _ := json.Marshal(payload)
+		var decoded []interface{}
+		json.Unmarshal(b, &decoded)
+		for _, e := range payloadToEntries(t, decoded) {
+			if e.tags["name"] == name {
+				entries = append(entries, e)
+			}
+		}
+	}
+	r.publish()
+	return entries
+}
+
+func TestRegistry_publishMin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Timer("latency", nil).TrackMin().Record(time.Second)
+	entries := publishEntries(t, r, "latency")
+	assertEqual(t, len(entries), 5, "expected the timer statistics with min")
+	found := false
+	for _, e := range entries {
+		if e.tags["statistic"] == "min" {
+			found = true
+			assertEqual(t, e.op, maxOp, "expected the min to be published as a gauge")
+			assertEqual(t, e.value, 1.0, "unexpected min")
+		}
+	}
+	if !found {
+		t.Error("Expected the min to be published")
+	}
+
+	local := NewRegistry(makeConfig(""))
+	local.Timer("latency", nil).TrackMin().Record(time.Second)
+	local.publish()
+	if out := promOutput(local); !strings.Contains(out, "# TYPE latency_min gauge") {
+		t.Errorf("Expected the min to be exposed locally, got %s", out)
+	}
+}
+
+func TestRegistry_SetCommonTag(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("foo", map[string]string{"nf.region": "local"}).Increment()
+	entries := publishEntries(t, r, "foo")
+	assertEqual(t, len(entries), 1, "expected 1 entry")
+	assertEqual(t, entries[0].tags["nf.cluster"], "test-main", "unexpected cluster")
+	assertEqual(t, entries[0].tags["nf.region"], "local", "meter tags should win over common tags")
+
+	r.SetCommonTag("nf.cluster", "test-canary")
+	r.SetCommonTag("nf.region", "us-east-1")
+	r.RemoveCommonTag("nf.asg")
+	r.Counter("foo", map[string]string{"nf.region": "local"}).Increment()
+	entries = publishEntries(t, r, "foo")
+	assertEqual(t, len(entries), 1, "expected 1 entry")
+	assertEqual(t, entries[0].tags["nf.cluster"], "test-canary", "expected the updated common tag")
+	assertEqual(t, entries[0].tags["nf.region"], "local", "meter tags should win over common tags")
+	if _, ok := entries[0].tags["nf.asg"]; ok {
+		t.Error("Removed common tag should not be published")
+	}
+	assertEqual(t, len(entries[0].tags), 5, "expected nf.app, nf.cluster, nf.region, statistic and name")
+
+	r.config.Uri = ""
+	r.Counter("foo", nil).Increment()
+	r.publish()
+	tags := r.GetExport()["foo"].Values[0].Tags
+	assert.Contains(t, tags, Tag{Key: "nf.cluster", Value: "test-canary"})
+}
+
 func withDefaultTags(tags ...Tag) []Tag {
 	defaultTags := []Tag{}
 	for k, v := range config.CommonTags {
@@ -304,6 +1145,26 @@ func TestConvert(t *testing.T) {
 				},
 			},
 		},
+		"fractional counter": {
+			setup: func(r *Registry) {
+				cntr := r.Counter("test.test", map[string]string{})
+				cntr.AddFloat(0.25)
+				cntr.AddFloat(0.5)
+			},
+			expectedOutputs: map[string]Metric{
+				"test.test": Metric{
+					Kind: "Counter",
+					Values: []TopValue{
+						TopValue{
+							Tags: withDefaultTags(Tag{Key: "statistic", Value: "count"}),
+							Values: []*Value{
+								&Value{V: 0.75, T: 0},
+							},
+						},
+					},
+				},
+			},
+		},
 		"two counters": {
 			setup: func(r *Registry) {
 				cntr1 := r.Counter("test.one", map[string]string{})
@@ -355,19 +1216,57 @@ func TestConvert(t *testing.T) {
 						TopValue{
 							Tags: withDefaultTags(Tag{Key: "statistic", Value: "totalTime"}),
 							Values: []*Value{
-								&Value{V: 100000, T: 0},
+								&Value{V: 1e9, T: 0},
 							},
 						},
 						TopValue{
 							Tags: withDefaultTags(Tag{Key: "statistic", Value: "totalOfSquares"}),
 							Values: []*Value{
-								&Value{V: 100000, T: 0},
+								&Value{V: 1e18, T: 0},
 							},
 						},
 						TopValue{
 							Tags: withDefaultTags(Tag{Key: "statistic", Value: "max"}),
 							Values: []*Value{
-								&Value{V: 100000, T: 0},
+								&Value{V: 1e9, T: 0},
+							},
+						},
+					},
+				},
+			},
+		},
+		"fractional timer": {
+			setup: func(r *Registry) {
+				tmer := r.Timer("test.test", map[string]string{})
+				tmer.Record(5 * time.Millisecond)
+				tmer.Record(1500 * time.Millisecond)
+			},
+			expectedOutputs: map[string]Metric{
+				"test.test": Metric{
+					Kind: "Timer",
+					Values: []TopValue{
+						TopValue{
+							Tags: withDefaultTags(Tag{Key: "statistic", Value: "count"}),
+							Values: []*Value{
+								&Value{V: 2, T: 0},
+							},
+						},
+						TopValue{
+							Tags: withDefaultTags(Tag{Key: "statistic", Value: "totalTime"}),
+							Values: []*Value{
+								&Value{V: 1.505e9, T: 0},
+							},
+						},
+						TopValue{
+							Tags: withDefaultTags(Tag{Key: "statistic", Value: "totalOfSquares"}),
+							Values: []*Value{
+								&Value{V: 2.250025e18, T: 0},
+							},
+						},
+						TopValue{
+							Tags: withDefaultTags(Tag{Key: "statistic", Value: "max"}),
+							Values: []*Value{
+								&Value{V: 1.5e9, T: 0},
 							},
 						},
 					},
@@ -406,20 +1305,262 @@ func TestConvert(t *testing.T) {
 					assert.ElementsMatch(t, topvalue.Tags, outtopvalue.Tags, "Tags should match")
 					assert.NotEqual(t, "", statistic, "Tag Statistic should exist")
 
-					// values should meet expectations based on metric kind
-					switch kind {
-					case "Timer":
-						if statistic == "count" {
-							assert.Equal(t, topvalue.Values[0].V, outtopvalue.Values[0].V, "Timer values of statistic count should match")
-						} else {
-							// Timer values for statistics max, totalTime, and totalOfSquares cannot be exact
-							assert.GreaterOrEqualf(t, outtopvalue.Values[0].V, topvalue.Values[0].V, "Timer values of statistic %s should be >= expected values", statistic)
-						}
-					default:
-						assert.Equalf(t, topvalue.Values[0].V, outtopvalue.Values[0].V, "Values for metric kind %s and statistic %s should match", kind, statistic)
+					// compare with a relative tolerance since timer values go through float math
+					expected, actual := topvalue.Values[0].V, outtopvalue.Values[0].V
+					if math.Abs(expected-actual) > 1e-9*math.Abs(expected) {
+						t.Errorf("Values for metric kind %s and statistic %s should match: %v != %v", kind, statistic, expected, actual)
 					}
 				}
 			}
 		})
 	}
 }
+
+func TestRegistry_publishBatches(t *testing.T) {
+	var batches []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := 0
+		for _, e := range payloadToEntries(t, readPayload(t, r)) {
+			if e.tags["name"] != "http.req.complete" {
+				n++
+			}
+		}
+		batches = append(batches, n)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.BatchSize = 2
+	r := NewRegistry(cfg)
+	for i := 0; i < 5; i++ {
+		r.Counter(fmt.Sprintf("c%d", i), nil).Increment()
+	}
+	r.publish()
+	if !reflect.DeepEqual(batches, []int{2, 2, 1}) {
+		t.Errorf("Expected batches of at most 2 measurements, got %v", batches)
+	}
+
+	// an unset batch size uses the default instead of looping forever
+	batches = nil
+	cfg.BatchSize = 0
+	for i := 0; i < 5; i++ {
+		r.Counter(fmt.Sprintf("c%d", i), nil).Increment()
+	}
+	r.publish()
+	if len(batches) != 1 || batches[0] != 5 {
+		t.Errorf("Expected a single batch, got %v", batches)
+	}
+}
+
+func TestRegistry_publishRetries(t *testing.T) {
+	statuses := []int{503, 429, 200}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[requests])
+		requests++
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.PublishRetries = 3
+	cfg.RetryBackoff = 100 * time.Millisecond
+	cfg.RetryMaxBackoff = 150 * time.Millisecond
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	var waits []time.Duration
+	r.sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	r.Counter("requests", nil).Increment()
+	r.publish()
+
+	assertEqual(t, requests, 3, "expected the 503 and 429 to be retried")
+	if publishErr != nil {
+		t.Errorf("Expected the last attempt to succeed, got %v", publishErr)
+	}
+	if len(waits) != 2 || waits[0] < 50*time.Millisecond || waits[0] > 100*time.Millisecond ||
+		waits[1] < 75*time.Millisecond || waits[1] > 150*time.Millisecond {
+		t.Errorf("Expected jittered waits capped at the max backoff, got %v", waits)
+	}
+
+	// rejected payloads are not retried
+	statuses = []int{400}
+	requests = 0
+	r.Counter("requests", nil).Increment()
+	r.publish()
+	assertEqual(t, requests, 1, "expected a 400 not to be retried")
+}
+
+func TestRegistry_publishTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	cfg := makeConfig(server.URL)
+	cfg.Timeout = 5 * time.Second
+	cfg.PublishTimeout = 100 * time.Millisecond
+	cfg.PublishRetries = 3
+	var publishErr error
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		publishErr = err
+	}
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+
+	start := time.Now()
+	r.publish()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the publish to be cancelled after the publish timeout, took %v", elapsed)
+	}
+	if publishErr == nil {
+		t.Error("Expected the publish to fail")
+	}
+	assertEqual(t, len(r.pending), 1, "expected the delta to be kept for the next publish")
+}
+
+func TestRegistry_MeasurementTransformer(t *testing.T) {
+	var entries []payloadEntry
+	status := 500
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries = payloadToEntries(t, readPayload(t, r))
+		w.WriteHeader(status)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.MeasurementTransformer = func(ms []Measurement) []Measurement {
+		for i, m := range ms {
+			if m.Id().Name() == "legacy.bytes" {
+				ms[i] = NewMeasurement(NewId("bytes in", m.Id().Tags()), m.Value()*1024)
+			}
+		}
+		return ms
+	}
+	r := NewRegistry(cfg)
+	r.Counter("legacy.bytes", nil).Add(2)
+	r.publish()
+	status = 200
+	r.publish()
+
+	var found bool
+	for _, e := range entries {
+		if e.tags["name"] == "legacy.bytes" {
+			t.Errorf("Expected the meter to be renamed, got %v", e)
+		}
+		if e.tags["name"] == "bytes_in" {
+			found = true
+			assertEqual(t, e.value, 2048.0, "expected the retained delta to be converted once")
+		}
+	}
+	if !found {
+		t.Errorf("Expected the renamed and sanitized meter, got %v", entries)
+	}
+}
+
+func TestRegistry_NonFiniteValues(t *testing.T) {
+	var entries []payloadEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entries = payloadToEntries(t, readPayload(t, r))
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Gauge("inf", nil).Set(math.Inf(1))
+	r.Gauge("negInf", nil).Set(math.Inf(-1))
+	r.Gauge("nan", nil).Set(math.NaN())
+	r.Gauge("ok", nil).Set(1)
+	r.publish()
+
+	if len(entries) != 1 || entries[0].tags["name"] != "ok" {
+		t.Errorf("Expected only the finite value to be published, got %v", entries)
+	}
+
+	r.publish()
+	var dropped float64
+	for _, e := range entries {
+		if e.tags["name"] == "spectator.measurements" && e.tags["error"] == "nonFinite" {
+			dropped = e.value
+		}
+	}
+	assertEqual(t, dropped, 2.0, "expected the infinite values to be counted")
+}
+
+// the aggregator sums the statistics published with the add op and keeps the
+// largest value of the others
+var expectedOps = map[string]int{
+	"count":          addOp,
+	"totalTime":      addOp,
+	"totalAmount":    addOp,
+	"totalOfSquares": addOp,
+	"percentile":     addOp,
+	"max":            maxOp,
+	"gauge":          maxOp,
+	"activeTasks":    maxOp,
+	"duration":       maxOp,
+}
+
+func TestRegistry_publishOps(t *testing.T) {
+	for _, onPublish := range []bool{false, true} {
+		var entries []payloadEntry
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entries = payloadToEntries(t, readPayload(t, r))
+			w.Write(okMsg)
+		}))
+
+		cfg := makeConfig(server.URL)
+		if onPublish {
+			// builds the payload instead of encoding the measurements directly
+			cfg.OnPublish = func([]interface{}, error) {}
+		}
+		clock := &ManualClock{}
+		r := NewRegistry(cfg)
+		r.clock = clock
+		r.Counter("counter", nil).Increment()
+		r.MonotonicCounter("monotonic", nil).Set(1)
+		r.MonotonicCounter("monotonic", nil).Set(2)
+		r.Timer("timer", nil).Record(time.Second)
+		r.DistributionSummary("summary", nil).Record(10)
+		r.Gauge("gauge", nil).Set(1)
+		r.MaxGauge("maxGauge", nil).Set(1)
+		r.LongTaskTimer("longTask", nil).Start()
+		r.BucketCounter("bucketCounter", nil, LatencyBuckets(time.Second)).Record(int64(time.Millisecond))
+		r.Counter("percentiles", map[string]string{"statistic": "percentile", "percentile": "T0042"}).Increment()
+		r.Gauge("custom", map[string]string{"statistic": "custom"}).Set(1)
+		clock.SetFromDuration(time.Minute)
+		r.publish()
+		server.Close()
+
+		seen := map[string]bool{}
+		for _, e := range entries {
+			if e.tags["name"] == "custom" {
+				assertEqual(t, e.op, maxOp, "expected an unknown statistic to use the max op")
+				continue
+			}
+			stat := e.tags["statistic"]
+			expected, known := expectedOps[stat]
+			if !known {
+				t.Errorf("Unexpected statistic %q in %v", stat, e)
+				continue
+			}
+			seen[stat] = true
+			if e.op != expected {
+				t.Errorf("Expected op %d for %s of %s, got %d (onPublish=%v)", expected, stat, e.tags["name"], e.op, onPublish)
+			}
+		}
+		for stat := range expectedOps {
+			if !seen[stat] {
+				t.Errorf("Expected a measurement with statistic %s (onPublish=%v), got %v", stat, onPublish, entries)
+			}
+		}
+	}
+}
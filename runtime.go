@@ -2,40 +2,75 @@ package spectator
 
 import (
 	"runtime"
+	"runtime/pprof"
 	"time"
 )
 
+// how often the runtime metrics are collected for registries without a
+// publish frequency
+const defaultCollectionInterval = 30 * time.Second
+
+// returns how often to collect runtime metrics: the publish frequency, so
+// each publish sees fresh values
+func collectionInterval(registry *Registry) time.Duration {
+	if frequency := registry.Frequency(); frequency > 0 {
+		return frequency
+	}
+	return defaultCollectionInterval
+}
+
 type sysStatsCollector struct {
 	registry      *Registry
 	curOpen       *Gauge
 	maxOpen       *Gauge
 	numGoroutines *Gauge
+	numThreads    *Gauge
+	maxProcs      *Gauge
+}
+
+func updateFdStats(s *sysStatsCollector, cur int, max uint64) {
+	s.curOpen.Set(float64(cur))
+	s.maxOpen.Set(float64(max))
 }
 
 func goRuntimeStats(s *sysStatsCollector) {
 	s.numGoroutines.Set(float64(runtime.NumGoroutine()))
+	// the runtime never destroys the threads it creates, except for locked
+	// goroutines exiting, so the threads created are the threads alive
+	s.numThreads.Set(float64(pprof.Lookup("threadcreate").Count()))
+	s.maxProcs.Set(float64(runtime.GOMAXPROCS(0)))
 }
 
-// Collects system stats: current/max file handles, number of goroutines
-func CollectSysStats(registry *Registry) {
-	var s sysStatsCollector
+func initializeSysStatsCollector(registry *Registry, s *sysStatsCollector) {
 	s.registry = registry
-	s.maxOpen = registry.Gauge("fh.allocated", nil)
-	s.curOpen = registry.Gauge("fh.max", nil)
+	s.curOpen = registry.Gauge("fh.allocated", nil)
+	s.maxOpen = registry.Gauge("fh.max", nil)
 	s.numGoroutines = registry.Gauge("go.numGoroutines", nil)
+	s.numThreads = registry.Gauge("go.numThreads", nil)
+	s.maxProcs = registry.Gauge("go.maxProcs", nil)
+}
+
+// Collects system stats: current/max file handles, number of goroutines and
+// threads, and GOMAXPROCS
+func CollectSysStats(registry *Registry) {
+	var s sysStatsCollector
+	initializeSysStatsCollector(registry, &s)
 
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(collectionInterval(registry))
 	go func() {
 		log := registry.config.Log
-		for range ticker.C {
-			log.Debugf("Collecting system stats")
+		for {
+			log.Debug("Collecting system stats")
 			fdStats(&s)
 			goRuntimeStats(&s)
+			<-ticker.C
 		}
 	}()
 }
 
-// Starts the collection of memory and file handle metrics
+// Starts the collection of memory, GC, goroutine and file handle metrics,
+// updated at the publish frequency of the registry, with the same names as
+// the runtime collectors of Netflix's spectator-go
 func CollectRuntimeMetrics(registry *Registry) {
 	CollectMemStats(registry)
 	CollectSysStats(registry)
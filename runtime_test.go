@@ -0,0 +1,39 @@
+package spectator
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGoRuntimeStats(t *testing.T) {
+	registry := NewRegistry(makeConfig(""))
+	var s sysStatsCollector
+	initializeSysStatsCollector(registry, &s)
+	goRuntimeStats(&s)
+
+	if v := registry.Gauge("go.numGoroutines", nil).Get(); v < 1 {
+		t.Errorf("Expected the running goroutines, got %f", v)
+	}
+	if v := registry.Gauge("go.numThreads", nil).Get(); v < 1 {
+		t.Errorf("Expected the threads created, got %f", v)
+	}
+	assertEqual(t, registry.Gauge("go.maxProcs", nil).Get(), float64(runtime.GOMAXPROCS(0)), "unexpected GOMAXPROCS")
+}
+
+func TestUpdateFdStats(t *testing.T) {
+	registry := NewRegistry(makeConfig(""))
+	var s sysStatsCollector
+	initializeSysStatsCollector(registry, &s)
+	updateFdStats(&s, 10, 1024)
+
+	assertEqual(t, registry.Gauge("fh.allocated", nil).Get(), 10.0, "expected the open files")
+	assertEqual(t, registry.Gauge("fh.max", nil).Get(), 1024.0, "expected the limit of open files")
+}
+
+func TestCollectionInterval(t *testing.T) {
+	assertEqual(t, collectionInterval(NewRegistry(makeConfig(""))), 10*time.Millisecond,
+		"expected the publish frequency")
+	assertEqual(t, collectionInterval(NewRegistry(&Config{})), defaultCollectionInterval,
+		"expected the default without a frequency")
+}
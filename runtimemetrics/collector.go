@@ -0,0 +1,241 @@
+//go:build go1.16
+// +build go1.16
+
+package runtimemetrics
+
+import (
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	"github.com/armory-io/spectator-go"
+	"github.com/armory-io/spectator-go/histogram"
+)
+
+// how often the metrics are collected for registries without a publish
+// frequency
+const defaultInterval = 30 * time.Second
+
+// Collect starts publishing the runtime metrics whose names start with one
+// of the prefixes, e.g. "/sched/" or "/gc/", or all of them without prefixes.
+// They are read at the publish frequency of the registry.
+//
+// A metric like /gc/heap/allocs:bytes is published as go.gc.heap.allocs
+// with the tag unit=bytes. Cumulative metrics are published as counters of
+// their deltas, the others as gauges. Histograms are published like
+// percentile timers for the ones in seconds, or percentile distribution
+// summaries, with the count, the total and the percentile buckets of their
+// deltas, each runtime bucket being mapped to the percentile bucket of its
+// midpoint. Unlike percentile meters, the max isn't tracked.
+func Collect(registry *spectator.Registry, prefixes ...string) {
+	c := newCollector(registry, prefixes)
+	interval := registry.Frequency()
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		for {
+			c.collect()
+			<-ticker.C
+		}
+	}()
+}
+
+type collector struct {
+	samples []metrics.Sample
+	// the meters updated with each sample
+	meters []sampleMeter
+}
+
+type sampleMeter interface {
+	update(value metrics.Value)
+}
+
+func newCollector(registry *spectator.Registry, prefixes []string) *collector {
+	c := &collector{}
+	for _, desc := range metrics.All() {
+		if !matches(desc.Name, prefixes) {
+			continue
+		}
+		name, unit := meterName(desc.Name)
+		id := registry.NewId(name, map[string]string{"unit": unit})
+		var meter sampleMeter
+		switch {
+		case desc.Kind == metrics.KindFloat64Histogram:
+			meter = newHistogramMeter(registry, id, unit == "seconds")
+		case desc.Cumulative:
+			meter = &cumulativeMeter{registry.MonotonicCounterWithId(id)}
+		default:
+			meter = &gaugeMeter{registry.GaugeWithId(id)}
+		}
+		c.samples = append(c.samples, metrics.Sample{Name: desc.Name})
+		c.meters = append(c.meters, meter)
+	}
+	return c
+}
+
+func (c *collector) collect() {
+	metrics.Read(c.samples)
+	for i, sample := range c.samples {
+		c.meters[i].update(sample.Value)
+	}
+}
+
+func matches(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the meter name and unit of a runtime metric, e.g. go.gc.heap.allocs
+// and bytes for /gc/heap/allocs:bytes, or go.cpu.classes.gc.markAssist and
+// cpuSeconds for /cpu/classes/gc/mark-assist:cpu-seconds
+func meterName(metric string) (string, string) {
+	path, unit := metric, ""
+	if i := strings.LastIndexByte(metric, ':'); i >= 0 {
+		path, unit = metric[:i], metric[i+1:]
+	}
+	return "go" + strings.Replace(camelCase(path), "/", ".", -1), camelCase(unit)
+}
+
+// removes the dashes, capitalizing the letters that followed them
+func camelCase(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range s {
+		switch {
+		case c == '-':
+			upper = true
+		case upper:
+			b.WriteString(strings.ToUpper(string(c)))
+			upper = false
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// returns the float value of a sample, 0 for metrics unsupported by the
+// runtime
+func floatValue(value metrics.Value) float64 {
+	switch value.Kind() {
+	case metrics.KindUint64:
+		return float64(value.Uint64())
+	case metrics.KindFloat64:
+		return value.Float64()
+	}
+	return 0
+}
+
+type gaugeMeter struct {
+	gauge *spectator.Gauge
+}
+
+func (m *gaugeMeter) update(value metrics.Value) {
+	m.gauge.Set(floatValue(value))
+}
+
+type cumulativeMeter struct {
+	counter *spectator.MonotonicCounter
+}
+
+func (m *cumulativeMeter) update(value metrics.Value) {
+	m.counter.SetFloat(floatValue(value))
+}
+
+// histogramMeter publishes the deltas of a cumulative runtime histogram
+type histogramMeter struct {
+	registry *spectator.Registry
+	id       *spectator.Id
+	// whether the values are in seconds, recorded like a percentile timer
+	seconds bool
+	count   *spectator.Counter
+	total   *spectator.Counter
+	// the percentile bucket counters, created as needed
+	buckets []*spectator.Counter
+	// the counts of the previous read, nil before the first one
+	prev []uint64
+}
+
+func newHistogramMeter(registry *spectator.Registry, id *spectator.Id, seconds bool) *histogramMeter {
+	total := "totalAmount"
+	if seconds {
+		total = "totalTime"
+	}
+	return &histogramMeter{
+		registry: registry,
+		id:       id,
+		seconds:  seconds,
+		count:    registry.CounterWithId(id.WithStat("count")),
+		total:    registry.CounterWithId(id.WithStat(total)),
+		buckets:  make([]*spectator.Counter, histogram.PercentileBucketsLength()),
+	}
+}
+
+func (m *histogramMeter) update(value metrics.Value) {
+	if value.Kind() != metrics.KindFloat64Histogram {
+		return
+	}
+	h := value.Float64Histogram()
+	if m.prev == nil || len(m.prev) != len(h.Counts) {
+		// the first read is the baseline, like for monotonic counters
+		m.prev = append([]uint64(nil), h.Counts...)
+		return
+	}
+	for i, count := range h.Counts {
+		prev := m.prev[i]
+		m.prev[i] = count
+		if count <= prev {
+			continue
+		}
+		delta := count - prev
+		v := midpoint(h.Buckets[i], h.Buckets[i+1])
+		amount := v
+		if m.seconds {
+			amount = v * 1e9
+		}
+		m.bucket(histogram.PercentileBucketsIndex(int64(amount))).Add(int64(delta))
+		m.count.Add(int64(delta))
+		m.total.AddFloat(v * float64(delta))
+	}
+}
+
+// returns the middle of a bucket, or its finite bound for the first and
+// last buckets
+func midpoint(lower float64, upper float64) float64 {
+	v := (lower + upper) / 2
+	if math.IsInf(lower, -1) {
+		v = upper
+	} else if math.IsInf(upper, 1) {
+		v = lower
+	}
+	if v < 0 || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+func (m *histogramMeter) bucket(i int) *spectator.Counter {
+	if m.buckets[i] == nil {
+		prefix := "D"
+		if m.seconds {
+			prefix = "T"
+		}
+		m.buckets[i] = m.registry.CounterWithId(m.id.WithTags(map[string]string{
+			"statistic":  "percentile",
+			"percentile": fmt.Sprintf("%s%04X", prefix, i),
+		}))
+	}
+	return m.buckets[i]
+}
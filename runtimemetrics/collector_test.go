@@ -0,0 +1,81 @@
+//go:build go1.16
+// +build go1.16
+
+package runtimemetrics
+
+import (
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/armory-io/spectator-go"
+)
+
+func TestMeterName(t *testing.T) {
+	expected := map[string][2]string{
+		"/gc/heap/allocs:bytes":                   {"go.gc.heap.allocs", "bytes"},
+		"/sched/latencies:seconds":                {"go.sched.latencies", "seconds"},
+		"/cpu/classes/gc/mark/assist:cpu-seconds": {"go.cpu.classes.gc.mark.assist", "cpuSeconds"},
+		"/gc/heap/allocs-by-size:bytes":           {"go.gc.heap.allocsBySize", "bytes"},
+	}
+	for metric, e := range expected {
+		name, unit := meterName(metric)
+		if name != e[0] || unit != e[1] {
+			t.Errorf("Expected %s to be published as %v, got %s %s", metric, e, name, unit)
+		}
+	}
+}
+
+func TestMidpoint(t *testing.T) {
+	if v := midpoint(1, 3); v != 2 {
+		t.Errorf("Expected the middle of the bucket, got %f", v)
+	}
+	if v := midpoint(math.Inf(-1), 3); v != 3 {
+		t.Errorf("Expected the upper bound of the first bucket, got %f", v)
+	}
+	if v := midpoint(1, math.Inf(1)); v != 1 {
+		t.Errorf("Expected the lower bound of the last bucket, got %f", v)
+	}
+}
+
+var sink [][]byte
+
+func TestCollector(t *testing.T) {
+	registry := spectator.NewRegistry(&spectator.Config{Frequency: 10 * time.Millisecond})
+	c := newCollector(registry, []string{"/sched/goroutines:goroutines", "/gc/heap/allocs-by-size:bytes", "/gc/heap/allocs:bytes"})
+	if len(c.samples) != 3 {
+		t.Fatalf("Expected the metrics matching the prefixes, got %v", c.samples)
+	}
+	c.collect()
+	for i := 0; i < 1000; i++ {
+		sink = append(sink, make([]byte, 64))
+	}
+	sink = nil
+	runtime.GC()
+	c.collect()
+
+	goroutines := registry.Gauge("go.sched.goroutines", map[string]string{"unit": "goroutines"})
+	if goroutines.Get() < 1 {
+		t.Errorf("Expected the goroutines, got %f", goroutines.Get())
+	}
+	allocs := registry.MonotonicCounter("go.gc.heap.allocs", map[string]string{"unit": "bytes"})
+	if allocs.Count() < 64000 {
+		t.Errorf("Expected the bytes allocated, got %d", allocs.Count())
+	}
+	id := registry.NewId("go.gc.heap.allocsBySize", map[string]string{"unit": "bytes"})
+	count := registry.CounterWithId(id.WithStat("count"))
+	if count.Count() < 1000 {
+		t.Errorf("Expected the allocations since the first read, got %f", count.Count())
+	}
+	buckets := 0
+	for _, m := range registry.Meters() {
+		if m.MeterId().Name() == id.Name() && strings.HasPrefix(m.MeterId().Tags()["percentile"], "D") {
+			buckets++
+		}
+	}
+	if buckets == 0 {
+		t.Error("Expected the percentile buckets of the allocations")
+	}
+}
@@ -0,0 +1,8 @@
+// Package runtimemetrics publishes the metrics of the runtime/metrics
+// package, available from Go 1.16, such as the scheduling latencies and the
+// precise GC histograms not exposed by runtime.MemStats.
+//
+// It's opt-in since it publishes many more series than
+// spectator.CollectRuntimeMetrics. With older Go versions the package is
+// empty.
+package runtimemetrics
@@ -0,0 +1,78 @@
+package spectator
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// With Config.SelfMetrics set, the registry instruments its own publishing,
+// so operators can monitor the metrics pipeline with the metrics it
+// publishes:
+//
+//	spectator.measurements{id=sent}          measurements accepted by the backend
+//	spectator.publish.latency                time taken by each publish
+//	spectator.publish.errors{cause=...}      failed batches, by cause
+//	spectator.payload.bytes                  size of the bodies posted
+//
+// The dropped measurements are always counted, in spectator.measurements with
+// id=dropped and an error tag.
+const (
+	publishLatencyName = "spectator.publish.latency"
+	publishErrorsName  = "spectator.publish.errors"
+	payloadBytesName   = "spectator.payload.bytes"
+)
+
+// counts the measurements of a batch that was sent
+func (r *Registry) recordSent(numMeasurements int) {
+	atomic.AddInt64(&r.publishSent, int64(numMeasurements))
+	if !r.config.SelfMetrics {
+		return
+	}
+	r.Counter("spectator.measurements", map[string]string{"id": "sent"}).Add(int64(numMeasurements))
+}
+
+func (r *Registry) recordPublishLatency(start time.Time) {
+	if !r.config.SelfMetrics {
+		return
+	}
+	r.Timer(publishLatencyName, nil).Record(time.Since(start))
+}
+
+func (r *Registry) recordPayloadBytes(numBytes int) {
+	atomic.AddInt64(&r.publishBytes, int64(numBytes))
+	if !r.config.SelfMetrics {
+		return
+	}
+	r.DistributionSummary(payloadBytesName, nil).Record(int64(numBytes))
+}
+
+func (r *Registry) countPublishError(err error) {
+	if !r.config.SelfMetrics {
+		return
+	}
+	r.Counter(publishErrorsName, map[string]string{"cause": publishErrorCause(err)}).Increment()
+}
+
+// returns a low cardinality description of why a batch failed
+func publishErrorCause(err error) string {
+	switch e := err.(type) {
+	case *httpStatusError:
+		if e.status == 429 || e.status >= 500 {
+			return "httpRetryable"
+		}
+		return "httpRejected"
+	case *payloadError:
+		return "encoding"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return "timeout"
+	}
+	return "other"
+}
@@ -0,0 +1,77 @@
+package spectator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry_SelfMetrics(t *testing.T) {
+	status := 200
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.SelfMetrics = true
+	r := NewRegistry(cfg)
+	r.Counter("a", nil).Increment()
+	r.Counter("b", nil).Increment()
+	r.publish()
+
+	sent := r.Counter("spectator.measurements", map[string]string{"id": "sent"})
+	assertEqual(t, sent.Count(), 2.0, "expected the sent measurements to be counted")
+	assertEqual(t, r.Timer(publishLatencyName, nil).Count(), int64(1), "expected the publish to be timed")
+	bytes := r.DistributionSummary(payloadBytesName, nil)
+	if bytes.Count() != 1 || bytes.TotalAmount() <= 0 {
+		t.Errorf("Expected the payload size to be recorded, got %d bodies of %d bytes", bytes.Count(), bytes.TotalAmount())
+	}
+
+	status = 400
+	r.Counter("a", nil).Increment()
+	r.publish()
+	errs := r.Counter(publishErrorsName, map[string]string{"cause": "httpRejected"})
+	assertEqual(t, errs.Count(), 1.0, "expected the failed batch to be counted")
+	assertEqual(t, sent.Count(), 2.0, "expected the failed batch not to count as sent")
+}
+
+func TestRegistry_SelfMetricsDisabled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	r := NewRegistry(makeConfig(server.URL))
+	r.Counter("a", nil).Increment()
+	r.publish()
+	for _, m := range r.Meters() {
+		if name := m.MeterId().Name(); name != "a" && name != "http.req.complete" {
+			t.Errorf("Expected no self metrics by default, got %v", m.MeterId())
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestPublishErrorCause(t *testing.T) {
+	causes := map[error]string{
+		&httpStatusError{503}:          "httpRetryable",
+		&httpStatusError{429}:          "httpRetryable",
+		&httpStatusError{400}:          "httpRejected",
+		&payloadError{errors.New("x")}: "encoding",
+		timeoutError{}:                 "timeout",
+		context.DeadlineExceeded:       "timeout",
+		errors.New("custom publisher"): "other",
+	}
+	for err, expected := range causes {
+		assertEqual(t, publishErrorCause(err), expected, err.Error())
+	}
+}
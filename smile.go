@@ -0,0 +1,131 @@
+package spectator
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// Encodings of the payload posted to Config.Uri
+const (
+	EncodingJson  = "json"
+	EncodingSmile = "smile"
+)
+
+const smileContentType = "application/x-jackson-smile"
+
+// Smile tokens, see https://github.com/FasterXML/smile-format-specification
+const (
+	smileEmptyString  = 0x20
+	smileInt32        = 0x24
+	smileInt64        = 0x25
+	smileFloat64      = 0x29
+	smileTinyAscii    = 0x40
+	smileShortAscii   = 0x60
+	smileTinyUnicode  = 0x80
+	smileShortUnicode = 0xA0
+	smileSmallInt     = 0xC0
+	smileLongAscii    = 0xE0
+	smileLongUnicode  = 0xE4
+	smileStartArray   = 0xF8
+	smileEndArray     = 0xF9
+	smileEndString    = 0xFC
+)
+
+// the header without shared names or values, which the aggregator doesn't need
+var smileHeader = []byte{':', ')', '\n', 0}
+
+// encodes the payload, a flat array of ints, floats and strings, using the
+// Smile binary JSON format accepted by the Atlas aggregator. It's smaller and
+// cheaper to produce than JSON for large payloads.
+func smileEncode(payload []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(smileHeader)
+	buf.WriteByte(smileStartArray)
+	for _, v := range payload {
+		switch v := v.(type) {
+		case int:
+			smileWriteInt(&buf, int64(v))
+		case float64:
+			smileWriteFloat(&buf, v)
+		case string:
+			smileWriteString(&buf, v)
+		default:
+			return nil, fmt.Errorf("unable to encode %v (%T) as smile", v, v)
+		}
+	}
+	buf.WriteByte(smileEndArray)
+	return buf.Bytes(), nil
+}
+
+func smileWriteInt(buf *bytes.Buffer, v int64) {
+	if v >= math.MinInt32 && v <= math.MaxInt32 {
+		zigzag := uint64(uint32((int32(v) << 1) ^ (int32(v) >> 31)))
+		if zigzag <= 0x1F {
+			buf.WriteByte(smileSmallInt + byte(zigzag))
+			return
+		}
+		buf.WriteByte(smileInt32)
+		smileWriteVInt(buf, zigzag)
+		return
+	}
+	buf.WriteByte(smileInt64)
+	smileWriteVInt(buf, uint64((v<<1)^(v>>63)))
+}
+
+// writes a variable length int: 7 bits per byte, most significant first,
+// except for the last byte which has the high bit set and 6 bits of data
+func smileWriteVInt(buf *bytes.Buffer, v uint64) {
+	var groups [10]byte
+	i := len(groups) - 1
+	groups[i] = 0x80 | byte(v&0x3F)
+	for v >>= 6; v > 0; v >>= 7 {
+		i--
+		groups[i] = byte(v & 0x7F)
+	}
+	buf.Write(groups[i:])
+}
+
+// writes the 64 bits of the double as 10 bytes of 7 bits, most significant first
+func smileWriteFloat(buf *bytes.Buffer, v float64) {
+	bits := math.Float64bits(v)
+	buf.WriteByte(smileFloat64)
+	for i := 9; i >= 0; i-- {
+		buf.WriteByte(byte(bits>>(7*uint(i))) & 0x7F)
+	}
+}
+
+func smileWriteString(buf *bytes.Buffer, s string) {
+	n := len(s)
+	if n == 0 {
+		buf.WriteByte(smileEmptyString)
+		return
+	}
+	ascii := true
+	for i := 0; i < n; i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	switch {
+	case ascii && n <= 32:
+		buf.WriteByte(smileTinyAscii + byte(n-1))
+	case ascii && n <= 64:
+		buf.WriteByte(smileShortAscii + byte(n-33))
+	case !ascii && n >= 2 && n <= 33:
+		buf.WriteByte(smileTinyUnicode + byte(n-2))
+	case !ascii && n <= 65:
+		buf.WriteByte(smileShortUnicode + byte(n-34))
+	default:
+		if ascii {
+			buf.WriteByte(smileLongAscii)
+		} else {
+			buf.WriteByte(smileLongUnicode)
+		}
+		buf.WriteString(s)
+		buf.WriteByte(smileEndString)
+		return
+	}
+	buf.WriteString(s)
+}
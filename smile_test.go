@@ -0,0 +1,66 @@
+package spectator
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSmileEncode(t *testing.T) {
+	b, err := smileEncode([]interface{}{1, "a", 100, -2.5, "", "é"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{':', ')', '\n', 0, 0xF8,
+		0xC2,      // 1, zigzag 2
+		0x40, 'a', // tiny ascii
+		0x24, 0x03, 0x88, // 100, zigzag 200 as a vint
+		0x29, 0x01, 0x40, 0x02, 0, 0, 0, 0, 0, 0, 0, // -2.5
+		0x20,             // empty string
+		0x80, 0xC3, 0xA9, // tiny unicode
+		0xF9}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("Expected % x, got % x", expected, b)
+	}
+}
+
+func TestSmileEncode_LongStrings(t *testing.T) {
+	long := strings.Repeat("x", 65)
+	b, _ := smileEncode([]interface{}{strings.Repeat("x", 64), long})
+	if b[5] != 0x60+31 {
+		t.Errorf("Expected a short ascii string, got %x", b[5])
+	}
+	end := b[5+1+64:]
+	if end[0] != smileLongAscii || end[1+65] != smileEndString {
+		t.Errorf("Expected a long ascii string, got % x", end)
+	}
+
+	if _, err := smileEncode([]interface{}{true}); err == nil {
+		t.Error("Expected an error for unsupported types")
+	}
+}
+
+func TestRegistry_publishSmile(t *testing.T) {
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.PayloadEncoding = EncodingSmile
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Increment()
+	r.publish()
+
+	assertEqual(t, contentType, smileContentType, "unexpected content type")
+	if !bytes.HasPrefix(body, smileHeader) {
+		t.Errorf("Expected a smile payload, got % x", body)
+	}
+}
@@ -0,0 +1,49 @@
+package spectator
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// newSpectatordPublisher returns a publisher for a local spectatord sidecar
+// using its line protocol, type:name,key=value,...:value. The address is
+// either udp://host:port or unix:///path/to/socket for a datagram socket.
+//
+// The measurements sent are the deltas already aggregated by the registry:
+// those using the add op are sent as counters, max statistics as max gauges
+// and the rest as gauges. The statistic tag is kept so spectatord reports
+// them under the same ids Atlas would get from the registry.
+func newSpectatordPublisher(address string) (*linePublisher, error) {
+	var network, target string
+	switch {
+	case strings.HasPrefix(address, "udp://"):
+		network, target = "udp", strings.TrimPrefix(address, "udp://")
+	case strings.HasPrefix(address, "unix://"):
+		network, target = "unixgram", strings.TrimPrefix(address, "unix://")
+	default:
+		return nil, fmt.Errorf("unsupported spectatord address %q, expected udp:// or unix://", address)
+	}
+	return newLinePublisherFor(network, target, formatSpectatord), nil
+}
+
+func formatSpectatord(m Measurement, tags map[string]string) []byte {
+	var buf bytes.Buffer
+	switch {
+	case opFromTags(m.id.tags) == addOp:
+		buf.WriteString("c:")
+	case m.id.tags["statistic"] == "max":
+		buf.WriteString("m:")
+	default:
+		buf.WriteString("g:")
+	}
+	buf.WriteString(m.id.name)
+	for _, k := range sortedTagKeys(tags) {
+		buf.WriteString("," + k + "=" + tags[k])
+	}
+	buf.WriteByte(':')
+	buf.WriteString(strconv.FormatFloat(m.value, 'f', -1, 64))
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
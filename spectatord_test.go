@@ -0,0 +1,110 @@
+package spectator
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpectatord_Udp(t *testing.T) {
+	server := statsdServer(t)
+	defer server.Close()
+
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.SpectatordAddress = "udp://" + server.LocalAddr().String()
+	r := NewRegistry(cfg)
+	r.Counter("requests", map[string]string{"status": "200"}).Add(3)
+	r.Timer("latency", nil).Record(2 * time.Second)
+	r.Gauge("temperature", nil).Set(-4.5)
+	r.publish()
+
+	expected := []string{
+		"c:latency,nf.app=test,statistic=count:1",
+		"c:latency,nf.app=test,statistic=totalOfSquares:4",
+		"c:latency,nf.app=test,statistic=totalTime:2",
+		"c:requests,nf.app=test,statistic=count,status=200:3",
+		"g:temperature,nf.app=test,statistic=gauge:-4.5",
+		"m:latency,nf.app=test,statistic=max:2",
+	}
+	if lines := readStatsdLines(t, server); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestSpectatord_Unix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spectatord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spectatord.unix")
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	p, err := newSpectatordPublisher("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMeasurement(NewId("requests", nil).WithStat("count"), 1)
+	if _, err := p.send(p.payload([]Measurement{m}, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(buf[:n]), "c:requests,statistic=count:1", "unexpected line")
+}
+
+func TestSpectatord_InvalidAddress(t *testing.T) {
+	if _, err := newSpectatordPublisher("127.0.0.1:1234"); err == nil {
+		t.Error("Expected an error for an address without a scheme")
+	}
+}
+
+func TestSpectatord_UnixLateListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spectatord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spectatord.unix")
+
+	cfg := makeConfig("")
+	cfg.CommonTags = nil
+	cfg.SpectatordAddress = "unix://" + path
+	r := NewRegistry(cfg)
+	counter := r.Counter("requests", nil)
+
+	// spectatord isn't up yet, the delta is kept for the next publish
+	counter.Add(2)
+	r.publish()
+
+	server, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	counter.Add(3)
+	r.publish()
+
+	buf := make([]byte, maxPacketSize)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := server.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEqual(t, string(buf[:n]), "c:requests,statistic=count:5", "unexpected line")
+}
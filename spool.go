@@ -0,0 +1,111 @@
+package spectator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	spoolFileName        = "spectator-pending.json"
+	defaultSpoolMaxBytes = 1 << 20
+)
+
+// a retained delta as written to the spool
+type spooledDelta struct {
+	Name  string            `json:"name"`
+	Tags  map[string]string `json:"tags"`
+	Value float64           `json:"value"`
+	Start int64             `json:"start"`
+}
+
+func (r *Registry) spoolPath() string {
+	return filepath.Join(r.config.SpoolDir, spoolFileName)
+}
+
+// writes the deltas retained after failed publishes to the spool, replacing
+// its contents, or removes it if there are none. Deltas that don't fit in
+// SpoolMaxBytes are only kept in memory.
+func (r *Registry) syncSpool() {
+	if r.config.SpoolDir == "" {
+		return
+	}
+	r.pendingMutex.Lock()
+	deltas := make([]spooledDelta, 0, len(r.pending))
+	for key, m := range r.pending {
+		deltas = append(deltas, spooledDelta{m.id.name, m.id.tags, m.value, r.pendingStarts[key]})
+	}
+	r.pendingMutex.Unlock()
+
+	path := r.spoolPath()
+	if len(deltas) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			r.config.Log.Error("Unable to remove the spool", "file", path, "error", err)
+		}
+		return
+	}
+
+	// keep the largest deltas if they don't all fit
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Value > deltas[j].Value
+	})
+	total := len(deltas)
+	maxBytes := r.config.SpoolMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+	b, err := json.Marshal(deltas)
+	for err == nil && int64(len(b)) > maxBytes && len(deltas) > 0 {
+		deltas = deltas[:len(deltas)*int(maxBytes)/len(b)]
+		b, err = json.Marshal(deltas)
+	}
+	if err != nil {
+		r.config.Log.Error("Unable to convert the retained deltas to json", "error", err)
+		return
+	}
+	if n := total - len(deltas); n > 0 {
+		r.config.Log.Warn("The spool is full, some retained deltas are only kept in memory", "count", n)
+	}
+
+	// replace the spool atomically so a crash doesn't leave it truncated
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		r.config.Log.Error("Unable to write the spool", "file", path, "error", err)
+	}
+}
+
+// loads the deltas spooled by a previous process so they're sent on the next
+// publish
+func (r *Registry) loadSpool() {
+	path := r.spoolPath()
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	var deltas []spooledDelta
+	if err == nil {
+		err = json.Unmarshal(b, &deltas)
+	}
+	if err != nil {
+		r.config.Log.Error("Unable to load the spool", "file", path, "error", err)
+		return
+	}
+
+	r.pendingMutex.Lock()
+	defer r.pendingMutex.Unlock()
+	for _, d := range deltas {
+		m := Measurement{NewId(d.Name, d.Tags), d.Value}
+		key := m.id.mapKey()
+		if p, exists := r.pending[key]; exists {
+			m.value += p.value
+		}
+		r.pending[key] = m
+		r.pendingStarts[key] = d.Start
+	}
+	r.config.Log.Info("Loaded retained deltas", "count", len(deltas), "file", path)
+}
@@ -0,0 +1,87 @@
+package spectator
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestRegistry_spool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	received := 0.0
+	up := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(503)
+			return
+		}
+		for _, e := range payloadToEntries(t, readPayload(t, r)) {
+			if e.tags["name"] == "requests" {
+				received += e.value
+			}
+		}
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	cfg.SpoolDir = dir
+	r := NewRegistry(cfg)
+	r.Counter("requests", nil).Add(3)
+	r.publish()
+	if _, err := os.Stat(r.spoolPath()); err != nil {
+		t.Fatalf("Expected the failed deltas to be spooled: %v", err)
+	}
+
+	// a new process picks up the spooled deltas
+	up = true
+	restarted := NewRegistry(cfg)
+	restarted.Counter("requests", nil).Add(2)
+	restarted.publish()
+	assertEqual(t, received, 5.0, "expected the spooled delta to be sent")
+	if _, err := os.Stat(restarted.spoolPath()); !os.IsNotExist(err) {
+		t.Errorf("Expected the spool to be removed once sent, got %v", err)
+	}
+}
+
+func TestRegistry_spoolMaxBytes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := makeConfig("")
+	cfg.SpoolDir = dir
+	cfg.SpoolMaxBytes = 200
+	r := NewRegistry(cfg)
+	for i := 0; i < 20; i++ {
+		r.retainDeltas([]Measurement{{NewId("c", map[string]string{"i": string(rune('a' + i))}).WithStat("count"), float64(i + 1)}}, deltaWindows{})
+	}
+	r.syncSpool()
+
+	b, err := ioutil.ReadFile(r.spoolPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > 200 {
+		t.Errorf("Expected the spool to be capped, got %d bytes", len(b))
+	}
+	restored := NewRegistry(cfg)
+	pending, _ := restored.withPendingDeltas(nil)
+	if len(pending) == 0 || len(pending) == 20 {
+		t.Fatalf("Expected some of the deltas to be spooled, got %d", len(pending))
+	}
+	for _, m := range pending {
+		if m.value < float64(20-len(pending)+1) {
+			t.Errorf("Expected the largest deltas to be kept, got %v", m)
+		}
+	}
+}
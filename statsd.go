@@ -0,0 +1,69 @@
+package spectator
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Values for Config.StatsdFlavor
+const (
+	StatsdFlavor    = "statsd"
+	DogStatsdFlavor = "dogstatsd"
+)
+
+// newStatsdPublisher returns a publisher using the StatsD line format.
+// Measurements using the add op are sent as counters and the rest as gauges.
+// DogStatsD gets the tags in its tag extension; plain StatsD has no tags, so
+// they are appended to the name as .key.value pairs sorted by key. Characters
+// the protocol uses as separators are replaced with underscores.
+func newStatsdPublisher(address string, flavor string) (*linePublisher, error) {
+	if flavor != "" && flavor != StatsdFlavor && flavor != DogStatsdFlavor {
+		return nil, fmt.Errorf("unknown statsd flavor %q", flavor)
+	}
+	dog := flavor == DogStatsdFlavor
+	return newLinePublisherFor("udp", address, func(m Measurement, tags map[string]string) []byte {
+		return formatStatsd(m, tags, dog)
+	}), nil
+}
+
+// replaces the characters used as separators by the protocol with underscores
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", ",", "_", "#", "_", "@", "_", "\n", "_")
+
+func appendStatsdLine(buf *bytes.Buffer, name string, tags map[string]string, value float64, kind string, dog bool) {
+	buf.WriteString(statsdReplacer.Replace(name))
+	keys := sortedTagKeys(tags)
+	if !dog {
+		for _, k := range keys {
+			buf.WriteString("." + statsdReplacer.Replace(k) + "." + statsdReplacer.Replace(tags[k]))
+		}
+	}
+	buf.WriteByte(':')
+	buf.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	buf.WriteString("|" + kind)
+	if dog && len(keys) > 0 {
+		buf.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(statsdReplacer.Replace(k) + ":" + statsdReplacer.Replace(tags[k]))
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+func formatStatsd(m Measurement, tags map[string]string, dog bool) []byte {
+	var buf bytes.Buffer
+	if opFromTags(m.id.tags) == addOp {
+		appendStatsdLine(&buf, m.id.name, tags, m.value, "c", dog)
+	} else {
+		if m.value < 0 {
+			// a signed gauge value is taken as a relative change, so reset it first
+			appendStatsdLine(&buf, m.id.name, tags, 0, "g", dog)
+		}
+		appendStatsdLine(&buf, m.id.name, tags, m.value, "g", dog)
+	}
+	return buf.Bytes()
+}
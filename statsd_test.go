@@ -0,0 +1,155 @@
+package spectator
+
+import (
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func statsdServer(t *testing.T) *net.UDPConn {
+	addr, err := net.ResolveUDPAddr("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func readStatsdLines(t *testing.T, conn *net.UDPConn) []string {
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := conn.Read(buf)
+		if err != nil {
+			break
+		}
+		lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func statsdConfig(address string, flavor string) *Config {
+	cfg := makeConfig("")
+	cfg.CommonTags = map[string]string{"nf.app": "test"}
+	cfg.StatsdAddress = address
+	cfg.StatsdFlavor = flavor
+	return cfg
+}
+
+func TestStatsd_DogStatsd(t *testing.T) {
+	server := statsdServer(t)
+	defer server.Close()
+
+	r := NewRegistry(statsdConfig(server.LocalAddr().String(), DogStatsdFlavor))
+	r.Counter("requests", map[string]string{"status": "200"}).Add(3)
+	r.Gauge("temperature", nil).Set(-4.5)
+	r.publish()
+
+	expected := []string{
+		"requests:3|c|#nf.app:test,statistic:count,status:200",
+		"temperature:-4.5|g|#nf.app:test,statistic:gauge",
+		"temperature:0|g|#nf.app:test,statistic:gauge",
+	}
+	if lines := readStatsdLines(t, server); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestStatsd_Plain(t *testing.T) {
+	server := statsdServer(t)
+	defer server.Close()
+
+	r := NewRegistry(statsdConfig(server.LocalAddr().String(), ""))
+	r.Timer("latency", nil).Record(2 * time.Second)
+	r.publish()
+
+	expected := []string{
+		"latency.nf.app.test.statistic.count:1|c",
+		"latency.nf.app.test.statistic.max:2|g",
+		"latency.nf.app.test.statistic.totalOfSquares:4|c",
+		"latency.nf.app.test.statistic.totalTime:2|c",
+	}
+	if lines := readStatsdLines(t, server); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %v, got %v", expected, lines)
+	}
+}
+
+func TestStatsd_PacketSize(t *testing.T) {
+	server := statsdServer(t)
+	defer server.Close()
+
+	p, err := newStatsdPublisher(server.LocalAddr().String(), StatsdFlavor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var measurements []Measurement
+	for i := 0; i < 200; i++ {
+		measurements = append(measurements, NewMeasurement(NewId("some.fairly.long.counter.name", map[string]string{"i": string(rune('a' + i%26))}).WithStat("count"), 1))
+	}
+	if _, err := p.send(p.payload(measurements, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	total := 0
+	for {
+		server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		n, err := server.Read(buf)
+		if err != nil {
+			break
+		}
+		if n > maxPacketSize {
+			t.Errorf("Packet too large: %d bytes", n)
+		}
+		total += len(strings.Split(string(buf[:n]), "\n"))
+	}
+	assertEqual(t, total, 200, "expected all lines to be sent")
+}
+
+func TestStatsd_UnknownFlavor(t *testing.T) {
+	if _, err := newStatsdPublisher("127.0.0.1:8125", "graphite"); err == nil {
+		t.Error("Expected an error for an unknown flavor")
+	}
+}
+
+func TestStatsd_DialFailure(t *testing.T) {
+	var published []interface{}
+	var publishErr error
+	cfg := statsdConfig("127.0.0.1:notaport", StatsdFlavor)
+	cfg.OnPublish = func(payload []interface{}, err error) {
+		published, publishErr = payload, err
+	}
+	r := NewRegistry(cfg)
+	if r.agent == nil {
+		t.Fatal("Expected the publisher to be created without dialing")
+	}
+
+	r.Counter("requests", nil).Add(3)
+	r.publish()
+	if publishErr == nil || len(published) != 1 {
+		t.Errorf("Expected the dial error to be notified, got %v %v", published, publishErr)
+	}
+	ms, _ := r.withPendingDeltas(nil)
+	if len(ms) != 1 || ms[0].Value() != 3 {
+		t.Errorf("Expected the delta to be retained, got %v", ms)
+	}
+}
+
+func TestStatsd_Escaping(t *testing.T) {
+	m := NewMeasurement(NewId("a:b", map[string]string{"statistic": "count", "k|1": "v,2"}), 1)
+	tags := map[string]string{"statistic": "count", "k|1": "v,2", "app#": "x@y:z"}
+
+	dog := string(formatStatsd(m, tags, true))
+	assertEqual(t, dog, "a_b:1|c|#app_:x_y_z,k_1:v_2,statistic:count\n", "unexpected dogstatsd line")
+
+	plain := string(formatStatsd(m, tags, false))
+	assertEqual(t, plain, "a_b.app_.x_y_z.k_1.v_2.statistic.count:1|c\n", "unexpected statsd line")
+}
@@ -0,0 +1,210 @@
+package spectator
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// stringTable keeps the string table of the last Atlas payload, along with
+// the indices in it of the tags of each measurement, so publishing a stable
+// set of meters doesn't rebuild and sort the table and look up every tag
+// each interval. The table is only reused if the batch uses exactly the same
+// strings with the same common tags, so registries that need several
+// batches per publish rebuild it for each batch.
+type stringTable struct {
+	mutex   sync.Mutex
+	indices map[string]int
+	sorted  []string
+	// the start of the payload: the size of the table and its strings
+	header []interface{}
+	// the same, encoded as JSON without the closing bracket
+	headerJson []byte
+	commonTags map[string]string
+	// the encoded tags of measurements by the map key of their ids: the
+	// number of tags, the pairs of indices of the common tags not set on the
+	// meter, of the tags of the meter and of its name, followed by the op
+	tags map[string][]int
+	// the generation in which each string was last seen, to tell whether a
+	// batch uses all the strings of the table without allocating a set
+	seen []uint32
+	gen  uint32
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{}
+}
+
+// update makes the table hold the strings of the measurements and common
+// tags, reusing the current one if it holds exactly the same strings. Must be
+// called with the mutex held.
+func (t *stringTable) update(measurements []Measurement, commonTags map[string]string) {
+	if t.reusable(measurements, commonTags) {
+		return
+	}
+
+	indices := make(map[string]int)
+	for k, v := range commonTags {
+		indices[k] = 0
+		indices[v] = 0
+	}
+	indices["name"] = 0
+	for _, m := range measurements {
+		indices[m.id.name] = 0
+		for k, v := range m.id.tags {
+			indices[k] = 0
+			indices[v] = 0
+		}
+	}
+	sorted := make([]string, 0, len(indices))
+	for s := range indices {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+	for i, s := range sorted {
+		indices[s] = i
+	}
+
+	t.indices = indices
+	t.sorted = sorted
+	t.header = make([]interface{}, 0, len(sorted)+1)
+	t.header = append(t.header, len(sorted))
+	// can't append the strings in one call since we can't convert []string to []interface{}
+	for _, s := range sorted {
+		t.header = append(t.header, s)
+	}
+	// the table always holds "name", so the array isn't empty
+	strings, _ := json.Marshal(sorted)
+	t.headerJson = strconv.AppendInt([]byte{'['}, int64(len(sorted)), 10)
+	t.headerJson = append(t.headerJson, ',')
+	t.headerJson = append(t.headerJson, strings[1:len(strings)-1]...)
+	t.commonTags = make(map[string]string, len(commonTags))
+	for k, v := range commonTags {
+		t.commonTags[k] = v
+	}
+	t.tags = make(map[string][]int)
+	t.seen = make([]uint32, len(sorted))
+	t.gen = 0
+}
+
+// returns whether the current table holds exactly the strings used by the
+// measurements and common tags
+func (t *stringTable) reusable(measurements []Measurement, commonTags map[string]string) bool {
+	if t.indices == nil || len(commonTags) != len(t.commonTags) {
+		return false
+	}
+	for k, v := range commonTags {
+		if cached, ok := t.commonTags[k]; !ok || cached != v {
+			return false
+		}
+	}
+
+	t.gen++
+	if t.gen == 0 {
+		// wrapped around, forget the old generations
+		for i := range t.seen {
+			t.seen[i] = 0
+		}
+		t.gen = 1
+	}
+	unique := 0
+	see := func(s string) bool {
+		i, ok := t.indices[s]
+		if ok && t.seen[i] != t.gen {
+			t.seen[i] = t.gen
+			unique++
+		}
+		return ok
+	}
+	for k, v := range commonTags {
+		if !see(k) || !see(v) {
+			return false
+		}
+	}
+	if !see("name") {
+		return false
+	}
+	for _, m := range measurements {
+		if !see(m.id.name) {
+			return false
+		}
+		for k, v := range m.id.tags {
+			if !see(k) || !see(v) {
+				return false
+			}
+		}
+	}
+	return unique == len(t.sorted)
+}
+
+// returns the encoded tags of the measurement, see stringTable.tags. Must be
+// called with the mutex held, after update.
+func (t *stringTable) encodedTags(m Measurement) []int {
+	key := m.id.mapKey()
+	if encoded, ok := t.tags[key]; ok {
+		return encoded
+	}
+
+	numCommon := 0
+	for k := range t.commonTags {
+		if _, local := m.id.tags[k]; !local {
+			numCommon++
+		}
+	}
+	encoded := make([]int, 0, 2*(len(m.id.tags)+1+numCommon)+2)
+	encoded = append(encoded, len(m.id.tags)+1+numCommon)
+	for k, v := range t.commonTags {
+		// tags set on the meter win over common tags
+		if _, local := m.id.tags[k]; local {
+			continue
+		}
+		encoded = append(encoded, t.indices[k], t.indices[v])
+	}
+	for k, v := range m.id.tags {
+		encoded = append(encoded, t.indices[k], t.indices[v])
+	}
+	encoded = append(encoded, t.indices["name"], t.indices[m.id.name])
+	encoded = append(encoded, opFromTags(m.id.tags))
+	t.tags[key] = encoded
+	return encoded
+}
+
+// appendJson appends the measurements encoded as an Atlas JSON payload to
+// b, writing the same bytes json.Marshal would for the payload built by
+// measurementsToPayload without boxing each element in an interface. Must be
+// called with the mutex held, after update.
+func (t *stringTable) appendJson(b []byte, measurements []Measurement) ([]byte, error) {
+	b = append(b, t.headerJson...)
+	for _, m := range measurements {
+		if math.IsNaN(m.value) || math.IsInf(m.value, 0) {
+			return b, &json.UnsupportedValueError{Str: strconv.FormatFloat(m.value, 'g', -1, 64)}
+		}
+		for _, index := range t.encodedTags(m) {
+			b = append(b, ',')
+			b = strconv.AppendInt(b, int64(index), 10)
+		}
+		b = append(b, ',')
+		b = appendJsonFloat(b, m.value)
+	}
+	return append(b, ']'), nil
+}
+
+// appends the float formatted like encoding/json does
+func appendJsonFloat(b []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// clean up e-09 to e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
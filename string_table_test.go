@@ -0,0 +1,124 @@
+package spectator
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func tableMeasurements(names ...string) []Measurement {
+	var ms []Measurement
+	for _, name := range names {
+		ms = append(ms, Measurement{NewId(name, map[string]string{"statistic": "count"}), 1})
+	}
+	return ms
+}
+
+func TestStringTable_Reused(t *testing.T) {
+	table := newStringTable()
+	common := map[string]string{"nf.app": "test"}
+	table.update(tableMeasurements("a", "b"), common)
+	sorted := table.sorted
+	if expected := []string{"a", "b", "count", "name", "nf.app", "statistic", "test"}; !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Expected %v, got %v (unexpected table)", expected, sorted)
+	}
+	encoded := table.encodedTags(tableMeasurements("a")[0])
+
+	// same strings in a different order
+	table.update(tableMeasurements("b", "a"), common)
+	if &table.sorted[0] != &sorted[0] {
+		t.Error("Expected the table to be reused")
+	}
+	if e := table.encodedTags(tableMeasurements("a")[0]); &e[0] != &encoded[0] {
+		t.Error("Expected the encoded tags to be reused")
+	}
+}
+
+func TestStringTable_Rebuilt(t *testing.T) {
+	table := newStringTable()
+	common := map[string]string{"nf.app": "test"}
+	table.update(tableMeasurements("a", "b"), common)
+
+	table.update(tableMeasurements("a", "c"), common)
+	if expected := []string{"a", "c", "count", "name", "nf.app", "statistic", "test"}; !reflect.DeepEqual(table.sorted, expected) {
+		t.Errorf("Expected %v, got %v (%s)", expected, table.sorted, "expected a new string")
+	}
+
+	table.update(tableMeasurements("a"), common)
+	if expected := []string{"a", "count", "name", "nf.app", "statistic", "test"}; !reflect.DeepEqual(table.sorted, expected) {
+		t.Errorf("Expected %v, got %v (%s)", expected, table.sorted, "expected unused strings to be dropped")
+	}
+
+	table.update(tableMeasurements("a"), map[string]string{"nf.app": "count"})
+	if expected := []string{"a", "count", "name", "nf.app", "statistic"}; !reflect.DeepEqual(table.sorted, expected) {
+		t.Errorf("Expected %v, got %v (%s)", expected, table.sorted, "expected the common tags to be checked")
+	}
+	encoded := table.encodedTags(tableMeasurements("a")[0])
+	// nf.app=count, statistic=count, name=a, then the add op
+	if expected := []int{3, 3, 1, 4, 1, 2, 0, addOp}; !reflect.DeepEqual(encoded, expected) {
+		t.Errorf("Expected %v, got %v (unexpected encoded tags)", expected, encoded)
+	}
+}
+
+func TestRegistry_MeasurementsToPayloadReusesTable(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	ms := tableMeasurements("a", "b", "c")
+	first := r.measurementsToPayload(ms)
+	second := r.measurementsToPayload(ms)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected the same payload, got %v and %v", first, second)
+	}
+
+	steady := testing.AllocsPerRun(10, func() { r.measurementsToPayload(ms) })
+	rebuilt := testing.AllocsPerRun(10, func() {
+		r.stringTable.indices = nil
+		r.measurementsToPayload(ms)
+	})
+	if steady >= rebuilt/2 {
+		t.Errorf("Expected reusing the table to save allocations: %v vs %v", steady, rebuilt)
+	}
+}
+
+func TestRegistry_MeasurementsToJson(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	r.SetCommonTag("quote", `"<&>"`)
+	var ms []Measurement
+	values := []float64{0, 1, -2.5, 1e-7, 1.5e-300, 1e21, 123456789.125, math.MaxFloat64, 1e20}
+	for i, v := range values {
+		ms = append(ms, Measurement{NewId("gauge", map[string]string{"statistic": "gauge", "i": string(rune('a' + i))}), v})
+	}
+	ms = append(ms, Measurement{NewId("ünïcode\n", map[string]string{"statistic": "count"}), 3})
+
+	expected, err := json.Marshal(r.measurementsToPayload(ms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		encoded, err := r.measurementsToJson(nil, ms)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEqual(t, string(encoded), string(expected), "expected the same bytes as json.Marshal")
+	}
+
+	prefix := []byte("prefix")
+	encoded, _ := r.measurementsToJson(prefix, ms)
+	assertEqual(t, string(encoded), "prefix"+string(expected), "expected the payload to be appended")
+
+	ms = append(ms, Measurement{NewId("inf", map[string]string{"statistic": "gauge"}), math.Inf(1)})
+	if _, err := r.measurementsToJson(nil, ms); err == nil {
+		t.Error("Expected an error for an infinite value like json.Marshal")
+	}
+}
+
+func TestRegistry_MeasurementsToJsonAllocs(t *testing.T) {
+	r := NewRegistry(makeConfig(""))
+	ms := tableMeasurements("a", "b", "c")
+	buf, _ := r.measurementsToJson(nil, ms)
+	allocs := testing.AllocsPerRun(10, func() { r.measurementsToJson(buf[:0], ms) })
+	// copying the common tags
+	if allocs > 2 {
+		t.Errorf("Expected encoding into a buffer to barely allocate, got %v allocations", allocs)
+	}
+}
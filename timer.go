@@ -1,35 +1,117 @@
 package spectator
 
 import (
+	"context"
 	"sync/atomic"
 	"time"
 )
 
+// Timer records durations. The statistics are reset on each measurement.
+// The total time is kept in nanoseconds and saturates at math.MaxInt64,
+// about 292 years per interval. The total of squares overflows an int64 with
+// a few seconds of durations, so it's kept as a float64: it has about 15
+// significant digits and doesn't overflow for any realistic interval.
 type Timer struct {
 	id             *Id
 	count          int64
 	totalTime      int64
 	totalOfSquares uint64
 	max            int64
+	clock          Clock
+	min            int64
+	trackMin       int32
+	// the timers of the child registries of a CompositeRegistry
+	forward []*Timer
+	// called when a negative duration is dropped, set by the registry
+	onNegative func()
 }
 
 func NewTimer(id *Id) *Timer {
-	return &Timer{id, 0, 0, 0, 0}
+	return &Timer{id, 0, 0, 0, 0, &SystemClock{}, noMin, 0, nil, nil}
+}
+
+func newTimerWithClock(id *Id, clock Clock) *Timer {
+	return &Timer{id, 0, 0, 0, 0, clock, noMin, 0, nil, nil}
+}
+
+// TrackMin enables the min statistic, the smallest duration recorded during
+// each interval. The aggregator has no min operation, so the min is
+// published as a gauge with the max op: it's the min of a single instance,
+// and aggregating it across instances, e.g. in a graph without a group by
+// nf.node, gives the largest of the per-instance mins rather than the
+// overall min.
+func (t *Timer) TrackMin() *Timer {
+	atomic.StoreInt32(&t.trackMin, 1)
+	for _, f := range t.forward {
+		f.TrackMin()
+	}
+	return t
 }
 
 func (t *Timer) MeterId() *Id {
 	return t.id
 }
 
+// Record records a duration. Negative durations are dropped and, for timers
+// created by a Registry, counted in spectator.measurements with id=dropped
+// and error=negativeValue.
 func (t *Timer) Record(amount time.Duration) {
-	if amount >= 0 {
-		atomic.AddInt64(&t.count, 1)
-		atomic.AddInt64(&t.totalTime, int64(amount))
-		addFloat64(&t.totalOfSquares, float64(amount)*float64(amount))
-		updateMax(&t.max, int64(amount))
+	if amount < 0 {
+		t.negative()
+		return
+	}
+	atomic.AddInt64(&t.count, 1)
+	addSaturating(&t.totalTime, int64(amount))
+	addFloat64(&t.totalOfSquares, float64(amount)*float64(amount))
+	updateMax(&t.max, int64(amount))
+	updateMin(&t.min, int64(amount))
+	for _, f := range t.forward {
+		f.Record(amount)
 	}
 }
 
+// records that a negative duration was dropped
+func (t *Timer) negative() {
+	if t.onNegative != nil {
+		t.onNegative()
+	}
+	for _, f := range t.forward {
+		f.negative()
+	}
+}
+
+// Stopwatch measures the time elapsed since it was started and records it in a Timer
+type Stopwatch struct {
+	timer *Timer
+	start time.Time
+}
+
+// Start returns a stopwatch that records the elapsed time in this timer when stopped
+func (t *Timer) Start() *Stopwatch {
+	return &Stopwatch{t, t.clock.Now()}
+}
+
+// Stop records the time elapsed since the stopwatch was started and returns it
+func (s *Stopwatch) Stop() time.Duration {
+	elapsed := s.timer.clock.Now().Sub(s.start)
+	s.timer.Record(elapsed)
+	return elapsed
+}
+
+// TimeFunc records how long it takes to run f
+func (t *Timer) TimeFunc(f func()) {
+	sw := t.Start()
+	defer sw.Stop()
+	f()
+}
+
+// TimeCtx records how long it takes to run f, returning its error
+func (t *Timer) TimeCtx(ctx context.Context, f func(ctx context.Context) error) error {
+	sw := t.Start()
+	defer sw.Stop()
+	return f(ctx)
+}
+
 func (t *Timer) Count() int64 {
 	return atomic.LoadInt64(&t.count)
 }
@@ -46,6 +128,10 @@ func (t *Timer) Measure() []Measurement {
 	tSq := Measurement{t.id.WithStat("totalOfSquares"), totalSqNanos / 1e18}
 	maxNanos := atomic.SwapInt64(&t.max, 0)
 	mx := Measurement{t.id.WithStat("max"), float64(maxNanos) / 1e9}
+	minNanos := atomic.SwapInt64(&t.min, noMin)
 
-	return []Measurement{cnt, tTime, tSq, mx}
+	if atomic.LoadInt32(&t.trackMin) == 0 {
+		return []Measurement{cnt, tTime, tSq, mx}
+	}
+	return []Measurement{cnt, tTime, tSq, mx, {t.id.WithStat("min"), minValue(minNanos, 1e9)}}
 }
@@ -1,8 +1,13 @@
 package spectator
 
 import (
+	"context"
+	"errors"
+	"math"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 func getTimer(name string) *Timer {
@@ -81,3 +86,124 @@ func TestTimer_Measure(t *testing.T) {
 	c.Record(200)
 	assertTimer(t, c, 2, 300, 100*100+200*200, 200)
 }
+
+func TestTimer_Stopwatch(t *testing.T) {
+	r := NewRegistry(config)
+	clock := &ManualClock{}
+	r.clock = clock
+	timer := r.Timer("sw", nil)
+
+	sw := timer.Start()
+	clock.SetFromDuration(42 * time.Millisecond)
+	if elapsed := sw.Stop(); elapsed != 42*time.Millisecond {
+		t.Errorf("Expected 42ms, got %v", elapsed)
+	}
+
+	timer.TimeFunc(func() {
+		clock.SetFromDuration(50 * time.Millisecond)
+	})
+
+	expectedErr := errors.New("failed")
+	err := timer.TimeCtx(context.Background(), func(ctx context.Context) error {
+		clock.SetFromDuration(60 * time.Millisecond)
+		return expectedErr
+	})
+	if err != expectedErr {
+		t.Errorf("Expected the function error to be returned, got %v", err)
+	}
+
+	if timer.Count() != 3 {
+		t.Errorf("Expected 3 recordings, got %d", timer.Count())
+	}
+	if timer.TotalTime() != 60*time.Millisecond {
+		t.Errorf("Expected 60ms, got %v", timer.TotalTime())
+	}
+}
+
+func TestTimer_Min(t *testing.T) {
+	timer := getTimer("min").TrackMin()
+	timer.Record(3 * time.Second)
+	timer.Record(1 * time.Second)
+	ms := timer.Measure()
+	if len(ms) != 5 || ms[4].id.tags["statistic"] != "min" || ms[4].value != 1 {
+		t.Errorf("Expected min=1, got %v", ms)
+	}
+
+	ms = timer.Measure()
+	if !math.IsNaN(ms[4].value) {
+		t.Errorf("Expected the min to be reset after being measured, got %v", ms[4])
+	}
+}
+
+func TestTimer_MeasureStress(t *testing.T) {
+	timer := NewTimer(NewId("stress", nil))
+	const writers = 8
+	const records = 10000
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < records; j++ {
+				timer.Record(1)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	count, total := 0.0, 0.0
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		ms := timer.Measure()
+		count += ms[0].Value()
+		total += ms[1].Value()
+	}
+
+	assertEqual(t, count, float64(writers*records), "expected every record to be counted once")
+	if math.Abs(total*1e9-writers*records) > 1e-3 {
+		t.Errorf("Expected every duration to be added once, got a total of %v", total)
+	}
+}
+
+func TestTimer_ExtremeValues(t *testing.T) {
+	timer := NewTimer(NewId("extreme", nil))
+	timer.Record(math.MaxInt64)
+	timer.Record(math.MaxInt64)
+	timer.Record(time.Hour)
+	ms := timer.Measure()
+
+	assertEqual(t, ms[0].Value(), 3.0, "unexpected count")
+	assertEqual(t, ms[1].Value(), float64(math.MaxInt64)/1e9, "expected the total time to saturate")
+	expectedSq := (2*float64(math.MaxInt64)*float64(math.MaxInt64) + float64(time.Hour)*float64(time.Hour)) / 1e18
+	if sq := ms[2].Value(); math.IsInf(sq, 0) || math.Abs(sq-expectedSq)/expectedSq > 1e-12 {
+		t.Errorf("Expected the total of squares to be %v, got %v", expectedSq, sq)
+	}
+	assertEqual(t, ms[3].Value(), float64(math.MaxInt64)/1e9, "unexpected max")
+
+	// the statistics are reset on each measurement
+	timer.Record(time.Second)
+	ms = timer.Measure()
+	assertEqual(t, ms[1].Value(), 1.0, "expected the total time to be reset")
+	assertEqual(t, ms[2].Value(), 1.0, "expected the total of squares to be reset")
+}
+
+func TestTimer_TotalOfSquaresPrecision(t *testing.T) {
+	// a million 10 minute durations: the sum of squares is about 3.6e29 ns²,
+	// far past what an int64 holds
+	timer := NewTimer(NewId("long", nil))
+	for i := 0; i < 1000000; i++ {
+		timer.Record(10 * time.Minute)
+	}
+	expected := 1e6 * 600 * 600
+	if sq := timer.Measure()[2].Value(); math.Abs(sq-expected)/expected > 1e-9 {
+		t.Errorf("Expected the total of squares to be %v, got %v", expected, sq)
+	}
+}
@@ -0,0 +1,86 @@
+package spectator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// returns the TLS configuration for publish requests, or nil to use the
+// defaults
+func tlsConfig(config *Config) (*tls.Config, error) {
+	if config.TLSConfig == nil && config.TLSCAFile == "" && config.TLSCertFile == "" &&
+		config.TLSKeyFile == "" && !config.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+	c := &tls.Config{}
+	if config.TLSConfig != nil {
+		c = config.TLSConfig.Clone()
+	}
+	if config.TLSCAFile != "" {
+		pem, err := ioutil.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read the CA bundle")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("No certificates found in %s", config.TLSCAFile)
+		}
+		c.RootCAs = pool
+	}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to load the client certificate")
+		}
+		c.Certificates = append(c.Certificates, cert)
+	}
+	if config.TLSInsecureSkipVerify {
+		c.InsecureSkipVerify = true
+	}
+	return c, nil
+}
+
+const defaultConnectTimeout = 30 * time.Second
+
+func connectTimeout(config *Config) time.Duration {
+	if config.ConnectTimeout > 0 {
+		return config.ConnectTimeout
+	}
+	return defaultConnectTimeout
+}
+
+// returns the transport used for http and https uris, with the same settings
+// as http.DefaultTransport plus the configured proxy and TLS options
+func newTransport(config *Config) (*http.Transport, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   connectTimeout(config),
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if config.ProxyURL != "" {
+		proxy, err := url.Parse(config.ProxyURL)
+		if err != nil {
+			return transport, errors.Wrap(err, "Invalid proxy url")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	c, err := tlsConfig(config)
+	if err != nil {
+		return transport, err
+	}
+	transport.TLSClientConfig = c
+	return transport, nil
+}
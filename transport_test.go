@@ -0,0 +1,176 @@
+package spectator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writePem(t *testing.T, path string, blockType string, b []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: b}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writes a self-signed client certificate and its key
+func writeClientCert(t *testing.T, certFile string, keyFile string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "spectator-go"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePem(t, certFile, "CERTIFICATE", der)
+	writePem(t, keyFile, "EC PRIVATE KEY", keyDer)
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestHttpClient_MutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	clientCert := writeClientCert(t, certFile, keyFile)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	writePem(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	cfg := makeConfig(server.URL)
+	cfg.TLSCAFile = caFile
+	client := NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, _ := client.PostJson(server.URL, []byte("42")); status == 200 {
+		t.Error("Expected the server to require a client certificate")
+	}
+
+	cfg.TLSCertFile = certFile
+	cfg.TLSKeyFile = keyFile
+	client = NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, err := client.PostJson(server.URL, []byte("42")); status != 200 || err != nil {
+		t.Errorf("Expected the post to succeed with the client certificate, got %d %v", status, err)
+	}
+}
+
+func TestHttpClient_TLSInsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	cfg := makeConfig(server.URL)
+	client := NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, _ := client.PostJson(server.URL, []byte("42")); status == 200 {
+		t.Error("Expected the self-signed certificate to be rejected")
+	}
+
+	cfg.TLSInsecureSkipVerify = true
+	client = NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, err := client.PostJson(server.URL, []byte("42")); status != 200 || err != nil {
+		t.Errorf("Expected the post to succeed, got %d %v", status, err)
+	}
+}
+
+func TestTlsConfig_Invalid(t *testing.T) {
+	if c, err := tlsConfig(&Config{}); c != nil || err != nil {
+		t.Errorf("Expected the defaults, got %v %v", c, err)
+	}
+	if _, err := tlsConfig(&Config{TLSCAFile: "/does/not/exist"}); err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+	base := &tls.Config{ServerName: "atlas"}
+	c, _ := tlsConfig(&Config{TLSConfig: base, TLSInsecureSkipVerify: true})
+	assertEqual(t, c.ServerName, "atlas", "expected the base configuration to be used")
+	assertEqual(t, base.InsecureSkipVerify, false, "expected the base configuration not to be modified")
+}
+
+func TestHttpClient_ProxyURL(t *testing.T) {
+	var host string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.URL.Host
+		w.Write(okMsg)
+	}))
+	defer proxy.Close()
+
+	cfg := makeConfig("http://atlas.example.org/api/v1/publish")
+	cfg.ProxyURL = proxy.URL
+	client := NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, err := client.PostJson(cfg.Uri, []byte("42")); status != 200 || err != nil {
+		t.Fatalf("Expected the post to go through the proxy, got %d %v", status, err)
+	}
+	assertEqual(t, host, "atlas.example.org", "expected the proxy to get the aggregator uri")
+
+	if _, err := newTransport(&Config{ProxyURL: "http://[::1"}); err == nil {
+		t.Error("Expected an error for an invalid proxy url")
+	}
+}
+
+type countingTransport struct {
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestHttpClient_Injected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(okMsg)
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	cfg := makeConfig(server.URL)
+	cfg.Transport = transport
+	client := NewHttpClient(NewRegistry(cfg), time.Second)
+	client.PostJson(cfg.Uri, []byte("42"))
+	assertEqual(t, transport.requests, 1, "expected the transport to be used")
+
+	clientTransport := &countingTransport{}
+	cfg.HTTPClient = &http.Client{Transport: clientTransport}
+	client = NewHttpClient(NewRegistry(cfg), time.Second)
+	if status, err := client.PostJson(cfg.Uri, []byte("42")); status != 200 || err != nil {
+		t.Fatalf("Expected the post to succeed, got %d %v", status, err)
+	}
+	assertEqual(t, clientTransport.requests, 1, "expected the client to be used")
+	assertEqual(t, cfg.HTTPClient.Timeout, time.Duration(0), "expected the client not to be modified")
+}
@@ -0,0 +1,103 @@
+package spectator
+
+// Limits enforced by the aggregator on tag keys and values. Meter names are
+// treated as the value of the name tag.
+const (
+	maxKeyLength   = 60
+	maxValueLength = 120
+)
+
+const invalidTagsName = "spectator.invalidTags"
+
+// Policies for the meters whose name or tags break the naming rules, see
+// Config.TagPolicy
+const (
+	// TagPolicySanitize replaces invalid characters with underscores and
+	// truncates long values when the meter is created, so its MeterId is the
+	// published one
+	TagPolicySanitize = "sanitize"
+	// TagPolicyReject doesn't register the meter, counting it in
+	// spectator.invalidTags instead
+	TagPolicyReject = "reject"
+	// TagPolicyLogOnce logs the first invalid meter of each name when it's
+	// created, and sanitizes the ids when publishing like the default policy
+	TagPolicyLogOnce = "log-once"
+)
+
+func (r *Registry) tagPolicy() string {
+	if r.config.StrictTags {
+		return TagPolicyReject
+	}
+	return r.config.TagPolicy
+}
+
+func isValidTagChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '-', c == '.', c == '_', c == '~', c == '^':
+		return true
+	default:
+		return false
+	}
+}
+
+func isValidTagString(s string, maxLength int) bool {
+	if len(s) == 0 || len(s) > maxLength {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isValidTagChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// replaces invalid characters with underscores and truncates overlong strings
+func normalizeTagString(s string, maxLength int) string {
+	if len(s) == 0 {
+		return "_"
+	}
+	if len(s) > maxLength {
+		s = s[:maxLength]
+	}
+	b := []byte(s)
+	for i, c := range b {
+		if !isValidTagChar(c) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func isValidId(id *Id) bool {
+	if !isValidTagString(id.name, maxValueLength) {
+		return false
+	}
+	for k, v := range id.tags {
+		if !isValidTagString(k, maxKeyLength) || !isValidTagString(v, maxValueLength) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns an id that satisfies the aggregator naming rules
+func normalizeId(id *Id) *Id {
+	if isValidId(id) {
+		return id
+	}
+	tags := make(map[string]string, len(id.tags))
+	for k, v := range id.tags {
+		tags[normalizeTagString(k, maxKeyLength)] = normalizeTagString(v, maxValueLength)
+	}
+	return NewId(normalizeTagString(id.name, maxValueLength), tags)
+}
+
+func normalizeMeasurements(measurements []Measurement) []Measurement {
+	for i, m := range measurements {
+		measurements[i].id = normalizeId(m.id)
+	}
+	return measurements
+}
@@ -0,0 +1,92 @@
+package spectator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeId(t *testing.T) {
+	id := NewId("foo bar", map[string]string{"bad key!": "ok", "k": strings.Repeat("v", 200)})
+	n := normalizeId(id)
+	if n.name != "foo_bar" {
+		t.Errorf("Expected foo_bar, got %s", n.name)
+	}
+	if v, ok := n.tags["bad_key_"]; !ok || v != "ok" {
+		t.Errorf("Expected bad_key_=ok, got %v", n.tags)
+	}
+	if len(n.tags["k"]) != maxValueLength {
+		t.Errorf("Expected value to be truncated to %d, got %d", maxValueLength, len(n.tags["k"]))
+	}
+
+	valid := NewId("foo.bar", map[string]string{"nf.app": "app-v001"})
+	if normalizeId(valid) != valid {
+		t.Error("Valid ids should be left alone")
+	}
+}
+
+func TestRegistry_InvalidTagsLenient(t *testing.T) {
+	r := NewRegistry(makeConfig("http://example.org"))
+	r.Counter("foo", map[string]string{"bad key": "v"}).Increment()
+
+	measurements := normalizeMeasurements(r.Measurements())
+	if len(measurements) != 1 {
+		t.Fatalf("Expected 1 measurement, got %d", len(measurements))
+	}
+	if v := measurements[0].id.tags["bad_key"]; v != "v" {
+		t.Errorf("Expected the tag key to be normalized, got %v", measurements[0].id.tags)
+	}
+	if c := r.Counter(invalidTagsName, nil).Count(); c != 0 {
+		t.Errorf("Expected no invalid tags in lenient mode, got %f", c)
+	}
+}
+
+func TestRegistry_InvalidTagsStrict(t *testing.T) {
+	cfg := makeConfig("http://example.org")
+	cfg.StrictTags = true
+	r := NewRegistry(cfg)
+	r.Counter("foo", map[string]string{"bad key": "v"}).Increment()
+	r.Counter("foo", map[string]string{"good.key": "v"}).Increment()
+
+	if c := r.Counter(invalidTagsName, nil).Count(); c != 1 {
+		t.Errorf("Expected 1 invalid meter, got %f", c)
+	}
+	for _, m := range r.Meters() {
+		if _, ok := m.MeterId().tags["bad key"]; ok {
+			t.Error("Invalid meters should not be registered")
+		}
+	}
+	if len(r.Meters()) != 2 {
+		t.Errorf("Expected the valid counter and %s, got %d meters", invalidTagsName, len(r.Meters()))
+	}
+}
+
+func TestRegistry_TagPolicy(t *testing.T) {
+	cfg := makeConfig("http://example.org")
+	cfg.TagPolicy = TagPolicySanitize
+	r := NewRegistry(cfg)
+	c := r.Counter("foo bar", map[string]string{"bad key": "v"})
+	assertEqual(t, c.MeterId().name, "foo_bar", "expected the name to be sanitized")
+	assertEqual(t, c.MeterId().tags["bad_key"], "v", "expected the tag key to be sanitized")
+	if r.Counter("foo_bar", map[string]string{"bad_key": "v"}) != c {
+		t.Error("Expected the sanitized id to find the same meter")
+	}
+
+	cfg = makeConfig("http://example.org")
+	cfg.TagPolicy = TagPolicyReject
+	r = NewRegistry(cfg)
+	r.Counter("foo", map[string]string{"bad key": "v"}).Increment()
+	if c := r.Counter(invalidTagsName, nil).Count(); c != 1 {
+		t.Errorf("Expected 1 invalid meter, got %f", c)
+	}
+
+	logger := &errorLogger{}
+	cfg = makeConfig("http://example.org")
+	cfg.TagPolicy = TagPolicyLogOnce
+	cfg.Log = logger
+	r = NewRegistry(cfg)
+	r.Counter("foo", map[string]string{"bad key": "a"}).Increment()
+	r.Counter("foo", map[string]string{"bad key": "b"}).Increment()
+	r.Counter("foo", map[string]string{"good.key": "c"}).Increment()
+	assertEqual(t, len(logger.errors), 1, "expected the invalid meters to be logged once")
+	assertEqual(t, len(r.Meters()), 3, "expected the invalid meters to be registered")
+}